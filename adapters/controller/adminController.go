@@ -0,0 +1,287 @@
+package controller
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+	"github.com/Go-routine-4595/DataEnricher/internal/config"
+	"github.com/Go-routine-4595/DataEnricher/internal/redis"
+	"github.com/Go-routine-4595/DataEnricher/service"
+	"github.com/Go-routine-4595/DataEnricher/usecase"
+
+	"github.com/rs/zerolog"
+)
+
+// AdminController serves the authenticated admin HTTP API, and the public read-only schema routes when they have
+// no listener of their own
+type AdminController struct {
+	addr     string
+	token    string
+	useCase  usecase.IAdmin
+	input    ISubscription
+	registry service.IRegistryInspector
+	skew     service.ISkewInspector
+	logger   *zerolog.Logger
+	server   *http.Server
+}
+
+// ISubscription pauses the input subscription while consumption is paused, so messages stay with the broker
+// instead of filling the queue and being dropped
+type ISubscription interface {
+	Pause() error
+	Resume() error
+}
+
+type deviceResponse struct {
+	DeviceID  string          `json:"device_id"`
+	SiteCode  string          `json:"site_code"`
+	DataModel string          `json:"data_model"`
+	Registry  json.RawMessage `json:"registry"`
+}
+
+type consumptionResponse struct {
+	Paused     bool `json:"paused"`
+	QueueDepth int  `json:"queue_depth"`
+}
+
+type silentDevicesResponse struct {
+	SiteCode string                `json:"site_code"`
+	Devices  []domain.SilentDevice `json:"devices"`
+}
+
+type skewedDevicesResponse struct {
+	Devices []domain.SkewedDevice `json:"devices"`
+}
+
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewAdminController(config *config.Config, useCase usecase.IAdmin, input ISubscription, registry service.IRegistryInspector, skew service.ISkewInspector, logger *zerolog.Logger) *AdminController {
+	var l zerolog.Logger
+
+	if logger == nil {
+		l = zerolog.New(os.Stdout).With().Timestamp().Logger()
+	} else {
+		l = *logger
+	}
+
+	c := &AdminController{
+		addr:     config.AdminAddr,
+		token:    config.AdminToken.Value(),
+		useCase:  useCase,
+		input:    input,
+		registry: registry,
+		skew:     skew,
+		logger:   &l,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices/{id}", c.getDevice)
+	mux.HandleFunc("GET /consumption", c.getConsumption)
+	mux.HandleFunc("POST /consumption/pause", c.pause)
+	mux.HandleFunc("POST /consumption/resume", c.resume)
+	mux.HandleFunc("POST /cache/flush", c.flushCache)
+	mux.HandleFunc("POST /rules/reload", c.reloadRules)
+	mux.HandleFunc("GET /loglevel", c.getLogLevel)
+	mux.HandleFunc("PUT /loglevel", c.setLogLevel)
+	mux.HandleFunc("GET /failures", c.getFailures)
+	mux.HandleFunc("GET /sites/{siteCode}/silent", c.getSilentDevices)
+	mux.HandleFunc("GET /clock-skew", c.getSkewedDevices)
+
+	// Without schema_addr the schemas are served here, without the admin token so the consumers decoding Avro
+	// and protobuf messages can fetch them, the routes are read-only
+	root := http.NewServeMux()
+	if config.SchemaAddr == "" {
+		NewSchemaController(config, &l).routes(root)
+	}
+	root.Handle("/", c.authenticate(mux))
+
+	c.server = &http.Server{
+		Handler:           root,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	return c
+}
+
+// Start listens on the admin address and serves requests until the context is cancelled
+func (c *AdminController) Start(ctx context.Context) error {
+	if c.token == "" {
+		return errors.New("admin API requires ADMIN_TOKEN to be set")
+	}
+
+	listener, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	c.logger.Info().Msgf("Admin API listening on %s", listener.Addr())
+
+	go func() {
+		err := c.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.logger.Error().Err(err).Msg("Admin API stopped")
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		c.server.Shutdown(shutdownCtx)
+	}()
+
+	return nil
+}
+
+func (c *AdminController) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(c.token)) != 1 {
+			c.logger.Warn().Msgf("Unauthorized admin request %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+			return
+		}
+		c.logger.Debug().Msgf("Admin request %s %s", r.Method, r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *AdminController) getDevice(w http.ResponseWriter, r *http.Request) {
+	msg, err := c.registry.LookupDevice(r.PathValue("id"))
+	if err != nil {
+		// Only a missing registry entry is a 404, a failing registry lookup is not the device's fault
+		var repositoryErr *service.ErrRepository
+		switch {
+		case errors.Is(err, redis.ErrNotFound):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+		case errors.As(err, &repositoryErr):
+			writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: err.Error()})
+		default:
+			writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deviceResponse{
+		DeviceID:  msg.DeviceID,
+		SiteCode:  msg.SiteCode,
+		DataModel: msg.DataModel,
+		Registry:  msg.RegistryRaw,
+	})
+}
+
+func (c *AdminController) getConsumption(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, consumptionResponse{
+		Paused:     c.useCase.IsPaused(),
+		QueueDepth: c.useCase.QueueDepth(),
+	})
+}
+
+// pause releases the input subscription before pausing the use case so no message is queued while paused
+func (c *AdminController) pause(w http.ResponseWriter, r *http.Request) {
+	if err := c.input.Pause(); err != nil {
+		writeJSON(w, http.StatusBadGateway, errorResponse{Error: err.Error()})
+		return
+	}
+	c.useCase.Pause()
+	c.getConsumption(w, r)
+}
+
+// resume restarts the use case before subscribing again so the first messages are consumed right away
+func (c *AdminController) resume(w http.ResponseWriter, r *http.Request) {
+	c.useCase.Resume()
+	if err := c.input.Resume(); err != nil {
+		writeJSON(w, http.StatusBadGateway, errorResponse{Error: err.Error()})
+		return
+	}
+	c.getConsumption(w, r)
+}
+
+func (c *AdminController) flushCache(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]int{"flushed": c.registry.FlushRegistryCache()})
+}
+
+func (c *AdminController) reloadRules(w http.ResponseWriter, r *http.Request) {
+	n, err := c.useCase.ReloadRules()
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"rules": n})
+}
+
+func (c *AdminController) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, logLevelRequest{Level: zerolog.GlobalLevel().String()})
+}
+
+func (c *AdminController) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req logLevelRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	level, err := zerolog.ParseLevel(strings.ToLower(req.Level))
+	if err != nil || req.Level == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "unknown log level: " + req.Level})
+		return
+	}
+
+	zerolog.SetGlobalLevel(level)
+	c.logger.Info().Msgf("Log level set to %s", level)
+	writeJSON(w, http.StatusOK, logLevelRequest{Level: level.String()})
+}
+
+func (c *AdminController) getFailures(w http.ResponseWriter, r *http.Request) {
+	report := c.useCase.Failures()
+
+	if reason := r.URL.Query().Get("reason"); reason != "" {
+		report = usecase.FailureReport{
+			Counts: map[string]int{reason: report.Counts[reason]},
+			Recent: map[string][]usecase.Failure{reason: report.Recent[reason]},
+		}
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (c *AdminController) getSilentDevices(w http.ResponseWriter, r *http.Request) {
+	devices, err := c.useCase.SilentDevices(r.PathValue("siteCode"))
+	if errors.Is(err, usecase.ErrLivenessDisabled) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, silentDevicesResponse{SiteCode: r.PathValue("siteCode"), Devices: devices})
+}
+
+func (c *AdminController) getSkewedDevices(w http.ResponseWriter, r *http.Request) {
+	devices := c.skew.SkewedDevices()
+	if devices == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "clock skew check is disabled"})
+		return
+	}
+	writeJSON(w, http.StatusOK, skewedDevicesResponse{Devices: devices})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+	"github.com/Go-routine-4595/DataEnricher/internal/config"
+	"github.com/Go-routine-4595/DataEnricher/internal/redis"
+	"github.com/Go-routine-4595/DataEnricher/service"
+	"github.com/Go-routine-4595/DataEnricher/usecase"
+	"github.com/rs/zerolog"
+)
+
+type fakeAdmin struct {
+	paused bool
+}
+
+func (a *fakeAdmin) Pause()                                              { a.paused = true }
+func (a *fakeAdmin) Resume()                                             { a.paused = false }
+func (a *fakeAdmin) IsPaused() bool                                      { return a.paused }
+func (a *fakeAdmin) QueueDepth() int                                     { return 0 }
+func (a *fakeAdmin) Failures() usecase.FailureReport                     { return usecase.FailureReport{} }
+func (a *fakeAdmin) ReloadRules() (int, error)                           { return 0, nil }
+func (a *fakeAdmin) SilentDevices(string) ([]domain.SilentDevice, error) { return nil, nil }
+
+type fakeSubscription struct {
+	paused bool
+	err    error
+}
+
+func (s *fakeSubscription) Pause() error {
+	if s.err != nil {
+		return s.err
+	}
+	s.paused = true
+	return nil
+}
+
+func (s *fakeSubscription) Resume() error {
+	if s.err != nil {
+		return s.err
+	}
+	s.paused = false
+	return nil
+}
+
+type fakeRegistry struct {
+	err error
+}
+
+func (r fakeRegistry) LookupDevice(deviceID string) (domain.EnrichedMessage, error) {
+	if r.err != nil {
+		return domain.EnrichedMessage{}, r.err
+	}
+	return domain.EnrichedMessage{DeviceID: deviceID, SiteCode: "s1"}, nil
+}
+
+func (r fakeRegistry) FlushRegistryCache() int { return 0 }
+
+type fakeSkew struct{}
+
+func (fakeSkew) SkewedDevices() []domain.SkewedDevice { return nil }
+
+func newTestAdmin(useCase usecase.IAdmin, input ISubscription, registry fakeRegistry) http.Handler {
+	cfg := config.Default()
+	cfg.AdminToken = "secret"
+	logger := zerolog.Nop()
+	return NewAdminController(cfg, useCase, input, registry, fakeSkew{}, &logger).server.Handler
+}
+
+func serve(handler http.Handler, method string, path string, token string) int {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestPauseResume(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		startPaused bool
+		err         error
+		wantCode    int
+		wantPaused  bool
+		wantInput   bool
+	}{
+		{name: "pause", path: "/consumption/pause", wantCode: http.StatusOK, wantPaused: true, wantInput: true},
+		{name: "resume", path: "/consumption/resume", startPaused: true, wantCode: http.StatusOK},
+		{name: "pause with the unsubscribe failing", path: "/consumption/pause", err: errors.New("timeout"), wantCode: http.StatusBadGateway},
+		{name: "resume with the subscribe failing", path: "/consumption/resume", startPaused: true, err: errors.New("timeout"), wantCode: http.StatusBadGateway, wantInput: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCase := &fakeAdmin{paused: tt.startPaused}
+			input := &fakeSubscription{paused: tt.startPaused, err: tt.err}
+			code := serve(newTestAdmin(useCase, input, fakeRegistry{}), http.MethodPost, tt.path, "secret")
+			if code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+			if useCase.paused != tt.wantPaused || input.paused != tt.wantInput {
+				t.Errorf("use case paused = %t, input paused = %t, want %t, %t", useCase.paused, input.paused, tt.wantPaused, tt.wantInput)
+			}
+		})
+	}
+}
+
+func TestSchemaRoutes(t *testing.T) {
+	tests := []struct {
+		name       string
+		schemaAddr string
+		server     string
+		path       string
+		token      string
+		want       int
+	}{
+		{name: "schema without token", server: "admin", path: "/schemas/ids/1", want: http.StatusOK},
+		{name: "unknown schema id", server: "admin", path: "/schemas/ids/999", want: http.StatusNotFound},
+		{name: "schema types", server: "admin", path: "/schemas/types", want: http.StatusOK},
+		{name: "proto file", server: "admin", path: "/schemas/proto", want: http.StatusOK},
+		{name: "admin route without token", server: "admin", path: "/consumption", want: http.StatusUnauthorized},
+		{name: "admin route with token", server: "admin", path: "/consumption", token: "secret", want: http.StatusOK},
+		{name: "schema on its own listener", schemaAddr: ":8082", server: "schema", path: "/schemas/ids/1", want: http.StatusOK},
+		{name: "proto file on its own listener", schemaAddr: ":8082", server: "schema", path: "/schemas/proto", want: http.StatusOK},
+		{name: "admin route not on the schema listener", schemaAddr: ":8082", server: "schema", path: "/consumption", token: "secret", want: http.StatusNotFound},
+		{name: "schema not on the admin listener", schemaAddr: ":8082", server: "admin", path: "/schemas/types", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.AdminToken = "secret"
+			cfg.SchemaAddr = tt.schemaAddr
+			logger := zerolog.Nop()
+			handler := NewSchemaController(cfg, &logger).server.Handler
+			if tt.server == "admin" {
+				handler = NewAdminController(cfg, &fakeAdmin{}, &fakeSubscription{}, fakeRegistry{}, fakeSkew{}, &logger).server.Handler
+			}
+
+			code := serve(handler, http.MethodGet, tt.path, tt.token)
+			if code != tt.want {
+				t.Errorf("GET %s = %d, want %d", tt.path, code, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDevice(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "found", want: http.StatusOK},
+		{name: "not found", err: &service.ErrRepository{DeviceID: "d1", Err: fmt.Errorf("key 'device-d1' %w", redis.ErrNotFound)}, want: http.StatusNotFound},
+		{name: "registry unavailable", err: &service.ErrRepository{DeviceID: "d1", Err: errors.New("i/o timeout")}, want: http.StatusServiceUnavailable},
+		{name: "invalid registry entry", err: &service.ErrEnrichment{DeviceID: "d1", Err: errors.New("siteCode not found")}, want: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := serve(newTestAdmin(&fakeAdmin{}, &fakeSubscription{}, fakeRegistry{err: tt.err}), http.MethodGet, "/devices/d1", "secret")
+			if code != tt.want {
+				t.Errorf("GET /devices/d1 = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
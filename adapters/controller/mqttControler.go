@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/Go-routine-4595/DataEnricher/internal/config"
+	"github.com/Go-routine-4595/DataEnricher/internal/encoding"
 	"github.com/Go-routine-4595/DataEnricher/usecase"
 
 	mqtt "github.com/Go-routine-4595/DataEnricher/internal/mqtt"
@@ -31,7 +32,8 @@ func NewMqttController(config *config.Config, useCase usecase.IGeoKonAPIMessage,
 		user = nil
 	}
 	if config.Password != "" {
-		passw = &config.Password
+		password := config.Password.Value()
+		passw = &password
 	} else {
 		passw = nil
 	}
@@ -40,16 +42,13 @@ func NewMqttController(config *config.Config, useCase usecase.IGeoKonAPIMessage,
 	} else {
 		sub = nil
 	}
-	cfg := &mqtt.MQTTConfig{
-		Host:           config.Host,
-		Port:           config.Port,
-		Keepalive:      60,
-		Username:       user,
-		Password:       passw,
-		SubscribeTopic: sub,
-		ClientID:       "DataEnricher-controller-" + uuid.New().String(),
-	}
-	controller := mqtt.NewMQTTConnector(cfg, logger).WithLogger(logger).WithSubscription(useCase)
+	cfg := mqtt.NewMQTTConfig(config.Host, config.Port, "DataEnricher-controller-"+uuid.New().String()).
+		WithName("mqtt-input").
+		WithRetry(config.MQTTConnectTimeout, config.MQTTRetryInitial, config.MQTTRetryMax).
+		WithStartupPolicy(mqtt.StartupPolicy(config.MQTTStartupPolicy), config.MQTTStartupTimeout)
+	cfg.Username = user
+	cfg.Password = passw
+	cfg.SubscribeTopic = sub
 
 	var l zerolog.Logger
 
@@ -59,26 +58,63 @@ func NewMqttController(config *config.Config, useCase usecase.IGeoKonAPIMessage,
 		l = *logger
 	}
 
-	return &MqttController{
-		controller: controller,
-		useCase:    useCase,
-		logger:     &l,
+	c := &MqttController{
+		useCase: useCase,
+		logger:  &l,
 	}
+	c.controller = mqtt.NewMQTTConnector(cfg, logger).WithLogger(logger).WithSubscription(c)
+	return c
 }
 
-func (c *MqttController) onMessage(message mqtt.Message) {
-	err := c.useCase.GeoKonAPIMessage(message.Payload())
+// GeoKonAPIMessage receives the messages of the subscription, messages compressed by the producer are
+// detected by their magic bytes and decompressed before they are handed to the use case
+func (c *MqttController) GeoKonAPIMessage(message []byte) error {
+	payload, compression, err := encoding.Decompress(message)
+	if err != nil {
+		c.logger.Error().Msgf("Error decompressing %s message: %v", compression, err)
+		return err
+	}
+
+	err = c.useCase.GeoKonAPIMessage(payload)
 	if err != nil {
-		c.logger.Error().Msgf("Error processing message: %v message: %s", err, string(message.Payload()))
+		c.logger.Error().Msgf("Error processing message: %v message: %s", err, string(payload))
 	}
+	return err
+}
+
+// WithConnectionObserver reports the input connection status and events to the observer
+func (c *MqttController) WithConnectionObserver(observer mqtt.IConnectionObserver) *MqttController {
+	c.controller.WithConnectionObserver(observer)
+	return c
 }
 
+// Start connects to the input broker according to the startup policy, the context bounds the connection
+// attempts, the connection is closed by Stop
 func (c *MqttController) Start(ctx context.Context) error {
-	var err error
+	return c.controller.Start(ctx)
+}
 
-	go func() {
-		err = c.controller.Start(ctx)
-	}()
+// SetSubscriptionTopic moves the input subscription to a new topic filter
+func (c *MqttController) SetSubscriptionTopic(topic string) error {
+	return c.controller.Resubscribe(topic)
+}
 
-	return err
+// Unsubscribe stops the input, messages already queued are left to the use case
+func (c *MqttController) Unsubscribe() error {
+	return c.controller.Unsubscribe()
+}
+
+// Pause releases the input subscription so the broker stops delivering while consumption is paused
+func (c *MqttController) Pause() error {
+	return c.controller.PauseSubscription()
+}
+
+// Resume subscribes again to the input topic
+func (c *MqttController) Resume() error {
+	return c.controller.ResumeSubscription()
+}
+
+// Stop disconnects from the broker
+func (c *MqttController) Stop() {
+	c.controller.Stop()
 }
@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/internal/config"
+	"github.com/Go-routine-4595/DataEnricher/internal/encoding"
+
+	"github.com/rs/zerolog"
+)
+
+// SchemaController serves the public read-only schema routes, standing in for a schema registry for the consumers
+// decoding Avro and protobuf messages, on its own listener or on the admin one
+type SchemaController struct {
+	addr     string
+	schemaID int
+	logger   *zerolog.Logger
+	server   *http.Server
+}
+
+func NewSchemaController(config *config.Config, logger *zerolog.Logger) *SchemaController {
+	var l zerolog.Logger
+
+	if logger == nil {
+		l = zerolog.New(os.Stdout).With().Timestamp().Logger()
+	} else {
+		l = *logger
+	}
+
+	c := &SchemaController{
+		addr:     config.SchemaAddr,
+		schemaID: config.AvroSchemaID,
+		logger:   &l,
+	}
+
+	mux := http.NewServeMux()
+	c.routes(mux)
+	c.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	return c
+}
+
+// routes registers the schema routes on mux, they need no token
+func (c *SchemaController) routes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /schemas/ids/{id}", c.getSchema)
+	mux.HandleFunc("GET /schemas/types", c.getSchemaTypes)
+	mux.HandleFunc("GET /schemas/proto", c.getProtoFile)
+}
+
+// Start listens on the schema address and serves requests until the context is cancelled
+func (c *SchemaController) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	c.logger.Info().Msgf("Schema API listening on %s", listener.Addr())
+
+	go func() {
+		err := c.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.logger.Error().Err(err).Msg("Schema API stopped")
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		c.server.Shutdown(shutdownCtx)
+	}()
+
+	return nil
+}
+
+// getSchema serves the Avro writer schema of a message type the way a schema registry does, for the consumers
+// resolving the schema ID found in the message header
+func (c *SchemaController) getSchema(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "schema not found"})
+		return
+	}
+	schema, ok := encoding.AvroSchemaByID(c.schemaID, id)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "schema not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"schema": schema})
+}
+
+// getSchemaTypes lists the Avro schema ID of every published message type
+func (c *SchemaController) getSchemaTypes(w http.ResponseWriter, r *http.Request) {
+	ids := make(map[string]int, len(encoding.Schemas))
+	for _, name := range encoding.Schemas {
+		ids[name], _ = encoding.AvroSchemaID(c.schemaID, name)
+	}
+	writeJSON(w, http.StatusOK, ids)
+}
+
+// getProtoFile serves the .proto definition of the protobuf messages
+func (c *SchemaController) getProtoFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(encoding.ProtoFile()))
+}
@@ -0,0 +1,26 @@
+package gateways
+
+import (
+	"errors"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+	"github.com/Go-routine-4595/DataEnricher/internal/redis"
+)
+
+// AlertLevel returns the level stored under alert-<key>, ok when the key does not exist, it bypasses the
+// registry cache since the level changes with the messages
+func (r *Repository) AlertLevel(key string) (domain.AlertLevel, error) {
+	value, err := r.redis.GetState("alert-" + key)
+	if errors.Is(err, redis.ErrNotFound) {
+		return domain.AlertOK, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return domain.AlertLevel(value), nil
+}
+
+// SetAlertLevel stores the level under alert-<key> without expiration
+func (r *Repository) SetAlertLevel(key string, level domain.AlertLevel) error {
+	return r.redis.SetState("alert-"+key, string(level))
+}
@@ -0,0 +1,37 @@
+package gateways
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+	"github.com/Go-routine-4595/DataEnricher/internal/redis"
+)
+
+// AnomalyModel returns the model checkpointed under anomaly-<key>, it bypasses the registry cache since the
+// model changes with the messages
+func (r *Repository) AnomalyModel(key string) (domain.AnomalyModel, bool, error) {
+	var model domain.AnomalyModel
+
+	value, err := r.redis.GetState("anomaly-" + key)
+	if errors.Is(err, redis.ErrNotFound) {
+		return model, false, nil
+	}
+	if err != nil {
+		return model, false, err
+	}
+	err = json.Unmarshal([]byte(value), &model)
+	if err != nil {
+		return domain.AnomalyModel{}, false, err
+	}
+	return model, true, nil
+}
+
+// SetAnomalyModel checkpoints the model under anomaly-<key> without expiration
+func (r *Repository) SetAnomalyModel(key string, model domain.AnomalyModel) error {
+	b, err := json.Marshal(model)
+	if err != nil {
+		return err
+	}
+	return r.redis.SetState("anomaly-"+key, string(b))
+}
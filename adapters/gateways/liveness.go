@@ -0,0 +1,144 @@
+package gateways
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+	"github.com/Go-routine-4595/DataEnricher/internal/redis"
+)
+
+// The liveness keys, the sorted sets are scored in unix milliseconds. The keys of a site are suffixed with the
+// {siteCode} hash tag so the scripts updating them together run on a single cluster slot
+const (
+	livenessSites = "liveness-sites"  // set of the sites with tracked devices
+	livenessDue   = "liveness-due-"   // sorted set of the reporting devices by deadline
+	livenessStale = "liveness-stale-" // sorted set of the stale devices by last report
+	livenessSeen  = "liveness-seen-"  // hash of the last report of every device
+)
+
+// recordReport removes the device from the stale devices, stores its report and deadline and returns whether it
+// was stale with its previous report, empty for a new device
+//
+// KEYS: seen, stale, due. ARGV: device, report, deadline
+var recordReport = redis.NewScript(`
+local previous = redis.call('HGET', KEYS[1], ARGV[1])
+local stale = redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[3], ARGV[3], ARGV[1])
+return {stale, previous or ''}
+`)
+
+// markStale moves the device from the due to the stale devices and returns 1, or 0 when the device reported
+// since it was found overdue or another replica moved it first
+//
+// KEYS: seen, due, stale. ARGV: device, report the device was found overdue with, empty if none, its score
+var markStale = redis.NewScript(`
+local seen = redis.call('HGET', KEYS[1], ARGV[1]) or ''
+if seen ~= ARGV[2] then
+	return 0
+end
+if redis.call('ZREM', KEYS[2], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[3], ARGV[3], ARGV[1])
+return 1
+`)
+
+func livenessKey(prefix, siteCode string) string {
+	return prefix + "{" + siteCode + "}"
+}
+
+// RecordReport records the report of a device, removing it from the stale devices. The site is listed first,
+// liveness-sites is on another slot than the keys of the site, and listing it again is harmless
+func (r *Repository) RecordReport(siteCode, deviceID string, at, deadline time.Time) (bool, time.Time, error) {
+	var lastSeen time.Time
+
+	err := r.redis.SAdd(livenessSites, siteCode)
+	if err != nil {
+		return false, lastSeen, err
+	}
+	keys := []string{livenessKey(livenessSeen, siteCode), livenessKey(livenessStale, siteCode), livenessKey(livenessDue, siteCode)}
+	result, err := r.redis.Run(recordReport, keys, deviceID, at.UnixMilli(), deadline.UnixMilli())
+	if err != nil {
+		return false, lastSeen, err
+	}
+
+	reply, _ := result.([]interface{})
+	if len(reply) != 2 {
+		return false, lastSeen, fmt.Errorf("unexpected reply %v to the report of device %s", result, deviceID)
+	}
+	stale, _ := reply[0].(int64)
+	if previous, _ := reply[1].(string); previous != "" {
+		lastSeen = parseMillis(previous)
+	}
+	return stale > 0, lastSeen, nil
+}
+
+func (r *Repository) LivenessSites() ([]string, error) {
+	return r.redis.SMembers(livenessSites)
+}
+
+func (r *Repository) OverdueDevices(siteCode string, now time.Time) ([]domain.SilentDevice, error) {
+	due, err := r.redis.ZRangeByScore(livenessKey(livenessDue, siteCode), math.Inf(-1), float64(now.UnixMilli()))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(due))
+	for i, member := range due {
+		ids[i] = member.Member
+	}
+	seen, err := r.redis.HMGet(livenessKey(livenessSeen, siteCode), ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]domain.SilentDevice, 0, len(due))
+	for _, id := range ids {
+		device := domain.SilentDevice{DeviceID: id}
+		if value, ok := seen[id]; ok {
+			device.LastSeen = parseMillis(value)
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// MarkStale moves the device atomically, so a single replica marks it and a report in between keeps it due
+func (r *Repository) MarkStale(siteCode string, device domain.SilentDevice) (bool, error) {
+	report := ""
+	if !device.LastSeen.IsZero() {
+		report = strconv.FormatInt(device.LastSeen.UnixMilli(), 10)
+	}
+	keys := []string{livenessKey(livenessSeen, siteCode), livenessKey(livenessDue, siteCode), livenessKey(livenessStale, siteCode)}
+	result, err := r.redis.Run(markStale, keys, device.DeviceID, report, device.LastSeen.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	marked, _ := result.(int64)
+	return marked == 1, nil
+}
+
+func (r *Repository) StaleDevices(siteCode string) ([]domain.SilentDevice, error) {
+	stale, err := r.redis.ZRangeByScore(livenessKey(livenessStale, siteCode), math.Inf(-1), math.Inf(1))
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]domain.SilentDevice, 0, len(stale))
+	for _, member := range stale {
+		devices = append(devices, domain.SilentDevice{
+			DeviceID: member.Member,
+			LastSeen: time.UnixMilli(int64(member.Score)).UTC(),
+		})
+	}
+	return devices, nil
+}
+
+func parseMillis(value string) time.Time {
+	ms, _ := strconv.ParseInt(value, 10, 64)
+	return time.UnixMilli(ms).UTC()
+}
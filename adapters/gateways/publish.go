@@ -1,17 +1,38 @@
 package gateways
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/Go-routine-4595/DataEnricher/internal/config"
 	mqtt "github.com/Go-routine-4595/DataEnricher/internal/mqtt"
+	"github.com/Go-routine-4595/DataEnricher/internal/outbox"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 )
 
+// outboxRetryInterval is how often a replay is retried while the outbox is not empty
+const outboxRetryInterval = 5 * time.Second
+
+// IOutboxMetrics receives the outbox backlog after every change
+type IOutboxMetrics interface {
+	RecordOutboxBacklog(records int, bytes int64)
+}
+
 type Publish struct {
-	client *mqtt.MQTTConnector
-	logger *zerolog.Logger
+	client  *mqtt.MQTTConnector
+	logger  *zerolog.Logger
+	outbox  *outbox.Outbox
+	metrics IOutboxMetrics
+	replay  chan struct{}
+
+	// mu orders the direct publishes with the start and the end of a replay, messages go through the outbox
+	// while replaying is set so none overtakes the records being replayed
+	mu        sync.Mutex
+	replaying bool
 }
 
 func NewPublish(config *config.Config, logger *zerolog.Logger) *Publish {
@@ -22,36 +43,151 @@ func NewPublish(config *config.Config, logger *zerolog.Logger) *Publish {
 	} else {
 		l = *logger
 	}
-	cfg := mqtt.NewMQTTConfig(config.Host, config.Port, "DataEnricher-controller-"+uuid.New().String())
+	cfg := mqtt.NewMQTTConfig(config.Host, config.Port, "DataEnricher-controller-"+uuid.New().String()).
+		WithName("mqtt-output").
+		WithRetry(config.MQTTConnectTimeout, config.MQTTRetryInitial, config.MQTTRetryMax).
+		WithStartupPolicy(mqtt.StartupPolicy(config.MQTTStartupPolicy), config.MQTTStartupTimeout).
+		WithPublishTimeout(config.MQTTPublishTimeout)
 	if config.Password != "" {
-		cfg.Password = &config.Password
+		cfg.WithPassword(config.Password.Value())
 	}
 	if config.User != "" {
 		cfg.Username = &config.User
 	}
 
 	client := mqtt.NewMQTTConnector(cfg, &l)
-	err := client.Connect()
-
-	if err != nil {
-		l.Fatal().Msgf("Failed to connect to MQTT broker: %v", err)
-	}
 
 	return &Publish{
 		client: client,
 		logger: &l,
+		replay: make(chan struct{}, 1),
 	}
 }
 
-func (p *Publish) PublishMessage(message []byte, topic string) {
+// WithConnectionObserver reports the output connection status and events to the observer
+func (p *Publish) WithConnectionObserver(observer mqtt.IConnectionObserver) *Publish {
+	p.client.WithConnectionObserver(observer)
+	return p
+}
+
+// Start connects to the output broker according to the startup policy
+func (p *Publish) Start(ctx context.Context) error {
+	return p.client.Start(ctx)
+}
+
+// WithOutbox stores the messages that cannot be published in the outbox and replays them, in order,
+// once the broker is reachable again
+func (p *Publish) WithOutbox(o *outbox.Outbox, metrics IOutboxMetrics) *Publish {
+	p.outbox = o
+	p.metrics = metrics
+	p.client.WithOnConnect(p.triggerReplay)
+	return p
+}
+
+// PublishMessage publishes a message, or queues it in the outbox when there is one and the broker cannot take
+// it, the error is returned when the message was neither published nor queued
+func (p *Publish) PublishMessage(message []byte, topic string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Once something is in the outbox new messages queue behind it to keep the publish order
+	if p.outbox != nil && (p.replaying || p.outbox.Pending() > 0) {
+		return p.store(message, topic)
+	}
+
 	err := p.client.Publish(topic, message)
-	p.logger.Debug().Msgf("Published data: %s to %s", string(message), topic)
 	if err != nil {
 		p.logger.Error().Msgf("Failed to publish to %s: %v", topic, err)
 		p.logger.Debug().Msgf("Message: %s", string(message))
+		if p.outbox != nil {
+			return p.store(message, topic)
+		}
+		return err
+	}
+	p.logger.Debug().Msgf("Published data: %s to %s", string(message), topic)
+	return nil
+}
+
+// Run replays the outbox on reconnection and periodically while it is not empty, until the context is done
+func (p *Publish) Run(ctx context.Context) {
+	if p.outbox == nil {
+		return
+	}
+
+	ticker := time.NewTicker(outboxRetryInterval)
+	defer ticker.Stop()
+
+	p.triggerReplay()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.replay:
+			p.replayOutbox()
+		case <-ticker.C:
+			if p.outbox.Pending() > 0 {
+				p.replayOutbox()
+			}
+		}
 	}
 }
 
 func (p *Publish) Close() {
 	p.client.Stop()
+	if p.outbox != nil {
+		err := p.outbox.Close()
+		if err != nil {
+			p.logger.Error().Err(err).Msg("Failed to close outbox")
+		}
+	}
+}
+
+func (p *Publish) store(message []byte, topic string) error {
+	err := p.outbox.Append(topic, message)
+	if err != nil {
+		p.logger.Error().Msgf("Failed to store message for %s in outbox, message dropped: %v", topic, err)
+		return fmt.Errorf("storing message for %s in outbox: %w", topic, err)
+	}
+	p.logger.Debug().Msgf("Stored message for %s in outbox", topic)
+	p.recordBacklog()
+	return nil
+}
+
+func (p *Publish) triggerReplay() {
+	select {
+	case p.replay <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Publish) replayOutbox() {
+	// The replay waits for the next connection instead of failing on its first record
+	if p.outbox.Pending() == 0 || !p.client.IsConnected() {
+		return
+	}
+
+	p.setReplaying(true)
+	sent, expired, err := p.outbox.Replay(p.client.Publish)
+	p.setReplaying(false)
+	if sent > 0 || expired > 0 {
+		p.logger.Info().Msgf("Outbox replayed %d messages, dropped %d expired messages", sent, expired)
+	}
+	if err != nil {
+		p.logger.Warn().Msgf("Outbox replay interrupted, %d messages pending: %v", p.outbox.Pending(), err)
+	}
+	p.recordBacklog()
+}
+
+// setReplaying waits for the direct publish in flight, if any, before a replay starts
+func (p *Publish) setReplaying(replaying bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.replaying = replaying
+}
+
+func (p *Publish) recordBacklog() {
+	if p.metrics == nil {
+		return
+	}
+	p.metrics.RecordOutboxBacklog(p.outbox.Size())
 }
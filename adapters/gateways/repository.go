@@ -2,14 +2,106 @@ package gateways
 
 import (
 	"os"
+	"sync"
+	"time"
 
 	"github.com/Go-routine-4595/DataEnricher/internal/redis"
 	"github.com/rs/zerolog"
 )
 
+// maxCacheEntries caps the registry cache, the expired entries are swept when it is reached and an arbitrary
+// entry is dropped if none expired
+const maxCacheEntries = 100000
+
+type cacheEntry struct {
+	value   string
+	expires time.Time
+}
+
+// registryCache holds the registry entries until they expire, expired entries are removed when read and
+// swept when the cache is full
+type registryCache struct {
+	mu         sync.RWMutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]cacheEntry
+}
+
+func newRegistryCache(maxEntries int) *registryCache {
+	return &registryCache{maxEntries: maxEntries, entries: make(map[string]cacheEntry)}
+}
+
+func (c *registryCache) setTTL(ttl time.Duration) {
+	c.mu.Lock()
+	c.ttl = ttl
+	c.mu.Unlock()
+}
+
+// get returns the entry of key unless it expired, in which case it is removed
+func (c *registryCache) get(key string, now time.Time) (string, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+
+	if !ok {
+		return "", false
+	}
+	if now.Before(entry.expires) {
+		return entry.value, true
+	}
+
+	c.mu.Lock()
+	// The entry may have been refreshed since it was read
+	if current, ok := c.entries[key]; ok && !now.Before(current.expires) {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	return "", false
+}
+
+// put caches the entry of key for the TTL, nothing is cached with a zero TTL
+func (c *registryCache) put(key string, value string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl <= 0 {
+		return
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		c.sweep(now)
+	}
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(c.ttl)}
+}
+
+// sweep removes the expired entries, and an arbitrary one when none expired, c.mu is held
+func (c *registryCache) sweep(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	for key := range c.entries {
+		if len(c.entries) < c.maxEntries {
+			break
+		}
+		delete(c.entries, key)
+	}
+}
+
+// flush drops every entry and returns how many were removed
+func (c *registryCache) flush() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.entries)
+	c.entries = make(map[string]cacheEntry)
+	return n
+}
+
 type Repository struct {
 	redis  *redis.Client
 	logger *zerolog.Logger
+	cache  *registryCache
 }
 
 func NewRepository(connectionString string, logger *zerolog.Logger) (*Repository, error) {
@@ -26,7 +118,13 @@ func NewRepository(connectionString string, logger *zerolog.Logger) (*Repository
 		l = *logger
 	}
 
-	return &Repository{redis: redis, logger: &l}, nil
+	return &Repository{redis: redis, logger: &l, cache: newRegistryCache(maxCacheEntries)}, nil
+}
+
+// WithCacheTTL enables caching of registry entries for the given duration, a zero TTL disables the cache
+func (r *Repository) WithCacheTTL(ttl time.Duration) *Repository {
+	r.cache.setTTL(ttl)
+	return r
 }
 
 func (r *Repository) Close() {
@@ -39,5 +137,32 @@ func (r *Repository) IsConnected() bool {
 }
 
 func (r *Repository) Get(key string) (string, error) {
-	return r.redis.Get(key)
+	if value, ok := r.cache.get(key, time.Now()); ok {
+		return value, nil
+	}
+
+	value, err := r.redis.Get(key)
+	if err != nil {
+		return "", err
+	}
+
+	r.cache.put(key, value, time.Now())
+	return value, nil
+}
+
+// Flush drops every cached registry entry and returns how many were removed
+func (r *Repository) Flush() int {
+	n := r.cache.flush()
+	r.logger.Info().Msgf("Flushed %d registry cache entries", n)
+	return n
+}
+
+// MarkSeen stores the key for the window with SET NX EX and reports whether it was not already set
+func (r *Repository) MarkSeen(key string, window time.Duration) (bool, error) {
+	return r.redis.SetNX("seen-"+key, "1", window)
+}
+
+// Forget removes a key stored by MarkSeen
+func (r *Repository) Forget(key string) error {
+	return r.redis.Del("seen-" + key)
 }
@@ -0,0 +1,77 @@
+package gateways
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegistryCache(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	type step struct {
+		put    string
+		get    string
+		at     time.Duration
+		wantOK bool
+	}
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		maxEntries int
+		steps      []step
+		wantLen    int
+	}{
+		{
+			name:       "hit within the ttl",
+			ttl:        time.Minute,
+			maxEntries: 10,
+			steps:      []step{{put: "a"}, {get: "a", at: 30 * time.Second, wantOK: true}},
+			wantLen:    1,
+		},
+		{
+			name:       "expired entry removed on read",
+			ttl:        time.Minute,
+			maxEntries: 10,
+			steps:      []step{{put: "a"}, {get: "a", at: time.Minute}},
+			wantLen:    0,
+		},
+		{
+			name:       "disabled",
+			maxEntries: 10,
+			steps:      []step{{put: "a"}, {get: "a"}},
+			wantLen:    0,
+		},
+		{
+			name:       "expired entries swept when full",
+			ttl:        time.Minute,
+			maxEntries: 2,
+			steps:      []step{{put: "a"}, {put: "b", at: 30 * time.Second}, {put: "c", at: time.Minute}, {get: "b", at: time.Minute, wantOK: true}},
+			wantLen:    2,
+		},
+		{
+			name:       "capped when nothing expired",
+			ttl:        time.Minute,
+			maxEntries: 2,
+			steps:      []step{{put: "a"}, {put: "b"}, {put: "c"}, {get: "c", wantOK: true}},
+			wantLen:    2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newRegistryCache(tt.maxEntries)
+			c.setTTL(tt.ttl)
+			for i, s := range tt.steps {
+				now := start.Add(s.at)
+				if s.put != "" {
+					c.put(s.put, "v", now)
+					continue
+				}
+				if _, ok := c.get(s.get, now); ok != s.wantOK {
+					t.Errorf("step %d: get(%s) found = %t, want %t", i, s.get, ok, s.wantOK)
+				}
+			}
+			if len(c.entries) != tt.wantLen {
+				t.Errorf("%d entries cached, want %d", len(c.entries), tt.wantLen)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package gateways
+
+import (
+	"errors"
+	"os"
+
+	"github.com/Go-routine-4595/DataEnricher/internal/redis"
+)
+
+// RuleFile loads the rule set from a YAML or JSON file
+type RuleFile struct {
+	path string
+}
+
+func NewRuleFile(path string) *RuleFile {
+	return &RuleFile{path: path}
+}
+
+// LoadRules returns the content of the rule file
+func (f *RuleFile) LoadRules() ([]byte, error) {
+	return os.ReadFile(f.path)
+}
+
+// LoadRules returns the rule set stored under the rules key, nil when the key does not exist, it bypasses the
+// registry cache so a reload sees the current rules
+func (r *Repository) LoadRules() ([]byte, error) {
+	value, err := r.redis.Get("rules")
+	if errors.Is(err, redis.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(value), nil
+}
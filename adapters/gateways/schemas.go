@@ -0,0 +1,44 @@
+package gateways
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Go-routine-4595/DataEnricher/internal/redis"
+)
+
+// SchemaDirectory loads the payload schemas from <dir>/<dataModel>.json
+type SchemaDirectory struct {
+	dir string
+}
+
+func NewSchemaDirectory(dir string) *SchemaDirectory {
+	return &SchemaDirectory{dir: dir}
+}
+
+// LoadSchema returns the schema of the data model, nil when the file does not exist
+func (d *SchemaDirectory) LoadSchema(dataModel string) ([]byte, error) {
+	if dataModel == "" || filepath.Base(dataModel) != dataModel || dataModel == ".." {
+		return nil, fmt.Errorf("invalid data model name %q", dataModel)
+	}
+
+	b, err := os.ReadFile(filepath.Join(d.dir, dataModel+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// LoadSchema returns the schema stored under schema-<dataModel>, nil when the key does not exist
+func (r *Repository) LoadSchema(dataModel string) ([]byte, error) {
+	value, err := r.Get("schema-" + dataModel)
+	if errors.Is(err, redis.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(value), nil
+}
@@ -0,0 +1,27 @@
+package gateways
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/internal/redis"
+)
+
+// LastObservation returns the time stored under sequence-<deviceId> in unix milliseconds, it bypasses the
+// registry cache since the time changes with the messages
+func (r *Repository) LastObservation(deviceID string) (time.Time, bool, error) {
+	value, err := r.redis.GetState("sequence-" + deviceID)
+	if errors.Is(err, redis.ErrNotFound) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return parseMillis(value), true, nil
+}
+
+// SetLastObservation stores the time under sequence-<deviceId> without expiration
+func (r *Repository) SetLastObservation(deviceID string, t time.Time) error {
+	return r.redis.SetState("sequence-"+deviceID, strconv.FormatInt(t.UnixMilli(), 10))
+}
@@ -0,0 +1,37 @@
+package gateways
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Go-routine-4595/DataEnricher/internal/redis"
+)
+
+type unitSettings struct {
+	UnitSystem string `json:"unitSystem"`
+}
+
+// UnitSystem returns the unitSystem of the site-<siteCode> entry, or of the datamodel-<dataModel> entry when
+// the site has none
+func (r *Repository) UnitSystem(siteCode, dataModel string) (string, error) {
+	for _, key := range []string{"site-" + siteCode, "datamodel-" + dataModel} {
+		value, err := r.Get(key)
+		if errors.Is(err, redis.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		var settings unitSettings
+		err = json.Unmarshal([]byte(value), &settings)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", key, err)
+		}
+		if settings.UnitSystem != "" {
+			return settings.UnitSystem, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+// Aggregate is the rollup of a device metric over a tumbling window [Start, End), Partial is set when the
+// window was published before it closed, e.g. on shutdown
+type Aggregate struct {
+	DeviceID  string    `json:"deviceId"`
+	SiteCode  string    `json:"siteCode"`
+	DataModel string    `json:"dataModel"`
+	Metric    string    `json:"metric"`
+	Unit      string    `json:"unit"`
+	Window    string    `json:"window"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+	Mean      float64   `json:"mean"`
+	Count     int       `json:"count"`
+	Last      float64   `json:"last"`
+	LastTime  time.Time `json:"lastTime"`
+	Partial   bool      `json:"partial,omitempty"`
+
+	sum float64
+}
+
+// Add accounts for a value observed at t, Last is the value with the latest time
+func (a *Aggregate) Add(t time.Time, value float64) {
+	if a.Count == 0 || value < a.Min {
+		a.Min = value
+	}
+	if a.Count == 0 || value > a.Max {
+		a.Max = value
+	}
+	if a.Count == 0 || !t.Before(a.LastTime) {
+		a.Last = value
+		a.LastTime = t
+	}
+	a.Count++
+	a.sum += value
+	a.Mean = a.sum / float64(a.Count)
+}
+
+// WindowName renders a window duration the short way, e.g. 15m or 1h
+func WindowName(window time.Duration) string {
+	name := window.String()
+	if strings.HasSuffix(name, "m0s") {
+		name = strings.TrimSuffix(name, "0s")
+	}
+	if strings.HasSuffix(name, "h0m") {
+		name = strings.TrimSuffix(name, "0m")
+	}
+	return name
+}
@@ -0,0 +1,44 @@
+package domain
+
+import "time"
+
+// AlertLevel is the alarm state of a device metric
+type AlertLevel string
+
+const (
+	AlertOK       AlertLevel = "ok"
+	AlertWarning  AlertLevel = "warning"
+	AlertCritical AlertLevel = "critical"
+)
+
+// Severity orders the levels, ok is 0
+func (l AlertLevel) Severity() int {
+	switch l {
+	case AlertWarning:
+		return 1
+	case AlertCritical:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// Alert events
+const (
+	AlertRaised  = "raised"
+	AlertCleared = "cleared"
+)
+
+// Alert is published when the level of a device metric changes, Threshold is the limit crossed by a raised alert
+type Alert struct {
+	Event         string     `json:"event"`
+	Level         AlertLevel `json:"level"`
+	PreviousLevel AlertLevel `json:"previousLevel"`
+	Time          time.Time  `json:"time"`
+	DeviceID      string     `json:"deviceId"`
+	SiteCode      string     `json:"siteCode"`
+	Metric        string     `json:"metric"`
+	Unit          string     `json:"unit"`
+	Value         float64    `json:"value"`
+	Threshold     *float64   `json:"threshold,omitempty"`
+}
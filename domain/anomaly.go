@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"math"
+	"time"
+)
+
+// Anomaly kinds
+const (
+	AnomalyZScore = "zscore"
+	AnomalyRate   = "rate"
+)
+
+// Anomaly is published when an observation of a device metric deviates from its model, Score is the z-score
+// against the mean and standard deviation before the observation, Rate the change per second since the
+// previous observation and Limit the bound that was crossed
+type Anomaly struct {
+	Kind     string    `json:"kind"`
+	Time     time.Time `json:"time"`
+	DeviceID string    `json:"deviceId"`
+	SiteCode string    `json:"siteCode"`
+	Metric   string    `json:"metric"`
+	Unit     string    `json:"unit"`
+	Value    float64   `json:"value"`
+	Score    float64   `json:"score"`
+	Mean     float64   `json:"mean"`
+	StdDev   float64   `json:"stdDev"`
+	Rate     *float64  `json:"rate,omitempty"`
+	Limit    float64   `json:"limit"`
+}
+
+// AnomalyModel is the exponentially weighted mean and variance of a device metric with its last value
+type AnomalyModel struct {
+	Mean     float64   `json:"mean"`
+	Variance float64   `json:"variance"`
+	Count    int       `json:"count"`
+	Last     float64   `json:"last"`
+	LastTime time.Time `json:"lastTime"`
+}
+
+// Score returns the z-score of value against the model, 0 when the model has no variance yet
+func (m *AnomalyModel) Score(value float64) float64 {
+	if m.Variance <= 0 {
+		return 0
+	}
+	return (value - m.Mean) / math.Sqrt(m.Variance)
+}
+
+// Add updates the model with a value observed at t, alpha is the weight of the new value
+func (m *AnomalyModel) Add(t time.Time, value, alpha float64) {
+	if m.Count == 0 {
+		m.Mean = value
+	} else {
+		diff := value - m.Mean
+		increment := alpha * diff
+		m.Mean += increment
+		m.Variance = (1 - alpha) * (m.Variance + diff*increment)
+	}
+	m.Count++
+	m.Last = value
+	m.LastTime = t
+}
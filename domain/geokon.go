@@ -0,0 +1,305 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// GeoKonPayload is the payload of the geokonapi data model, every observation carries one value per metric,
+// metric names and units are parallel arrays
+type GeoKonPayload struct {
+	SerialID     string
+	EventUUID    string
+	Metric       []string
+	Unit         []string
+	Observations []Observation
+	Filters      map[string]any
+
+	// Set by the calibration, EngineeringUnit is parallel to Metric
+	EngineeringUnit    []string
+	CalibrationVersion string
+
+	// Set by the unit conversion, the units missing from the canonical vocabulary
+	UnknownUnits []string
+}
+
+// TimestampLayout is the layout of the normalized timestamps, RFC3339 in UTC with millisecond precision
+const TimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// timestampLayouts are the accepted observation timestamps, those without an offset are taken as UTC
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// Observation is a reading of every metric of the payload at a point in time
+type Observation struct {
+	Time  time.Time
+	Value []float64
+
+	// Engineering holds the calibrated values, parallel to Value, nil for the metrics without calibration
+	Engineering []*float64
+
+	// Skew is set by the clock skew check when Time is out of bounds
+	Skew string
+
+	// Sequence is set by the sequence tracking when the observation is out of order or follows a gap
+	Sequence string
+
+	// AnomalyScore holds the z-scores set by the anomaly detection, parallel to Value, nil for the metrics
+	// without a score
+	AnomalyScore []*float64
+}
+
+type geoKonJSON struct {
+	SerialID           string            `json:"serialId"`
+	EventUUID          string            `json:"eventUuid"`
+	Metric             []string          `json:"metric"`
+	Unit               []string          `json:"unit"`
+	EngineeringUnit    []string          `json:"engineeringUnit,omitempty"`
+	CalibrationVersion string            `json:"calibrationVersion,omitempty"`
+	UnknownUnits       []string          `json:"unknownUnits,omitempty"`
+	Observations       []observationJSON `json:"observations"`
+	Filters            map[string]any    `json:"filters,omitempty"`
+}
+
+type observationJSON struct {
+	Time         string     `json:"time"`
+	Value        []*float64 `json:"value"`
+	Engineering  []*float64 `json:"engineering,omitempty"`
+	Skew         string     `json:"skew,omitempty"`
+	Sequence     string     `json:"sequence,omitempty"`
+	AnomalyScore []*float64 `json:"anomalyScore,omitempty"`
+}
+
+// ParseTimestamp parses an observation timestamp and normalizes it to UTC with millisecond precision
+func ParseTimestamp(value string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t.UTC().Truncate(time.Millisecond), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not an RFC3339 timestamp", value)
+}
+
+// ParseGeoKonPayload decodes a geokonapi payload, errors are located by JSON pointer
+func ParseGeoKonPayload(data []byte) (*GeoKonPayload, error) {
+	var (
+		raw  geoKonJSON
+		errs []error
+	)
+
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &GeoKonPayload{
+		SerialID:     raw.SerialID,
+		EventUUID:    raw.EventUUID,
+		Metric:       raw.Metric,
+		Unit:         raw.Unit,
+		Observations: make([]Observation, len(raw.Observations)),
+		Filters:      raw.Filters,
+	}
+	for i, o := range raw.Observations {
+		t, err := ParseTimestamp(o.Time)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("/observations/%d/time: %w", i, err))
+		}
+		values := make([]float64, len(o.Value))
+		for j, v := range o.Value {
+			if v == nil {
+				errs = append(errs, fmt.Errorf("/observations/%d/value/%d: null value", i, j))
+				continue
+			}
+			values[j] = *v
+		}
+		p.Observations[i] = Observation{Time: t, Value: values}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Check verifies that the payload is consistent and belongs to the given device
+func (p *GeoKonPayload) Check(deviceID string) error {
+	var errs []error
+
+	if p.SerialID != deviceID {
+		errs = append(errs, fmt.Errorf("/serialId: %q does not match device_id %q", p.SerialID, deviceID))
+	}
+	if len(p.Metric) == 0 {
+		errs = append(errs, errors.New("/metric: no metric"))
+	}
+	if len(p.Unit) != len(p.Metric) {
+		errs = append(errs, fmt.Errorf("/unit: %d units for %d metrics", len(p.Unit), len(p.Metric)))
+	}
+	for i, o := range p.Observations {
+		if len(o.Value) != len(p.Metric) {
+			errs = append(errs, fmt.Errorf("/observations/%d/value: %d values for %d metrics", i, len(o.Value), len(p.Metric)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Index returns the position of a metric in the value arrays
+func (p *GeoKonPayload) Index(metric string) (int, bool) {
+	for i, m := range p.Metric {
+		if m == metric {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// UnitOf returns the unit of a metric, empty when the metric is unknown
+func (p *GeoKonPayload) UnitOf(metric string) string {
+	i, ok := p.Index(metric)
+	if !ok || i >= len(p.Unit) {
+		return ""
+	}
+	return p.Unit[i]
+}
+
+// Values returns the values of a metric across the observations
+func (p *GeoKonPayload) Values(metric string) []float64 {
+	i, ok := p.Index(metric)
+	if !ok {
+		return nil
+	}
+
+	values := make([]float64, 0, len(p.Observations))
+	for _, o := range p.Observations {
+		if i < len(o.Value) {
+			values = append(values, o.Value[i])
+		}
+	}
+	return values
+}
+
+// Reading returns the value of the metric at index j in an observation with its unit, the engineering value
+// when the metric is calibrated
+func (p *GeoKonPayload) Reading(o Observation, j int) (float64, string, bool) {
+	if j < len(o.Engineering) && o.Engineering[j] != nil {
+		unit := ""
+		if j < len(p.EngineeringUnit) {
+			unit = p.EngineeringUnit[j]
+		}
+		return *o.Engineering[j], unit, true
+	}
+	if j >= len(o.Value) {
+		return 0, "", false
+	}
+	unit := ""
+	if j < len(p.Unit) {
+		unit = p.Unit[j]
+	}
+	return o.Value[j], unit, true
+}
+
+// MarshalJSON encodes the payload in the geokonapi format
+func (p *GeoKonPayload) MarshalJSON() ([]byte, error) {
+	raw := geoKonJSON{
+		SerialID:     p.SerialID,
+		EventUUID:    p.EventUUID,
+		Metric:       p.Metric,
+		Unit:         p.Unit,
+		Observations: make([]observationJSON, len(p.Observations)),
+		Filters:      p.Filters,
+
+		EngineeringUnit:    p.EngineeringUnit,
+		CalibrationVersion: p.CalibrationVersion,
+		UnknownUnits:       p.UnknownUnits,
+	}
+	for i, o := range p.Observations {
+		values := make([]*float64, len(o.Value))
+		for j := range o.Value {
+			values[j] = &o.Value[j]
+		}
+		raw.Observations[i] = observationJSON{Time: o.Time.Format(TimestampLayout), Value: values, Engineering: o.Engineering, Skew: o.Skew, Sequence: o.Sequence, AnomalyScore: o.AnomalyScore}
+	}
+	return json.Marshal(raw)
+}
+
+// Merge encodes the payload over data, the payload it was parsed from. Only the fields whose value changed
+// are replaced, so the fields the model does not know, at the top level and in the observations, are kept
+// and data is returned as is when nothing changed.
+func (p *GeoKonPayload) Merge(data []byte) ([]byte, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	var encoded, raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &encoded); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &raw); err != nil || raw == nil {
+		return b, nil
+	}
+
+	changed := false
+	for key, value := range encoded {
+		if key == "observations" {
+			value, err = mergeObservations(raw[key], value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if old, ok := raw[key]; ok && equalJSON(old, value) {
+			continue
+		}
+		raw[key] = value
+		changed = true
+	}
+	if !changed {
+		return data, nil
+	}
+	return json.Marshal(raw)
+}
+
+// mergeObservations replaces the changed fields of the raw observations, the encoded ones are used as is
+// when they do not line up
+func mergeObservations(data, encoded json.RawMessage) (json.RawMessage, error) {
+	var raw, observations []map[string]json.RawMessage
+	if json.Unmarshal(data, &raw) != nil || len(raw) == 0 {
+		return encoded, nil
+	}
+	if err := json.Unmarshal(encoded, &observations); err != nil {
+		return nil, err
+	}
+	if len(raw) != len(observations) {
+		return encoded, nil
+	}
+
+	for i, o := range observations {
+		if raw[i] == nil {
+			raw[i] = o
+			continue
+		}
+		for key, value := range o {
+			if old, ok := raw[i][key]; ok && equalJSON(old, value) {
+				continue
+			}
+			raw[i][key] = value
+		}
+	}
+	return json.Marshal(raw)
+}
+
+// equalJSON reports whether two JSON values are the same once decoded, whatever their formatting
+func equalJSON(a, b json.RawMessage) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,128 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		err   bool
+	}{
+		{value: "2024-05-01T10:00:00Z", want: "2024-05-01T10:00:00.000Z"},
+		{value: "2024-05-01T12:00:00.123456+02:00", want: "2024-05-01T10:00:00.123Z"},
+		{value: "2024-05-01T10:00:00.5", want: "2024-05-01T10:00:00.500Z"},
+		{value: "2024-05-01 10:00:00", want: "2024-05-01T10:00:00.000Z"},
+		{value: "2024-05-01 10:00:00-05:00", want: "2024-05-01T15:00:00.000Z"},
+		{value: "01/05/2024", err: true},
+		{value: "", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTimestamp(tt.value)
+			if tt.err {
+				if err == nil {
+					t.Errorf("ParseTimestamp(%q) = %s, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTimestamp(%q): %v", tt.value, err)
+			}
+			if s := got.Format(TimestampLayout); s != tt.want {
+				t.Errorf("ParseTimestamp(%q) = %s, want %s", tt.value, s, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		change func(p *GeoKonPayload)
+		want   string
+	}{
+		{
+			name: "unchanged payload kept as received",
+			data: `{"serialId":"d1", "eventUuid":"e1","metric":["t"],"unit":["C"],"observations":[{"time":"2024-05-01T10:00:00.000Z","value":[1.50]}]}`,
+			want: `{"serialId":"d1", "eventUuid":"e1","metric":["t"],"unit":["C"],"observations":[{"time":"2024-05-01T10:00:00.000Z","value":[1.50]}]}`,
+		},
+		{
+			name: "unknown fields kept",
+			data: `{"serialId":"d1","eventUuid":"e1","metric":["t"],"unit":["C"],"battery":3.1,"observations":[{"time":"2024-05-01T10:00:00Z","value":[1],"quality":"good"}]}`,
+			want: `{"battery":3.1,"eventUuid":"e1","metric":["t"],"observations":[{"quality":"good","time":"2024-05-01T10:00:00.000Z","value":[1]}],"serialId":"d1","unit":["C"]}`,
+		},
+		{
+			name: "stage changes merged",
+			data: `{"serialId":"d1","eventUuid":"e1","metric":["t"],"unit":["C"],"observations":[{"time":"2024-05-01T10:00:00.000Z","value":[1],"quality":"good"}]}`,
+			change: func(p *GeoKonPayload) {
+				p.Observations[0].Skew = SkewFuture
+				p.Observations[0].Sequence = SequenceGap
+			},
+			want: `{"eventUuid":"e1","metric":["t"],"observations":[{"quality":"good","sequence":"gap","skew":"future","time":"2024-05-01T10:00:00.000Z","value":[1]}],"serialId":"d1","unit":["C"]}`,
+		},
+		{
+			name: "converted values replaced",
+			data: `{"serialId":"d1","eventUuid":"e1","metric":["t"],"unit":["F"],"observations":[{"time":"2024-05-01T10:00:00.000Z","value":[212]}]}`,
+			change: func(p *GeoKonPayload) {
+				p.Unit[0] = "C"
+				p.Observations[0].Value[0] = 100
+			},
+			want: `{"eventUuid":"e1","metric":["t"],"observations":[{"time":"2024-05-01T10:00:00.000Z","value":[100]}],"serialId":"d1","unit":["C"]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseGeoKonPayload([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.change != nil {
+				tt.change(p)
+			}
+
+			got, err := p.Merge([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Merge =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncPayload(t *testing.T) {
+	data := `{"serialId":"d1","eventUuid":"e1","metric":["t"],"unit":["C"],"observations":[{"time":"2024-05-01T10:00:00.000Z","value":[1]}],"extra":{"a":1}}`
+	msg := EnrichedMessage{DeviceID: "d1", Data: json.RawMessage(data)}
+	if err := msg.ParseGeoKonPayload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.SyncPayload(); err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Data) != data {
+		t.Errorf("SyncPayload changed an unchanged payload to %s", msg.Data)
+	}
+
+	msg.GeoKon.Observations[0].Time = msg.GeoKon.Observations[0].Time.Add(time.Second)
+	if err := msg.SyncPayload(); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Extra        map[string]int `json:"extra"`
+		Observations []struct {
+			Time string `json:"time"`
+		} `json:"observations"`
+	}
+	if err := json.Unmarshal(msg.Data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Extra["a"] != 1 || got.Observations[0].Time != "2024-05-01T10:00:01.000Z" {
+		t.Errorf("SyncPayload = %s", msg.Data)
+	}
+}
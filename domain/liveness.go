@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// Device status events
+const (
+	DeviceStale     = "stale"
+	DeviceRecovered = "recovered"
+)
+
+// DeviceStatus is published when a device stops reporting within its expected interval and when it reports
+// again, LastSeen is the time of its last report before the event
+type DeviceStatus struct {
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	DeviceID string    `json:"deviceId"`
+	SiteCode string    `json:"siteCode"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// SilentDevice is a device that missed its expected reports
+type SilentDevice struct {
+	DeviceID string    `json:"deviceId"`
+	LastSeen time.Time `json:"lastSeen"`
+}
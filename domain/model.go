@@ -3,6 +3,7 @@ package domain
 import (
 	"encoding/json"
 	"errors"
+	"time"
 )
 
 type Message struct {
@@ -16,8 +17,21 @@ type EnrichedMessage struct {
 	DeviceID    string          `json:"device_id"`
 	SiteCode    string          `json:"site_code"`
 	Data        json.RawMessage `json:"data"`
-	RegistryRaw json.RawMessage `json:"registry"`
+	RegistryRaw json.RawMessage `json:"registry,omitempty"`
 	DataModel   string
+	GeoKon      *GeoKonPayload             `json:"-"`
+	Fields      map[string]json.RawMessage `json:"-"`
+
+	// IngestTime is when the enricher received the message and LatencyMs how long it took to process it, up to
+	// the encoding of the published message, the encoding and the publish itself are not included
+	IngestTime time.Time `json:"ingest_time,omitzero"`
+	LatencyMs  float64   `json:"latency_ms,omitempty"`
+
+	// Gaps are the gaps in the observations of the device found by the sequence tracking
+	Gaps []Gap `json:"-"`
+
+	// OmitRegistry leaves the registry out of the published message while keeping it readable
+	OmitRegistry bool `json:"-"`
 }
 
 func (e *EnrichedMessage) UnmarshalJSON(data []byte) error {
@@ -88,8 +102,44 @@ func (e *EnrichedMessage) getDataModel() error {
 }
 
 func (e *EnrichedMessage) Byte() ([]byte, error) {
+	if e.OmitRegistry {
+		published := *e
+		published.RegistryRaw = nil
+		e = &published
+	}
 	b, err := json.Marshal(e)
-	return b, err
+	if err != nil || len(e.Fields) == 0 {
+		return b, err
+	}
+	return appendFields(b, e.Fields)
+}
+
+// ParseGeoKonPayload decodes the geokonapi payload of the message and checks it belongs to the device
+func (e *EnrichedMessage) ParseGeoKonPayload() error {
+	payload, err := ParseGeoKonPayload(e.Data)
+	if err != nil {
+		return err
+	}
+	err = payload.Check(e.DeviceID)
+	if err != nil {
+		return err
+	}
+	e.GeoKon = payload
+	return nil
+}
+
+// SyncPayload merges the parsed payload back into Data after it was changed, Data is left as received
+// when no field changed
+func (e *EnrichedMessage) SyncPayload() error {
+	if e.GeoKon == nil {
+		return nil
+	}
+	b, err := e.GeoKon.Merge(e.Data)
+	if err != nil {
+		return err
+	}
+	e.Data = b
+	return nil
 }
 
 func (e *EnrichedMessage) IsGeoKonAPIDataModel() bool {
@@ -0,0 +1,70 @@
+package domain
+
+import "time"
+
+// MetricRecord is a single metric value of an observation, flattened out of the parallel arrays of the payload
+type MetricRecord struct {
+	Time     time.Time `json:"time"`
+	Metric   string    `json:"metric"`
+	Unit     string    `json:"unit"`
+	Value    float64   `json:"value"`
+	SiteCode string    `json:"siteCode"`
+	DeviceID string    `json:"deviceId"`
+
+	EngineeringValue   *float64 `json:"engineeringValue,omitempty"`
+	EngineeringUnit    string   `json:"engineeringUnit,omitempty"`
+	CalibrationVersion string   `json:"calibrationVersion,omitempty"`
+	Skew               string   `json:"skew,omitempty"`
+	Sequence           string   `json:"sequence,omitempty"`
+	AnomalyScore       *float64 `json:"anomalyScore,omitempty"`
+}
+
+// MetricRecords flattens every observation of the payload, it returns nil when the payload is not parsed
+func (e *EnrichedMessage) MetricRecords() []MetricRecord {
+	if e.GeoKon == nil {
+		return nil
+	}
+
+	records := make([]MetricRecord, 0, len(e.GeoKon.Observations)*len(e.GeoKon.Metric))
+	for i := range e.GeoKon.Observations {
+		records = append(records, e.ObservationRecords(i)...)
+	}
+	return records
+}
+
+// ObservationRecords flattens the i-th observation of the payload
+func (e *EnrichedMessage) ObservationRecords(i int) []MetricRecord {
+	if e.GeoKon == nil || i < 0 || i >= len(e.GeoKon.Observations) {
+		return nil
+	}
+
+	o := e.GeoKon.Observations[i]
+	records := make([]MetricRecord, 0, len(o.Value))
+	for j, value := range o.Value {
+		if j >= len(e.GeoKon.Metric) {
+			break
+		}
+		record := MetricRecord{
+			Time:     o.Time,
+			Metric:   e.GeoKon.Metric[j],
+			Unit:     e.GeoKon.UnitOf(e.GeoKon.Metric[j]),
+			Value:    value,
+			SiteCode: e.SiteCode,
+			DeviceID: e.DeviceID,
+			Skew:     o.Skew,
+			Sequence: o.Sequence,
+		}
+		if j < len(o.AnomalyScore) {
+			record.AnomalyScore = o.AnomalyScore[j]
+		}
+		if j < len(o.Engineering) && o.Engineering[j] != nil {
+			record.EngineeringValue = o.Engineering[j]
+			record.CalibrationVersion = e.GeoKon.CalibrationVersion
+			if j < len(e.GeoKon.EngineeringUnit) {
+				record.EngineeringUnit = e.GeoKon.EngineeringUnit[j]
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReservedFields are the top-level fields of the enriched message that a projection cannot replace
+var ReservedFields = []string{"source_topic", "device_id", "site_code", "data", "registry", "DataModel", "ingest_time", "latency_ms"}
+
+// RegistryValue returns the registry value at a dot separated path such as location.lat or sensors.0.name,
+// array elements are addressed by index
+func (e *EnrichedMessage) RegistryValue(path string) (json.RawMessage, bool) {
+	current := json.RawMessage(e.RegistryRaw)
+
+	for _, key := range strings.Split(path, ".") {
+		var object map[string]json.RawMessage
+		if json.Unmarshal(current, &object) == nil {
+			value, ok := object[key]
+			if !ok {
+				return nil, false
+			}
+			current = value
+			continue
+		}
+
+		var array []json.RawMessage
+		if json.Unmarshal(current, &array) != nil {
+			return nil, false
+		}
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(array) {
+			return nil, false
+		}
+		current = array[i]
+	}
+	return current, true
+}
+
+// Project copies the registry values at the given paths into top-level fields, keyed by field name,
+// paths missing from the registry are skipped and returned
+func (e *EnrichedMessage) Project(fields map[string]string) (missing []string) {
+	for name, path := range fields {
+		value, ok := e.RegistryValue(path)
+		if !ok {
+			missing = append(missing, path)
+			continue
+		}
+		if e.Fields == nil {
+			e.Fields = make(map[string]json.RawMessage, len(fields))
+		}
+		e.Fields[name] = value
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// appendFields adds the projected fields, sorted by name, to an encoded JSON object
+func appendFields(b []byte, fields map[string]json.RawMessage) ([]byte, error) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.Write(bytes.TrimSuffix(bytes.TrimSpace(b), []byte("}")))
+	for _, name := range names {
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(fields[name])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+const testRegistry = `{"siteCode":"s1","location":{"lat":1.5},"sensors":[{"name":"a"},{"name":"b"}]}`
+
+func TestRegistryValue(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{path: "siteCode", want: `"s1"`, ok: true},
+		{path: "location.lat", want: `1.5`, ok: true},
+		{path: "sensors.1.name", want: `"b"`, ok: true},
+		{path: "sensors.2.name"},
+		{path: "sensors.x"},
+		{path: "location.lon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			msg := EnrichedMessage{RegistryRaw: json.RawMessage(testRegistry)}
+			got, ok := msg.RegistryValue(tt.path)
+			if ok != tt.ok || string(got) != tt.want {
+				t.Errorf("RegistryValue(%s) = %s, %t, want %s, %t", tt.path, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestProjectedFieldsDoNotShadowReservedFields(t *testing.T) {
+	msg := EnrichedMessage{
+		DeviceID:    "d1",
+		RegistryRaw: json.RawMessage(testRegistry),
+		IngestTime:  time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		LatencyMs:   1.5,
+	}
+	missing := msg.Project(map[string]string{"lat": "location.lat", "lon": "location.lon"})
+	if !slices.Equal(missing, []string{"location.lon"}) {
+		t.Errorf("Project missing %v, want [location.lon]", missing)
+	}
+
+	b, err := msg.Byte()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatalf("Byte = %s: %v", b, err)
+	}
+	if string(fields["lat"]) != "1.5" {
+		t.Errorf("projected lat = %s, want 1.5", fields["lat"])
+	}
+	for _, name := range ReservedFields {
+		if name == "registry" || name == "data" {
+			continue
+		}
+		if _, ok := fields[name]; !ok {
+			t.Errorf("reserved field %s missing from the enriched message %s", name, b)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+// Sequence flags of an observation
+const (
+	SequenceOutOfOrder = "out_of_order"
+	SequenceGap        = "gap"
+)
+
+// Gap is published when the observations of a device resume after missing reports, From is the last
+// observation before the gap and To the first one after it
+type Gap struct {
+	DeviceID        string    `json:"deviceId"`
+	SiteCode        string    `json:"siteCode"`
+	From            time.Time `json:"from"`
+	To              time.Time `json:"to"`
+	GapSeconds      float64   `json:"gapSeconds"`
+	IntervalSeconds float64   `json:"intervalSeconds"`
+	MissedReports   int       `json:"missedReports"`
+}
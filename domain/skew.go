@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+// Skew of an observation timestamp relative to the ingest time
+const (
+	SkewFuture = "future"
+	SkewPast   = "past"
+)
+
+// SkewedDevice counts the readings of a device whose timestamps were out of bounds, LastSkewMs is the largest
+// skew of its last skewed message, positive ahead of the ingest time
+type SkewedDevice struct {
+	DeviceID   string    `json:"deviceId"`
+	SiteCode   string    `json:"siteCode"`
+	Readings   int       `json:"readings"`
+	LastSkewMs int64     `json:"lastSkewMs"`
+	LastSeen   time.Time `json:"lastSeen"`
+}
@@ -0,0 +1,59 @@
+package domain
+
+import "time"
+
+// SiteSummary is the periodic state of a site, Messages counts the messages of the site received over
+// [PeriodStart, PeriodEnd) and Errors those that failed, MessageRate is per second and ErrorRate the share
+// of the messages that failed
+type SiteSummary struct {
+	SiteCode      string                  `json:"siteCode"`
+	PeriodStart   time.Time               `json:"periodStart"`
+	PeriodEnd     time.Time               `json:"periodEnd"`
+	ActiveDevices int                     `json:"activeDevices"`
+	Messages      int                     `json:"messages"`
+	Errors        int                     `json:"errors"`
+	MessageRate   float64                 `json:"messageRate"`
+	ErrorRate     float64                 `json:"errorRate"`
+	Devices       map[string]DeviceLatest `json:"devices"`
+}
+
+// DeviceLatest is the last observation received from a device, Values and Units are keyed by metric
+type DeviceLatest struct {
+	LastSeen time.Time          `json:"lastSeen"`
+	Time     time.Time          `json:"time"`
+	Values   map[string]float64 `json:"values"`
+	Units    map[string]string  `json:"units"`
+}
+
+// Latest returns the last observation of the payload, by time, with the engineering values of the calibrated
+// metrics, false when there is no observation with a trusted timestamp
+func (p *GeoKonPayload) Latest() (DeviceLatest, bool) {
+	var latest DeviceLatest
+
+	last := -1
+	for i, o := range p.Observations {
+		if o.Skew != "" {
+			continue
+		}
+		if last < 0 || !o.Time.Before(p.Observations[last].Time) {
+			last = i
+		}
+	}
+	if last < 0 {
+		return latest, false
+	}
+
+	o := p.Observations[last]
+	latest.Time = o.Time
+	latest.Values = make(map[string]float64, len(p.Metric))
+	latest.Units = make(map[string]string, len(p.Metric))
+	for j, metric := range p.Metric {
+		value, unit, ok := p.Reading(o, j)
+		if !ok {
+			continue
+		}
+		latest.Values[metric] = value
+		latest.Units[metric] = unit
+	}
+	return latest, true
+}
@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatest(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	engineering := 42.0
+
+	tests := []struct {
+		name         string
+		observations []Observation
+		want         time.Time
+		wantValues   map[string]float64
+		wantUnits    map[string]string
+		wantNone     bool
+	}{
+		{
+			name:     "no observation",
+			wantNone: true,
+		},
+		{
+			name: "last by time",
+			observations: []Observation{
+				{Time: start.Add(2 * time.Minute), Value: []float64{2, 20}},
+				{Time: start, Value: []float64{1, 10}},
+			},
+			want:       start.Add(2 * time.Minute),
+			wantValues: map[string]float64{"strain": 2, "temp": 20},
+			wantUnits:  map[string]string{"strain": "digits", "temp": "Cel"},
+		},
+		{
+			name: "engineering value of a calibrated metric",
+			observations: []Observation{
+				{Time: start, Value: []float64{1, 10}, Engineering: []*float64{&engineering, nil}},
+			},
+			want:       start,
+			wantValues: map[string]float64{"strain": 42, "temp": 10},
+			wantUnits:  map[string]string{"strain": "ue", "temp": "Cel"},
+		},
+		{
+			name: "skewed observation skipped",
+			observations: []Observation{
+				{Time: start.Add(time.Hour), Value: []float64{9, 90}, Skew: "future"},
+				{Time: start, Value: []float64{1, 10}},
+			},
+			want:       start,
+			wantValues: map[string]float64{"strain": 1, "temp": 10},
+			wantUnits:  map[string]string{"strain": "digits", "temp": "Cel"},
+		},
+		{
+			name:         "only skewed observations",
+			observations: []Observation{{Time: start, Value: []float64{1, 10}, Skew: "past"}},
+			wantNone:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := &GeoKonPayload{
+				Metric:          []string{"strain", "temp"},
+				Unit:            []string{"digits", "Cel"},
+				EngineeringUnit: []string{"ue", ""},
+				Observations:    tt.observations,
+			}
+			latest, ok := payload.Latest()
+			if ok == tt.wantNone {
+				t.Fatalf("Latest found = %t, want %t", ok, !tt.wantNone)
+			}
+			if tt.wantNone {
+				return
+			}
+			if !latest.Time.Equal(tt.want) {
+				t.Errorf("time = %v, want %v", latest.Time, tt.want)
+			}
+			for metric, want := range tt.wantValues {
+				if latest.Values[metric] != want || latest.Units[metric] != tt.wantUnits[metric] {
+					t.Errorf("%s = %g %s, want %g %s", metric, latest.Values[metric], latest.Units[metric], want, tt.wantUnits[metric])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UnitSystem is the system the values of a site or data model are published in
+type UnitSystem string
+
+const (
+	UnitSystemMetric   UnitSystem = "metric"
+	UnitSystemImperial UnitSystem = "imperial"
+)
+
+// ParseUnitSystem checks a unit system name, empty means the units are only normalized
+func ParseUnitSystem(system string) (UnitSystem, error) {
+	switch UnitSystem(strings.ToLower(system)) {
+	case "":
+		return "", nil
+	case UnitSystemMetric:
+		return UnitSystemMetric, nil
+	case UnitSystemImperial:
+		return UnitSystemImperial, nil
+	default:
+		return "", fmt.Errorf("unknown unit system %q, expected metric or imperial", system)
+	}
+}
+
+// Unit is a unit of the canonical vocabulary, named by its UCUM code
+type Unit struct {
+	Code      string
+	Dimension string
+	System    UnitSystem
+
+	// value in the base unit of the dimension = value * factor + offset
+	factor float64
+	offset float64
+	// counterpart is the code of the closest unit in the other system
+	counterpart string
+}
+
+var units = map[string]Unit{}
+
+// unitAliases maps the lower case free-form names found in payloads to UCUM codes
+var unitAliases = map[string]string{}
+
+func init() {
+	for _, u := range []struct {
+		Unit
+		aliases []string
+	}{
+		{Unit{"m", "length", UnitSystemMetric, 1, 0, "[ft_i]"}, []string{"meter", "meters", "metre", "metres"}},
+		{Unit{"mm", "length", UnitSystemMetric, 0.001, 0, "[in_i]"}, []string{"millimeter", "millimeters", "millimetre", "millimetres"}},
+		{Unit{"cm", "length", UnitSystemMetric, 0.01, 0, "[in_i]"}, []string{"centimeter", "centimeters", "centimetre", "centimetres"}},
+		{Unit{"km", "length", UnitSystemMetric, 1000, 0, "[mi_i]"}, []string{"kilometer", "kilometers", "kilometre", "kilometres"}},
+		{Unit{"[in_i]", "length", UnitSystemImperial, 0.0254, 0, "mm"}, []string{"in", "inch", "inches"}},
+		{Unit{"[ft_i]", "length", UnitSystemImperial, 0.3048, 0, "m"}, []string{"ft", "foot", "feet"}},
+		{Unit{"[mi_i]", "length", UnitSystemImperial, 1609.344, 0, "km"}, []string{"mi", "mile", "miles"}},
+		{Unit{"Cel", "temperature", UnitSystemMetric, 1, 273.15, "[degF]"}, []string{"c", "°c", "degc", "celsius"}},
+		{Unit{"K", "temperature", UnitSystemMetric, 1, 0, "[degF]"}, []string{"kelvin"}},
+		{Unit{"[degF]", "temperature", UnitSystemImperial, 5.0 / 9, 273.15 - 32*5.0/9, "Cel"}, []string{"f", "°f", "degf", "fahrenheit"}},
+		{Unit{"Pa", "pressure", UnitSystemMetric, 1, 0, "[psi]"}, []string{"pascal", "pascals"}},
+		{Unit{"kPa", "pressure", UnitSystemMetric, 1000, 0, "[psi]"}, []string{"kilopascal", "kilopascals"}},
+		{Unit{"MPa", "pressure", UnitSystemMetric, 1e6, 0, "[psi]"}, []string{"megapascal", "megapascals"}},
+		{Unit{"bar", "pressure", UnitSystemMetric, 1e5, 0, "[psi]"}, []string{"bars"}},
+		{Unit{"[psi]", "pressure", UnitSystemImperial, 6894.757293168, 0, "kPa"}, []string{"psi"}},
+		{Unit{"kg", "mass", UnitSystemMetric, 1, 0, "[lb_av]"}, []string{"kilogram", "kilograms"}},
+		{Unit{"[lb_av]", "mass", UnitSystemImperial, 0.45359237, 0, "kg"}, []string{"lb", "lbs", "pound", "pounds"}},
+		{Unit{"L", "volume", UnitSystemMetric, 0.001, 0, "[gal_us]"}, []string{"l", "liter", "liters", "litre", "litres"}},
+		{Unit{"[gal_us]", "volume", UnitSystemImperial, 0.003785411784, 0, "L"}, []string{"gal", "gallon", "gallons"}},
+		{Unit{"V", "voltage", "", 1, 0, ""}, []string{"volt", "volts"}},
+		{Unit{"mV", "voltage", "", 0.001, 0, ""}, []string{"millivolt", "millivolts"}},
+		{Unit{"Hz", "frequency", "", 1, 0, ""}, []string{"hertz"}},
+		{Unit{"s", "time", "", 1, 0, ""}, []string{"sec", "second", "seconds"}},
+		{Unit{"deg", "angle", "", 1, 0, ""}, []string{"degree", "degrees", "°"}},
+		{Unit{"%", "ratio", "", 1, 0, ""}, []string{"percent"}},
+		{Unit{"{count}", "count", "", 1, 0, ""}, []string{"count", "counts", "digit", "digits"}},
+	} {
+		units[u.Code] = u.Unit
+		unitAliases[strings.ToLower(u.Code)] = u.Code
+		for _, alias := range u.aliases {
+			unitAliases[alias] = u.Code
+		}
+	}
+}
+
+// NormalizeUnit returns the canonical unit of a free-form unit name
+func NormalizeUnit(name string) (Unit, bool) {
+	name = strings.TrimSpace(name)
+	if u, ok := units[name]; ok {
+		return u, true
+	}
+	code, ok := unitAliases[strings.ToLower(name)]
+	if !ok {
+		return Unit{}, false
+	}
+	return units[code], true
+}
+
+// In returns the unit values are converted to for the given system, the unit itself when it already
+// belongs to the system or has no system
+func (u Unit) In(system UnitSystem) Unit {
+	if system == "" || u.System == "" || u.System == system || u.counterpart == "" {
+		return u
+	}
+	return units[u.counterpart]
+}
+
+// Convert converts a value from unit u to unit to
+func (u Unit) Convert(value float64, to Unit) (float64, error) {
+	if u.Dimension != to.Dimension {
+		return 0, fmt.Errorf("cannot convert %s to %s", u.Code, to.Code)
+	}
+	if u.Code == to.Code {
+		return value, nil
+	}
+	return (value*u.factor + u.offset - to.offset) / to.factor, nil
+}
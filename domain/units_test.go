@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalizeUnit(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Cel", want: "Cel"},
+		{name: " °C ", want: "Cel"},
+		{name: "Celsius", want: "Cel"},
+		{name: "KPA", want: "kPa"},
+		{name: "kPa", want: "kPa"},
+		{name: "MPa", want: "MPa"},
+		{name: "feet", want: "[ft_i]"},
+		{name: "[psi]", want: "[psi]"},
+		{name: "digits", want: "{count}"},
+		{name: "furlong"},
+		{name: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, ok := NormalizeUnit(tt.name)
+			if ok != (tt.want != "") || u.Code != tt.want {
+				t.Errorf("NormalizeUnit = %q, %t, want %q", u.Code, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnitConvert(t *testing.T) {
+	tests := []struct {
+		from   string
+		system UnitSystem
+		value  float64
+		wantTo string
+		want   float64
+	}{
+		{from: "Cel", system: UnitSystemImperial, value: 100, wantTo: "[degF]", want: 212},
+		{from: "[degF]", system: UnitSystemMetric, value: 32, wantTo: "Cel", want: 0},
+		{from: "K", system: UnitSystemImperial, value: 273.15, wantTo: "[degF]", want: 32},
+		{from: "m", system: UnitSystemImperial, value: 0.3048, wantTo: "[ft_i]", want: 1},
+		{from: "[psi]", system: UnitSystemMetric, value: 1, wantTo: "kPa", want: 6.894757293168},
+		{from: "kPa", system: UnitSystemMetric, value: 5, wantTo: "kPa", want: 5},
+		{from: "V", system: UnitSystemImperial, value: 3.6, wantTo: "V", want: 3.6},
+		{from: "kPa", system: "", value: 5, wantTo: "kPa", want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" "+string(tt.system), func(t *testing.T) {
+			from, _ := NormalizeUnit(tt.from)
+			to := from.In(tt.system)
+			if to.Code != tt.wantTo {
+				t.Fatalf("In = %s, want %s", to.Code, tt.wantTo)
+			}
+			got, err := from.Convert(tt.value, to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Convert = %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnitConvertDimension(t *testing.T) {
+	from, _ := NormalizeUnit("Cel")
+	to, _ := NormalizeUnit("kPa")
+	if _, err := from.Convert(1, to); err == nil {
+		t.Error("Convert across dimensions did not fail")
+	}
+}
+
+func TestParseUnitSystem(t *testing.T) {
+	tests := []struct {
+		system  string
+		want    UnitSystem
+		wantErr bool
+	}{
+		{system: "", want: ""},
+		{system: "metric", want: UnitSystemMetric},
+		{system: "Imperial", want: UnitSystemImperial},
+		{system: "si", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.system, func(t *testing.T) {
+			got, err := ParseUnitSystem(tt.system)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseUnitSystem = %q, %v, want %q, error %t", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,44 +1,582 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
+// Config is the effective configuration, merged from defaults, environment, config file and CLI flags
+// in increasing order of precedence
 type Config struct {
-	Host                  string
-	Port                  int
-	LogLevel              string
-	SubscriptionTopic     string
-	PublishTopicBase      string
-	User                  string
-	Password              string
-	LogFilePath           string
-	RedisConnectionString string
-	DynatraceEnabled      bool
-}
-
-func Load() *Config {
-	port, _ := strconv.Atoi(getEnvOrDefault("PORT", "8883"))
-	dynatraceEnabled, _ := strconv.ParseBool(getEnvOrDefault("DYNATRACE_ENABLED", "false"))
+	Host                  string        `yaml:"host"`
+	Port                  int           `yaml:"port"`
+	LogLevel              string        `yaml:"log_level"`
+	SubscriptionTopic     string        `yaml:"subscription_topic"`
+	MQTTConnectTimeout    time.Duration `yaml:"mqtt_connect_timeout"`
+	MQTTRetryInitial      time.Duration `yaml:"mqtt_retry_initial_interval"`
+	MQTTRetryMax          time.Duration `yaml:"mqtt_retry_max_interval"`
+	MQTTStartupPolicy     string        `yaml:"mqtt_startup_policy"`
+	MQTTStartupTimeout    time.Duration `yaml:"mqtt_startup_timeout"`
+	MQTTPublishTimeout    time.Duration `yaml:"mqtt_publish_timeout"`
+	PublishTopicBase      string        `yaml:"publish_topic_base"`
+	PublishTopicTemplate  string        `yaml:"publish_topic_template"`
+	User                  string        `yaml:"user"`
+	Password              Secret        `yaml:"password"`
+	LogFilePath           string        `yaml:"log_file_path"`
+	RedisConnectionString SecretURL     `yaml:"redis_connection_string"`
+	DynatraceEnabled      bool          `yaml:"dynatrace_enabled"`
+	DynatraceIngestURL    string        `yaml:"dynatrace_ingest_url"`
+	DynatraceAPIToken     Secret        `yaml:"dynatrace_api_token"`
+	DynatraceFlushPeriod  time.Duration `yaml:"dynatrace_flush_period"`
+	RegistryCacheTTL      time.Duration `yaml:"registry_cache_ttl"`
+	AdminAddr             string        `yaml:"admin_addr"`
+	SchemaAddr            string        `yaml:"schema_addr"`
+	AdminToken            Secret        `yaml:"admin_token"`
+	ConfigWatchInterval   time.Duration `yaml:"config_watch_interval"`
+	ShutdownTimeout       time.Duration `yaml:"shutdown_timeout"`
+	OutboxDir             string        `yaml:"outbox_dir"`
+	OutboxMaxBytes        int64         `yaml:"outbox_max_bytes"`
+	OutboxMaxAge          time.Duration `yaml:"outbox_max_age"`
+	OutboxSegmentBytes    int64         `yaml:"outbox_segment_bytes"`
+	SchemaSource          string        `yaml:"schema_source"`
+	SchemaDir             string        `yaml:"schema_dir"`
+	SchemaDefaultMode     string        `yaml:"schema_default_mode"`
+	SchemaModes           KeyValues     `yaml:"schema_modes"`
+	DeadLetterTopic       string        `yaml:"dead_letter_topic"`
+	OutputShape           string        `yaml:"output_shape"`
+	OutputShapes          KeyValues     `yaml:"output_shapes"`
+	RegistryFields        KeyValues     `yaml:"registry_fields"`
+	RegistryOmitRaw       bool          `yaml:"registry_omit_raw"`
+	CalibrationEnabled    bool          `yaml:"calibration_enabled"`
+	CalibrationPath       string        `yaml:"calibration_path"`
+	UnitConversion        bool          `yaml:"unit_conversion"`
+	UnknownUnits          string        `yaml:"unknown_units"`
+	ClockSkew             string        `yaml:"clock_skew"`
+	ClockSkewMaxFuture    time.Duration `yaml:"clock_skew_max_future"`
+	ClockSkewMaxPast      time.Duration `yaml:"clock_skew_max_past"`
+	Encodings             KeyValues     `yaml:"encodings"`
+	AvroSchemaID          int           `yaml:"avro_schema_id"`
+	Compression           string        `yaml:"compression"`
+	CompressionThreshold  int           `yaml:"compression_threshold"`
+	Dedup                 string        `yaml:"dedup"`
+	DedupWindow           time.Duration `yaml:"dedup_window"`
+	DedupCapacity         int           `yaml:"dedup_capacity"`
+	Sequence              string        `yaml:"sequence"`
+	SequenceIntervalPath  string        `yaml:"sequence_interval_path"`
+	SequenceInterval      time.Duration `yaml:"sequence_default_interval"`
+	SequenceMissed        int           `yaml:"sequence_missed_reports"`
+	GapTopic              string        `yaml:"gap_topic"`
+	AlertTopic            string        `yaml:"alert_topic"`
+	AlertThresholdsPath   string        `yaml:"alert_thresholds_path"`
+	AlertState            string        `yaml:"alert_state"`
+	LivenessTopic         string        `yaml:"liveness_topic"`
+	LivenessIntervalPath  string        `yaml:"liveness_interval_path"`
+	LivenessInterval      time.Duration `yaml:"liveness_default_interval"`
+	LivenessMissed        int           `yaml:"liveness_missed_reports"`
+	LivenessCheck         time.Duration `yaml:"liveness_check_interval"`
+	AnomalyDetection      bool          `yaml:"anomaly_detection"`
+	AnomalyTopic          string        `yaml:"anomaly_topic_template"`
+	AnomalyLimitsPath     string        `yaml:"anomaly_limits_path"`
+	AnomalyAlpha          float64       `yaml:"anomaly_alpha"`
+	AnomalyZScore         float64       `yaml:"anomaly_zscore"`
+	AnomalyWarmup         int           `yaml:"anomaly_warmup"`
+	AnomalyCheckpoint     time.Duration `yaml:"anomaly_checkpoint_interval"`
+	AggregateWindows      Durations     `yaml:"aggregate_windows"`
+	AggregateTopic        string        `yaml:"aggregate_topic_template"`
+	AggregateLateness     time.Duration `yaml:"aggregate_allowed_lateness"`
+	SummaryInterval       time.Duration `yaml:"summary_interval"`
+	SummaryTopic          string        `yaml:"summary_topic_template"`
+	SummaryActiveWindow   time.Duration `yaml:"summary_active_window"`
+	RulesSource           string        `yaml:"rules_source"`
+	RulesFile             string        `yaml:"rules_file"`
+	BatchEnabled          bool          `yaml:"batch_enabled"`
+	BatchTopicTemplate    string        `yaml:"batch_topic_template"`
+	BatchMaxCount         int           `yaml:"batch_max_count"`
+	BatchMaxBytes         int           `yaml:"batch_max_bytes"`
+	BatchMaxLatency       time.Duration `yaml:"batch_max_latency"`
+
+	// File is the config file the configuration was loaded from, if any
+	File string `yaml:"-"`
+}
 
+// Default returns the configuration used when nothing else is set
+func Default() *Config {
 	return &Config{
-		Host:                  getEnvOrDefault("HOST", "backend.christophe.engineering"),
-		Port:                  port,
-		LogLevel:              getEnvOrDefault("LOG_LEVEL", "debug"),
-		SubscriptionTopic:     getEnvOrDefault("SUBSCRIPTION_TOPIC", "FCTS/INGRESS/ENRICH"),
-		PublishTopicBase:      getEnvOrDefault("PUBLISH_TOPIC_BASE", "FCTS/ENRICHED/geokonapi"),
-		User:                  getEnvOrDefault("USER", ""),
-		Password:              getEnvOrDefault("PASSWORD", ""),
-		LogFilePath:           getEnvOrDefault("LOG_FILE_PATH", "logs"),
-		RedisConnectionString: getEnvOrDefault("REDIS_CONNECTION_STRING", "redis://localhost:6379"),
-		DynatraceEnabled:      dynatraceEnabled,
+		Host:                  "localhost",
+		Port:                  8883,
+		LogLevel:              "info",
+		SubscriptionTopic:     "FCTS/INGRESS/ENRICH",
+		MQTTConnectTimeout:    30 * time.Second,
+		MQTTRetryInitial:      time.Second,
+		MQTTRetryMax:          time.Minute,
+		MQTTStartupPolicy:     "wait",
+		MQTTStartupTimeout:    2 * time.Minute,
+		MQTTPublishTimeout:    10 * time.Second,
+		PublishTopicBase:      "FCTS/ENRICHED/geokonapi",
+		PublishTopicTemplate:  "{base}/{siteCode}/{deviceId}",
+		LogFilePath:           "logs",
+		RedisConnectionString: "redis://localhost:6379",
+		RegistryCacheTTL:      time.Minute,
+		ConfigWatchInterval:   10 * time.Second,
+		ShutdownTimeout:       30 * time.Second,
+		OutboxMaxBytes:        256 << 20,
+		OutboxMaxAge:          24 * time.Hour,
+		OutboxSegmentBytes:    16 << 20,
+		DynatraceFlushPeriod:  30 * time.Second,
+		SchemaDefaultMode:     "strict",
+		OutputShape:           "enriched",
+		CalibrationPath:       "calibration",
+		UnknownUnits:          "flag",
+		ClockSkew:             "flag",
+		ClockSkewMaxFuture:    5 * time.Minute,
+		AvroSchemaID:          1,
+		CompressionThreshold:  1024,
+		DedupWindow:           10 * time.Minute,
+		DedupCapacity:         100000,
+		SequenceIntervalPath:  "reportingInterval",
+		SequenceMissed:        1,
+		AlertThresholdsPath:   "thresholds",
+		AlertState:            "memory",
+		LivenessIntervalPath:  "reportingInterval",
+		LivenessMissed:        2,
+		LivenessCheck:         30 * time.Second,
+		AnomalyTopic:          "{base}/{siteCode}/{deviceId}/anomalies",
+		AnomalyLimitsPath:     "anomaly",
+		AnomalyAlpha:          0.1,
+		AnomalyZScore:         3,
+		AnomalyWarmup:         30,
+		AnomalyCheckpoint:     30 * time.Second,
+		AggregateTopic:        "{base}/{siteCode}/{deviceId}/aggregate",
+		AggregateLateness:     30 * time.Second,
+		SummaryTopic:          "{base}/{siteCode}/_summary",
+		SummaryActiveWindow:   time.Hour,
+		BatchTopicTemplate:    "{base}/{siteCode}/batch",
+		BatchMaxCount:         100,
+		BatchMaxBytes:         256 << 10,
+		BatchMaxLatency:       5 * time.Second,
+	}
+}
+
+// Load builds the effective configuration from the environment, the optional config file given by
+// -config or CONFIG_FILE, and the CLI flags in args, then validates it
+func Load(args []string, validators ...Validator) (*Config, error) {
+	var configFile string
+
+	// First pass only locates the config file, flag values are applied after the file is read
+	if err := newFlagSet(Default(), &configFile).Parse(args); err != nil {
+		return nil, err
+	}
+	if configFile == "" {
+		configFile = os.Getenv("CONFIG_FILE")
+	}
+
+	cfg := Default()
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	if configFile != "" {
+		if err := cfg.loadFile(configFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := newFlagSet(cfg, &configFile).Parse(args); err != nil {
+		return nil, err
+	}
+	cfg.File = configFile
+
+	if err := cfg.Validate(validators...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// YAML renders the configuration in the config file format with secrets redacted
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+func newFlagSet(cfg *Config, configFile *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("DataEnricher", flag.ContinueOnError)
+
+	fs.StringVar(configFile, "config", *configFile, "path to the YAML config file (CONFIG_FILE)")
+	fs.StringVar(&cfg.Host, "host", cfg.Host, "MQTT broker host (HOST)")
+	fs.IntVar(&cfg.Port, "port", cfg.Port, "MQTT broker port (PORT)")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "log level: debug, info, warn or error (LOG_LEVEL)")
+	fs.StringVar(&cfg.SubscriptionTopic, "subscription-topic", cfg.SubscriptionTopic, "MQTT topic filter to consume (SUBSCRIPTION_TOPIC)")
+	fs.DurationVar(&cfg.MQTTConnectTimeout, "mqtt-connect-timeout", cfg.MQTTConnectTimeout, "timeout of a single MQTT connection attempt (MQTT_CONNECT_TIMEOUT)")
+	fs.DurationVar(&cfg.MQTTRetryInitial, "mqtt-retry-initial-interval", cfg.MQTTRetryInitial, "first delay between MQTT connection attempts (MQTT_RETRY_INITIAL_INTERVAL)")
+	fs.DurationVar(&cfg.MQTTRetryMax, "mqtt-retry-max-interval", cfg.MQTTRetryMax, "maximum delay between MQTT connection attempts (MQTT_RETRY_MAX_INTERVAL)")
+	fs.StringVar(&cfg.MQTTStartupPolicy, "mqtt-startup-policy", cfg.MQTTStartupPolicy, "wait, fail or background while the broker is unreachable at startup (MQTT_STARTUP_POLICY)")
+	fs.DurationVar(&cfg.MQTTStartupTimeout, "mqtt-startup-timeout", cfg.MQTTStartupTimeout, "how long the wait policy retries, 0 retries forever (MQTT_STARTUP_TIMEOUT)")
+	fs.DurationVar(&cfg.MQTTPublishTimeout, "mqtt-publish-timeout", cfg.MQTTPublishTimeout, "how long a publish waits for the broker acknowledgement (MQTT_PUBLISH_TIMEOUT)")
+	fs.StringVar(&cfg.PublishTopicBase, "publish-topic-base", cfg.PublishTopicBase, "MQTT topic prefix for enriched messages (PUBLISH_TOPIC_BASE)")
+	fs.StringVar(&cfg.PublishTopicTemplate, "publish-topic-template", cfg.PublishTopicTemplate, "topic of enriched messages, placeholders {base} {siteCode} {deviceId} {dataModel} (PUBLISH_TOPIC_TEMPLATE)")
+	fs.StringVar(&cfg.User, "user", cfg.User, "MQTT user (USER)")
+	fs.Var(&cfg.Password, "password", "MQTT password (PASSWORD or PASSWORD_FILE)")
+	fs.StringVar(&cfg.LogFilePath, "log-file-path", cfg.LogFilePath, "directory for the rotated log file (LOG_FILE_PATH)")
+	fs.Var(&cfg.RedisConnectionString, "redis-connection-string", "redis:// or rediss:// URL of the registry (REDIS_CONNECTION_STRING or REDIS_CONNECTION_STRING_FILE)")
+	fs.BoolVar(&cfg.DynatraceEnabled, "dynatrace-enabled", cfg.DynatraceEnabled, "enable Dynatrace metrics (DYNATRACE_ENABLED)")
+	fs.StringVar(&cfg.DynatraceIngestURL, "dynatrace-ingest-url", cfg.DynatraceIngestURL, "metrics ingest endpoint, empty uses the local OneAgent (DYNATRACE_INGEST_URL)")
+	fs.Var(&cfg.DynatraceAPIToken, "dynatrace-api-token", "API token for the metrics ingest endpoint (DYNATRACE_API_TOKEN or DYNATRACE_API_TOKEN_FILE)")
+	fs.DurationVar(&cfg.DynatraceFlushPeriod, "dynatrace-flush-period", cfg.DynatraceFlushPeriod, "how often metrics are sent to Dynatrace (DYNATRACE_FLUSH_PERIOD)")
+	fs.DurationVar(&cfg.RegistryCacheTTL, "registry-cache-ttl", cfg.RegistryCacheTTL, "registry cache TTL, 0 disables the cache (REGISTRY_CACHE_TTL)")
+	fs.StringVar(&cfg.AdminAddr, "admin-addr", cfg.AdminAddr, "listen address of the admin API, empty disables it (ADMIN_ADDR)")
+	fs.StringVar(&cfg.SchemaAddr, "schema-addr", cfg.SchemaAddr, "listen address of the public schema routes, empty serves them with the admin API (SCHEMA_ADDR)")
+	fs.Var(&cfg.AdminToken, "admin-token", "bearer token required by the admin API (ADMIN_TOKEN or ADMIN_TOKEN_FILE)")
+	fs.DurationVar(&cfg.ConfigWatchInterval, "config-watch-interval", cfg.ConfigWatchInterval, "how often the config file is checked for changes, 0 disables watching (CONFIG_WATCH_INTERVAL)")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "how long queued messages are drained on shutdown (SHUTDOWN_TIMEOUT)")
+	fs.StringVar(&cfg.OutboxDir, "outbox-dir", cfg.OutboxDir, "directory of the publish outbox, empty disables it (OUTBOX_DIR)")
+	fs.Int64Var(&cfg.OutboxMaxBytes, "outbox-max-bytes", cfg.OutboxMaxBytes, "size cap of the pending outbox messages (OUTBOX_MAX_BYTES)")
+	fs.DurationVar(&cfg.OutboxMaxAge, "outbox-max-age", cfg.OutboxMaxAge, "outbox messages older than this are dropped, 0 keeps them (OUTBOX_MAX_AGE)")
+	fs.Int64Var(&cfg.OutboxSegmentBytes, "outbox-segment-bytes", cfg.OutboxSegmentBytes, "size of an outbox segment file (OUTBOX_SEGMENT_BYTES)")
+	fs.StringVar(&cfg.SchemaSource, "schema-source", cfg.SchemaSource, "where payload JSON Schemas are loaded from: dir or redis, empty disables validation (SCHEMA_SOURCE)")
+	fs.StringVar(&cfg.SchemaDir, "schema-dir", cfg.SchemaDir, "directory of the <dataModel>.json schemas when schema-source is dir (SCHEMA_DIR)")
+	fs.StringVar(&cfg.SchemaDefaultMode, "schema-default-mode", cfg.SchemaDefaultMode, "strict rejects invalid payloads, lenient only logs them (SCHEMA_DEFAULT_MODE)")
+	fs.Var(&cfg.SchemaModes, "schema-modes", "per data model validation mode, e.g. geokonapi=lenient,other=strict (SCHEMA_MODES)")
+	fs.StringVar(&cfg.OutputShape, "output-shape", cfg.OutputShape, "layout of the published messages: enriched, records or observation (OUTPUT_SHAPE)")
+	fs.Var(&cfg.OutputShapes, "output-shapes", "per data model output shape, e.g. geokonapi=records (OUTPUT_SHAPES)")
+	fs.Var(&cfg.Encodings, "encodings", "wire format per sink: json, protobuf, avro, cbor or msgpack, e.g. enriched=avro (ENCODINGS)")
+	fs.IntVar(&cfg.AvroSchemaID, "avro-schema-id", cfg.AvroSchemaID, "schema ID of the first Avro message type, the next types count up from it (AVRO_SCHEMA_ID)")
+	fs.StringVar(&cfg.Compression, "compression", cfg.Compression, "compress published messages with gzip, zstd or snappy, empty disables it (COMPRESSION)")
+	fs.IntVar(&cfg.CompressionThreshold, "compression-threshold", cfg.CompressionThreshold, "smallest message in bytes that is compressed (COMPRESSION_THRESHOLD)")
+	fs.Var(&cfg.RegistryFields, "registry-fields", "registry values copied into the enriched message as field=path, e.g. lat=location.lat (REGISTRY_FIELDS)")
+	fs.BoolVar(&cfg.RegistryOmitRaw, "registry-omit-raw", cfg.RegistryOmitRaw, "leave the raw registry out of the enriched message (REGISTRY_OMIT_RAW)")
+	fs.BoolVar(&cfg.CalibrationEnabled, "calibration-enabled", cfg.CalibrationEnabled, "compute engineering values from the registry calibration (CALIBRATION_ENABLED)")
+	fs.StringVar(&cfg.CalibrationPath, "calibration-path", cfg.CalibrationPath, "registry path of the calibration sheet (CALIBRATION_PATH)")
+	fs.BoolVar(&cfg.UnitConversion, "unit-conversion", cfg.UnitConversion, "normalize units and convert to the unit system of the site or data model (UNIT_CONVERSION)")
+	fs.StringVar(&cfg.UnknownUnits, "unknown-units", cfg.UnknownUnits, "flag or reject payloads with units outside the vocabulary (UNKNOWN_UNITS)")
+	fs.StringVar(&cfg.ClockSkew, "clock-skew", cfg.ClockSkew, "off, flag or reject readings with timestamps out of bounds (CLOCK_SKEW)")
+	fs.DurationVar(&cfg.ClockSkewMaxFuture, "clock-skew-max-future", cfg.ClockSkewMaxFuture, "how far ahead of the ingest time a reading may be (CLOCK_SKEW_MAX_FUTURE)")
+	fs.DurationVar(&cfg.ClockSkewMaxPast, "clock-skew-max-past", cfg.ClockSkewMaxPast, "how far behind the ingest time a reading may be, 0 accepts any (CLOCK_SKEW_MAX_PAST)")
+	fs.StringVar(&cfg.Dedup, "dedup", cfg.Dedup, "drop duplicate events using a memory or redis seen set, empty disables it (DEDUP)")
+	fs.DurationVar(&cfg.DedupWindow, "dedup-window", cfg.DedupWindow, "how long an event is remembered for deduplication (DEDUP_WINDOW)")
+	fs.IntVar(&cfg.DedupCapacity, "dedup-capacity", cfg.DedupCapacity, "maximum number of events remembered by the memory seen set (DEDUP_CAPACITY)")
+	fs.StringVar(&cfg.Sequence, "sequence", cfg.Sequence, "flag out of order observations and gaps, keeping the last observation in memory or redis, empty disables it (SEQUENCE)")
+	fs.StringVar(&cfg.SequenceIntervalPath, "sequence-interval-path", cfg.SequenceIntervalPath, "registry path of the expected reporting interval (SEQUENCE_INTERVAL_PATH)")
+	fs.DurationVar(&cfg.SequenceInterval, "sequence-default-interval", cfg.SequenceInterval, "reporting interval of the devices without one in the registry, 0 skips their gaps (SEQUENCE_DEFAULT_INTERVAL)")
+	fs.IntVar(&cfg.SequenceMissed, "sequence-missed-reports", cfg.SequenceMissed, "number of missed reports that makes a gap (SEQUENCE_MISSED_REPORTS)")
+	fs.StringVar(&cfg.GapTopic, "gap-topic", cfg.GapTopic, "topic template of the gap events, empty only flags the observations (GAP_TOPIC)")
+	fs.StringVar(&cfg.AlertTopic, "alert-topic", cfg.AlertTopic, "topic template of the threshold alerts, empty disables alerting (ALERT_TOPIC)")
+	fs.StringVar(&cfg.AlertThresholdsPath, "alert-thresholds-path", cfg.AlertThresholdsPath, "registry path of the alert thresholds (ALERT_THRESHOLDS_PATH)")
+	fs.StringVar(&cfg.AlertState, "alert-state", cfg.AlertState, "where the alert levels are kept: memory or redis (ALERT_STATE)")
+	fs.StringVar(&cfg.LivenessTopic, "liveness-topic", cfg.LivenessTopic, "topic template of the device stale and recovered events, empty disables liveness tracking (LIVENESS_TOPIC)")
+	fs.StringVar(&cfg.LivenessIntervalPath, "liveness-interval-path", cfg.LivenessIntervalPath, "registry path of the expected reporting interval (LIVENESS_INTERVAL_PATH)")
+	fs.DurationVar(&cfg.LivenessInterval, "liveness-default-interval", cfg.LivenessInterval, "reporting interval of the devices without one in the registry, 0 leaves them untracked (LIVENESS_DEFAULT_INTERVAL)")
+	fs.IntVar(&cfg.LivenessMissed, "liveness-missed-reports", cfg.LivenessMissed, "number of missed reports after which a device is stale (LIVENESS_MISSED_REPORTS)")
+	fs.DurationVar(&cfg.LivenessCheck, "liveness-check-interval", cfg.LivenessCheck, "how often the stale devices are checked (LIVENESS_CHECK_INTERVAL)")
+	fs.BoolVar(&cfg.AnomalyDetection, "anomaly-detection", cfg.AnomalyDetection, "score the observations against a moving model of every device metric (ANOMALY_DETECTION)")
+	fs.StringVar(&cfg.AnomalyTopic, "anomaly-topic-template", cfg.AnomalyTopic, "topic of the anomalies, empty only attaches the scores (ANOMALY_TOPIC_TEMPLATE)")
+	fs.StringVar(&cfg.AnomalyLimitsPath, "anomaly-limits-path", cfg.AnomalyLimitsPath, "registry path of the per metric anomaly limits (ANOMALY_LIMITS_PATH)")
+	fs.Float64Var(&cfg.AnomalyAlpha, "anomaly-alpha", cfg.AnomalyAlpha, "weight of a new value in the moving mean and variance (ANOMALY_ALPHA)")
+	fs.Float64Var(&cfg.AnomalyZScore, "anomaly-zscore", cfg.AnomalyZScore, "z-score past which a value is an anomaly (ANOMALY_ZSCORE)")
+	fs.IntVar(&cfg.AnomalyWarmup, "anomaly-warmup", cfg.AnomalyWarmup, "number of values a model needs before it scores (ANOMALY_WARMUP)")
+	fs.DurationVar(&cfg.AnomalyCheckpoint, "anomaly-checkpoint-interval", cfg.AnomalyCheckpoint, "how often the models are checkpointed to redis (ANOMALY_CHECKPOINT_INTERVAL)")
+	fs.Var(&cfg.AggregateWindows, "aggregate-windows", "tumbling windows of the per device metric aggregates, e.g. 1m,15m,1h, empty disables aggregation (AGGREGATE_WINDOWS)")
+	fs.StringVar(&cfg.AggregateTopic, "aggregate-topic-template", cfg.AggregateTopic, "topic of the aggregates, suffixed with /<window> (AGGREGATE_TOPIC_TEMPLATE)")
+	fs.DurationVar(&cfg.AggregateLateness, "aggregate-allowed-lateness", cfg.AggregateLateness, "how long a window accepts observations after its end (AGGREGATE_ALLOWED_LATENESS)")
+	fs.DurationVar(&cfg.SummaryInterval, "summary-interval", cfg.SummaryInterval, "how often the site summaries are published, 0 disables them (SUMMARY_INTERVAL)")
+	fs.StringVar(&cfg.SummaryTopic, "summary-topic-template", cfg.SummaryTopic, "topic of the site summaries (SUMMARY_TOPIC_TEMPLATE)")
+	fs.DurationVar(&cfg.SummaryActiveWindow, "summary-active-window", cfg.SummaryActiveWindow, "how long a device stays active in the site summary after its last message (SUMMARY_ACTIVE_WINDOW)")
+	fs.StringVar(&cfg.RulesSource, "rules-source", cfg.RulesSource, "where the filtering and routing rules are loaded from: file or redis, empty disables them (RULES_SOURCE)")
+	fs.StringVar(&cfg.RulesFile, "rules-file", cfg.RulesFile, "YAML or JSON rule file when rules-source is file (RULES_FILE)")
+	fs.BoolVar(&cfg.BatchEnabled, "batch-enabled", cfg.BatchEnabled, "publish the enriched messages in batches per routing key (BATCH_ENABLED)")
+	fs.StringVar(&cfg.BatchTopicTemplate, "batch-topic-template", cfg.BatchTopicTemplate, "topic, and grouping key, of the batches (BATCH_TOPIC_TEMPLATE)")
+	fs.IntVar(&cfg.BatchMaxCount, "batch-max-count", cfg.BatchMaxCount, "number of messages that flushes a batch (BATCH_MAX_COUNT)")
+	fs.IntVar(&cfg.BatchMaxBytes, "batch-max-bytes", cfg.BatchMaxBytes, "size in bytes of the messages that flushes a batch (BATCH_MAX_BYTES)")
+	fs.DurationVar(&cfg.BatchMaxLatency, "batch-max-latency", cfg.BatchMaxLatency, "age that flushes a batch (BATCH_MAX_LATENCY)")
+	fs.StringVar(&cfg.DeadLetterTopic, "dead-letter-topic", cfg.DeadLetterTopic, "MQTT topic of the rejected messages, empty disables it (DEAD_LETTER_TOPIC)")
+
+	return fs
+}
+
+func (c *Config) loadEnv() error {
+	var errs []error
+
+	setString(&c.Host, "HOST")
+	setString(&c.LogLevel, "LOG_LEVEL")
+	setString(&c.SubscriptionTopic, "SUBSCRIPTION_TOPIC")
+	setString(&c.MQTTStartupPolicy, "MQTT_STARTUP_POLICY")
+	setString(&c.PublishTopicBase, "PUBLISH_TOPIC_BASE")
+	setString(&c.PublishTopicTemplate, "PUBLISH_TOPIC_TEMPLATE")
+	setString(&c.User, "USER")
+	setString(&c.Password, "PASSWORD")
+	setString(&c.LogFilePath, "LOG_FILE_PATH")
+	setString(&c.RedisConnectionString, "REDIS_CONNECTION_STRING")
+	setString(&c.DynatraceIngestURL, "DYNATRACE_INGEST_URL")
+	setString(&c.DynatraceAPIToken, "DYNATRACE_API_TOKEN")
+	setString(&c.AdminAddr, "ADMIN_ADDR")
+	setString(&c.SchemaAddr, "SCHEMA_ADDR")
+	setString(&c.AdminToken, "ADMIN_TOKEN")
+	setString(&c.OutboxDir, "OUTBOX_DIR")
+	setString(&c.SchemaSource, "SCHEMA_SOURCE")
+	setString(&c.SchemaDir, "SCHEMA_DIR")
+	setString(&c.SchemaDefaultMode, "SCHEMA_DEFAULT_MODE")
+	setString(&c.DeadLetterTopic, "DEAD_LETTER_TOPIC")
+	setString(&c.OutputShape, "OUTPUT_SHAPE")
+	setString(&c.CalibrationPath, "CALIBRATION_PATH")
+	setString(&c.UnknownUnits, "UNKNOWN_UNITS")
+	setString(&c.ClockSkew, "CLOCK_SKEW")
+	setString(&c.Dedup, "DEDUP")
+	setString(&c.Sequence, "SEQUENCE")
+	setString(&c.SequenceIntervalPath, "SEQUENCE_INTERVAL_PATH")
+	setString(&c.GapTopic, "GAP_TOPIC")
+	setString(&c.Compression, "COMPRESSION")
+	setString(&c.AlertTopic, "ALERT_TOPIC")
+	setString(&c.AlertThresholdsPath, "ALERT_THRESHOLDS_PATH")
+	setString(&c.AlertState, "ALERT_STATE")
+	setString(&c.LivenessTopic, "LIVENESS_TOPIC")
+	setString(&c.LivenessIntervalPath, "LIVENESS_INTERVAL_PATH")
+	setString(&c.AggregateTopic, "AGGREGATE_TOPIC_TEMPLATE")
+	setString(&c.AnomalyTopic, "ANOMALY_TOPIC_TEMPLATE")
+	setString(&c.AnomalyLimitsPath, "ANOMALY_LIMITS_PATH")
+	setString(&c.SummaryTopic, "SUMMARY_TOPIC_TEMPLATE")
+	setString(&c.RulesSource, "RULES_SOURCE")
+	setString(&c.RulesFile, "RULES_FILE")
+	setString(&c.BatchTopicTemplate, "BATCH_TOPIC_TEMPLATE")
+
+	if err := loadSecretFile(&c.Password, "PASSWORD"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := loadSecretFile(&c.RedisConnectionString, "REDIS_CONNECTION_STRING"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := loadSecretFile(&c.DynatraceAPIToken, "DYNATRACE_API_TOKEN"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := loadSecretFile(&c.AdminToken, "ADMIN_TOKEN"); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := setInt(&c.Port, "PORT"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setInt(&c.AvroSchemaID, "AVRO_SCHEMA_ID"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setInt(&c.CompressionThreshold, "COMPRESSION_THRESHOLD"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setInt(&c.DedupCapacity, "DEDUP_CAPACITY"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setInt(&c.BatchMaxCount, "BATCH_MAX_COUNT"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setInt(&c.BatchMaxBytes, "BATCH_MAX_BYTES"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setInt(&c.LivenessMissed, "LIVENESS_MISSED_REPORTS"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setFloat(&c.AnomalyAlpha, "ANOMALY_ALPHA"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setFloat(&c.AnomalyZScore, "ANOMALY_ZSCORE"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setInt(&c.AnomalyWarmup, "ANOMALY_WARMUP"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setInt(&c.SequenceMissed, "SEQUENCE_MISSED_REPORTS"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setBool(&c.DynatraceEnabled, "DYNATRACE_ENABLED"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setBool(&c.CalibrationEnabled, "CALIBRATION_ENABLED"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setBool(&c.UnitConversion, "UNIT_CONVERSION"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setBool(&c.AnomalyDetection, "ANOMALY_DETECTION"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setBool(&c.BatchEnabled, "BATCH_ENABLED"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setBool(&c.RegistryOmitRaw, "REGISTRY_OMIT_RAW"); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := setDuration(&c.MQTTConnectTimeout, "MQTT_CONNECT_TIMEOUT"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.MQTTRetryInitial, "MQTT_RETRY_INITIAL_INTERVAL"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.MQTTRetryMax, "MQTT_RETRY_MAX_INTERVAL"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.MQTTStartupTimeout, "MQTT_STARTUP_TIMEOUT"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.MQTTPublishTimeout, "MQTT_PUBLISH_TIMEOUT"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.RegistryCacheTTL, "REGISTRY_CACHE_TTL"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.DynatraceFlushPeriod, "DYNATRACE_FLUSH_PERIOD"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.ConfigWatchInterval, "CONFIG_WATCH_INTERVAL"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.ShutdownTimeout, "SHUTDOWN_TIMEOUT"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.OutboxMaxAge, "OUTBOX_MAX_AGE"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.DedupWindow, "DEDUP_WINDOW"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.SequenceInterval, "SEQUENCE_DEFAULT_INTERVAL"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.ClockSkewMaxFuture, "CLOCK_SKEW_MAX_FUTURE"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.ClockSkewMaxPast, "CLOCK_SKEW_MAX_PAST"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.BatchMaxLatency, "BATCH_MAX_LATENCY"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.AggregateLateness, "AGGREGATE_ALLOWED_LATENESS"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.AnomalyCheckpoint, "ANOMALY_CHECKPOINT_INTERVAL"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDurations(&c.AggregateWindows, "AGGREGATE_WINDOWS"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.SummaryInterval, "SUMMARY_INTERVAL"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.SummaryActiveWindow, "SUMMARY_ACTIVE_WINDOW"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.LivenessInterval, "LIVENESS_DEFAULT_INTERVAL"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setDuration(&c.LivenessCheck, "LIVENESS_CHECK_INTERVAL"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setInt64(&c.OutboxMaxBytes, "OUTBOX_MAX_BYTES"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setInt64(&c.OutboxSegmentBytes, "OUTBOX_SEGMENT_BYTES"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setKeyValues(&c.SchemaModes, "SCHEMA_MODES"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setKeyValues(&c.OutputShapes, "OUTPUT_SHAPES"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setKeyValues(&c.RegistryFields, "REGISTRY_FIELDS"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := setKeyValues(&c.Encodings, "ENCODINGS"); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Config) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	err = decoder.Decode(c)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func setDuration(field *time.Duration, key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%s: invalid duration %q", key, value)
+	}
+	*field = d
+	return nil
+}
+
+func setInt(field *int, key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s: invalid integer %q", key, value)
+	}
+	*field = n
+	return nil
+}
+
+func setInt64(field *int64, key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s: invalid integer %q", key, value)
+	}
+	*field = n
+	return nil
+}
+
+func setFloat(field *float64, key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("%s: invalid number %q", key, value)
+	}
+	*field = f
+	return nil
+}
+
+func setBool(field *bool, key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%s: invalid boolean %q", key, value)
 	}
+	*field = b
+	return nil
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
+func setString[T ~string](field *T, key string) {
 	if value := os.Getenv(key); value != "" {
-		return value
+		*field = T(value)
 	}
-	return defaultValue
 }
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		check func(c *Config) bool
+		want  []string
+	}{
+		{
+			name: "values",
+			env:  map[string]string{"PORT": "1883", "ANOMALY_ALPHA": "0.5", "BATCH_ENABLED": "true", "MQTT_PUBLISH_TIMEOUT": "3s"},
+			check: func(c *Config) bool {
+				return c.Port == 1883 && c.AnomalyAlpha == 0.5 && c.BatchEnabled && c.MQTTPublishTimeout == 3*time.Second
+			},
+		},
+		{
+			name:  "invalid values are reported and not applied",
+			env:   map[string]string{"PORT": "tls", "ANOMALY_ZSCORE": "high", "DYNATRACE_ENABLED": "maybe"},
+			check: func(c *Config) bool { return c.Port == Default().Port },
+			want:  []string{`PORT: invalid integer "tls"`, `ANOMALY_ZSCORE: invalid number "high"`, `DYNATRACE_ENABLED: invalid boolean "maybe"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			c := Default()
+			err := c.loadEnv()
+			for _, want := range tt.want {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("loadEnv error = %v, want %s", err, want)
+				}
+			}
+			if len(tt.want) == 0 && err != nil {
+				t.Errorf("loadEnv error = %v", err)
+			}
+			if !tt.check(c) {
+				t.Errorf("config = %+v", c)
+			}
+		})
+	}
+}
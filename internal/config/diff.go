@@ -0,0 +1,38 @@
+package config
+
+import (
+	"reflect"
+)
+
+// reloadable lists the settings, by config file name, that can be applied without a restart, publish_topic_base
+// is not one of them since every router, the alert, anomaly, aggregate, gap, summary, liveness, batch and rule
+// topics, is built from it
+var reloadable = map[string]bool{
+	"subscription_topic":     true,
+	"publish_topic_template": true,
+	"log_level":              true,
+	"registry_cache_ttl":     true,
+}
+
+// Diff returns the config file names of the settings that differ between c and next,
+// split between those applied live and those that need a restart
+func (c *Config) Diff(next *Config) (live []string, restart []string) {
+	current := reflect.ValueOf(c).Elem()
+	updated := reflect.ValueOf(next).Elem()
+
+	for i := 0; i < current.NumField(); i++ {
+		name := current.Type().Field(i).Tag.Get("yaml")
+		if name == "" || name == "-" {
+			continue
+		}
+		if reflect.DeepEqual(current.Field(i).Interface(), updated.Field(i).Interface()) {
+			continue
+		}
+		if reloadable[name] {
+			live = append(live, name)
+		} else {
+			restart = append(restart, name)
+		}
+	}
+	return live, restart
+}
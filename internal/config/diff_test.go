@@ -0,0 +1,44 @@
+package config
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name        string
+		change      func(c *Config)
+		wantLive    []string
+		wantRestart []string
+	}{
+		{name: "unchanged", change: func(c *Config) {}},
+		{
+			name:     "live",
+			change:   func(c *Config) { c.PublishTopicTemplate = "{base}/{deviceId}"; c.RegistryCacheTTL = time.Hour },
+			wantLive: []string{"publish_topic_template", "registry_cache_ttl"},
+		},
+		{
+			name:        "publish topic base needs a restart",
+			change:      func(c *Config) { c.PublishTopicBase = "OTHER" },
+			wantRestart: []string{"publish_topic_base"},
+		},
+		{
+			name:        "mixed",
+			change:      func(c *Config) { c.LogLevel = "warn"; c.BatchEnabled = true },
+			wantLive:    []string{"log_level"},
+			wantRestart: []string{"batch_enabled"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := Default()
+			tt.change(next)
+			live, restart := Default().Diff(next)
+			if !slices.Equal(live, tt.wantLive) || !slices.Equal(restart, tt.wantRestart) {
+				t.Errorf("Diff = %v, %v, want %v, %v", live, restart, tt.wantLive, tt.wantRestart)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Durations is a list of durations read from a list in the config file, or from a comma separated list in
+// the environment and on the command line
+type Durations []time.Duration
+
+// String renders the durations comma separated
+func (d Durations) String() string {
+	names := make([]string, 0, len(d))
+	for _, duration := range d {
+		names = append(names, duration.String())
+	}
+	return strings.Join(names, ",")
+}
+
+// Set implements flag.Value, the durations replace the current content
+func (d *Durations) Set(value string) error {
+	var durations Durations
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(name)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", name)
+		}
+		durations = append(durations, duration)
+	}
+	*d = durations
+	return nil
+}
+
+func setDurations(field *Durations, key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	if err := field.Set(value); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
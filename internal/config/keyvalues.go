@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// KeyValues is a string map read from a map in the config file, or from a comma separated list of
+// key=value pairs in the environment and on the command line
+type KeyValues map[string]string
+
+// String renders the pairs sorted by key
+func (kv KeyValues) String() string {
+	pairs := make([]string, 0, len(kv))
+	for k, v := range kv {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set implements flag.Value, the pairs replace the current content
+func (kv *KeyValues) Set(value string) error {
+	m := make(KeyValues)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return fmt.Errorf("expected key=value, got %q", pair)
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	*kv = m
+	return nil
+}
+
+func setKeyValues(field *KeyValues, key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	if err := field.Set(value); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
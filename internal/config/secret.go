@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// Secret is a configuration value that never prints itself, use Value to read it
+type Secret string
+
+// Value returns the secret in clear text
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String redacts the secret, an unset secret prints as empty
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// Set implements flag.Value
+func (s *Secret) Set(value string) error {
+	*s = Secret(value)
+	return nil
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// SecretURL is a connection string whose password is masked when printed
+type SecretURL string
+
+// Value returns the connection string in clear text
+func (s SecretURL) Value() string {
+	return string(s)
+}
+
+// String returns the connection string with its password masked
+func (s SecretURL) String() string {
+	return MaskURLPassword(string(s))
+}
+
+// Set implements flag.Value
+func (s *SecretURL) Set(value string) error {
+	*s = SecretURL(value)
+	return nil
+}
+
+func (s SecretURL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s SecretURL) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// MaskURLPassword replaces the password of a URL with xxxxx, a string that does not parse as a URL
+// is redacted entirely since it may still hold credentials
+func MaskURLPassword(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	return u.Redacted()
+}
+
+// loadSecretFile sets field from the file named by the <key>_FILE environment variable,
+// as used for mounted Kubernetes secrets
+func loadSecretFile[T ~string](field *T, key string) error {
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return nil
+	}
+	if os.Getenv(key) != "" {
+		return fmt.Errorf("%s and %s_FILE are mutually exclusive", key, key)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s_FILE: %w", key, err)
+	}
+	*field = T(strings.TrimRight(string(b), "\r\n"))
+	return nil
+}
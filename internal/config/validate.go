@@ -0,0 +1,377 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	logLevels    = []string{"debug", "info", "warn", "warning", "error"}
+	outputShapes = []string{"enriched", "records", "observation"}
+	sinks        = []string{"enriched", "dead_letter", "alert", "liveness", "aggregate", "summary", "gap", "anomaly"}
+)
+
+// Validator checks settings with the rules of the package that uses them, main passes them to Load so config
+// does not depend on those packages
+type Validator func(c *Config) error
+
+// Validate checks the configuration and reports every invalid setting at once, including the errors of the
+// validators
+func (c *Config) Validate(validators ...Validator) error {
+	var errs []error
+
+	if c.Host == "" {
+		errs = append(errs, errors.New("host: must not be empty"))
+	} else if strings.Contains(c.Host, "://") {
+		errs = append(errs, fmt.Errorf("host: expected a host name without scheme, got %q", c.Host))
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port: must be between 1 and 65535, got %d", c.Port))
+	}
+	if !isLogLevel(c.LogLevel) {
+		errs = append(errs, fmt.Errorf("log_level: must be one of %s, got %q", strings.Join(logLevels, ", "), c.LogLevel))
+	}
+	if err := ValidateTopicFilter(c.SubscriptionTopic); err != nil {
+		errs = append(errs, fmt.Errorf("subscription_topic: %w", err))
+	}
+	if c.MQTTConnectTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("mqtt_connect_timeout: must be positive, got %s", c.MQTTConnectTimeout))
+	}
+	if c.MQTTRetryInitial <= 0 || c.MQTTRetryMax < c.MQTTRetryInitial {
+		errs = append(errs, fmt.Errorf("mqtt_retry_initial_interval, mqtt_retry_max_interval: expected 0 < initial <= max, got %s and %s", c.MQTTRetryInitial, c.MQTTRetryMax))
+	}
+	switch c.MQTTStartupPolicy {
+	case "wait", "fail", "background":
+	default:
+		errs = append(errs, fmt.Errorf("mqtt_startup_policy: must be one of wait, fail, background, got %q", c.MQTTStartupPolicy))
+	}
+	if c.MQTTStartupTimeout < 0 {
+		errs = append(errs, fmt.Errorf("mqtt_startup_timeout: must not be negative, got %s", c.MQTTStartupTimeout))
+	}
+	if c.MQTTPublishTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("mqtt_publish_timeout: must be positive, got %s", c.MQTTPublishTimeout))
+	}
+	if err := ValidateTopicName(c.PublishTopicBase); err != nil {
+		errs = append(errs, fmt.Errorf("publish_topic_base: %w", err))
+	}
+	if err := ValidateTopicName(c.PublishTopicTemplate); err != nil {
+		errs = append(errs, fmt.Errorf("publish_topic_template: %w", err))
+	}
+	if c.LogFilePath == "" {
+		errs = append(errs, errors.New("log_file_path: must not be empty"))
+	}
+	if c.RegistryCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("registry_cache_ttl: must not be negative, got %s", c.RegistryCacheTTL))
+	}
+	if c.ConfigWatchInterval < 0 {
+		errs = append(errs, fmt.Errorf("config_watch_interval: must not be negative, got %s", c.ConfigWatchInterval))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown_timeout: must be positive, got %s", c.ShutdownTimeout))
+	}
+	if c.DynatraceEnabled && c.DynatraceFlushPeriod <= 0 {
+		errs = append(errs, fmt.Errorf("dynatrace_flush_period: must be positive, got %s", c.DynatraceFlushPeriod))
+	}
+	if c.DynatraceIngestURL != "" {
+		if u, err := url.Parse(c.DynatraceIngestURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("dynatrace_ingest_url: expected an http(s) URL, got %q", c.DynatraceIngestURL))
+		}
+	}
+	if c.OutboxDir != "" {
+		if c.OutboxMaxBytes <= 0 {
+			errs = append(errs, fmt.Errorf("outbox_max_bytes: must be positive, got %d", c.OutboxMaxBytes))
+		}
+		if c.OutboxSegmentBytes <= 0 || c.OutboxSegmentBytes > c.OutboxMaxBytes {
+			errs = append(errs, fmt.Errorf("outbox_segment_bytes: must be positive and at most outbox_max_bytes, got %d", c.OutboxSegmentBytes))
+		}
+		if c.OutboxMaxAge < 0 {
+			errs = append(errs, fmt.Errorf("outbox_max_age: must not be negative, got %s", c.OutboxMaxAge))
+		}
+	}
+	switch c.SchemaSource {
+	case "", "redis":
+	case "dir":
+		if c.SchemaDir == "" {
+			errs = append(errs, errors.New("schema_dir: required when schema_source is dir"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("schema_source: must be one of dir, redis or empty, got %q", c.SchemaSource))
+	}
+	switch c.RulesSource {
+	case "", "redis":
+	case "file":
+		if c.RulesFile == "" {
+			errs = append(errs, errors.New("rules_file: required when rules_source is file"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("rules_source: must be one of file, redis or empty, got %q", c.RulesSource))
+	}
+	if !isSchemaMode(c.SchemaDefaultMode) {
+		errs = append(errs, fmt.Errorf("schema_default_mode: must be strict or lenient, got %q", c.SchemaDefaultMode))
+	}
+	for _, dataModel := range slices.Sorted(maps.Keys(c.SchemaModes)) {
+		if mode := c.SchemaModes[dataModel]; !isSchemaMode(mode) {
+			errs = append(errs, fmt.Errorf("schema_modes: %s must be strict or lenient, got %q", dataModel, mode))
+		}
+	}
+	if !isOutputShape(c.OutputShape) {
+		errs = append(errs, fmt.Errorf("output_shape: must be one of %s, got %q", strings.Join(outputShapes, ", "), c.OutputShape))
+	}
+	for _, dataModel := range slices.Sorted(maps.Keys(c.OutputShapes)) {
+		if shape := c.OutputShapes[dataModel]; !isOutputShape(shape) {
+			errs = append(errs, fmt.Errorf("output_shapes: %s must be one of %s, got %q", dataModel, strings.Join(outputShapes, ", "), shape))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.RegistryFields)) {
+		path := c.RegistryFields[name]
+		if !isRegistryPath(path) {
+			errs = append(errs, fmt.Errorf("registry_fields: %s has an invalid path %q", name, path))
+		}
+	}
+	if c.CalibrationEnabled && !isRegistryPath(c.CalibrationPath) {
+		errs = append(errs, fmt.Errorf("calibration_path: invalid path %q", c.CalibrationPath))
+	}
+	if c.UnknownUnits != "flag" && c.UnknownUnits != "reject" {
+		errs = append(errs, fmt.Errorf("unknown_units: must be flag or reject, got %q", c.UnknownUnits))
+	}
+	switch c.ClockSkew {
+	case "off":
+	case "flag", "reject":
+		if c.ClockSkewMaxFuture < 0 {
+			errs = append(errs, fmt.Errorf("clock_skew_max_future: must not be negative, got %s", c.ClockSkewMaxFuture))
+		}
+		if c.ClockSkewMaxPast < 0 {
+			errs = append(errs, fmt.Errorf("clock_skew_max_past: must not be negative, got %s", c.ClockSkewMaxPast))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("clock_skew: must be off, flag or reject, got %q", c.ClockSkew))
+	}
+	for _, sink := range slices.Sorted(maps.Keys(c.Encodings)) {
+		if !slices.Contains(sinks, sink) {
+			errs = append(errs, fmt.Errorf("encodings: unknown sink %q, expected one of %s", sink, strings.Join(sinks, ", ")))
+		}
+	}
+	if c.CompressionThreshold < 0 {
+		errs = append(errs, fmt.Errorf("compression_threshold: must not be negative, got %d", c.CompressionThreshold))
+	}
+	switch c.Dedup {
+	case "", "memory", "redis":
+	default:
+		errs = append(errs, fmt.Errorf("dedup: must be one of memory, redis or empty, got %q", c.Dedup))
+	}
+	if c.Dedup != "" && c.DedupWindow <= 0 {
+		errs = append(errs, fmt.Errorf("dedup_window: must be positive, got %s", c.DedupWindow))
+	}
+	if c.Dedup == "memory" && c.DedupCapacity <= 0 {
+		errs = append(errs, fmt.Errorf("dedup_capacity: must be positive, got %d", c.DedupCapacity))
+	}
+	switch c.Sequence {
+	case "":
+	case "memory", "redis":
+		if !isRegistryPath(c.SequenceIntervalPath) {
+			errs = append(errs, fmt.Errorf("sequence_interval_path: invalid path %q", c.SequenceIntervalPath))
+		}
+		if c.SequenceInterval < 0 {
+			errs = append(errs, fmt.Errorf("sequence_default_interval: must not be negative, got %s", c.SequenceInterval))
+		}
+		if c.SequenceMissed <= 0 {
+			errs = append(errs, fmt.Errorf("sequence_missed_reports: must be positive, got %d", c.SequenceMissed))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("sequence: must be one of memory, redis or empty, got %q", c.Sequence))
+	}
+	if c.GapTopic != "" {
+		if err := ValidateTopicName(c.GapTopic); err != nil {
+			errs = append(errs, fmt.Errorf("gap_topic: %w", err))
+		}
+		if c.Sequence == "" {
+			errs = append(errs, errors.New("gap_topic: requires sequence to be set"))
+		}
+	}
+	if c.AlertTopic != "" {
+		if err := ValidateTopicName(c.AlertTopic); err != nil {
+			errs = append(errs, fmt.Errorf("alert_topic: %w", err))
+		}
+		if !isRegistryPath(c.AlertThresholdsPath) {
+			errs = append(errs, fmt.Errorf("alert_thresholds_path: invalid path %q", c.AlertThresholdsPath))
+		}
+		switch c.AlertState {
+		case "memory", "redis":
+		default:
+			errs = append(errs, fmt.Errorf("alert_state: must be memory or redis, got %q", c.AlertState))
+		}
+	}
+	if c.LivenessTopic != "" {
+		if err := ValidateTopicName(c.LivenessTopic); err != nil {
+			errs = append(errs, fmt.Errorf("liveness_topic: %w", err))
+		}
+		if !isRegistryPath(c.LivenessIntervalPath) {
+			errs = append(errs, fmt.Errorf("liveness_interval_path: invalid path %q", c.LivenessIntervalPath))
+		}
+		if c.LivenessInterval < 0 {
+			errs = append(errs, fmt.Errorf("liveness_default_interval: must not be negative, got %s", c.LivenessInterval))
+		}
+		if c.LivenessMissed <= 0 {
+			errs = append(errs, fmt.Errorf("liveness_missed_reports: must be positive, got %d", c.LivenessMissed))
+		}
+		if c.LivenessCheck <= 0 {
+			errs = append(errs, fmt.Errorf("liveness_check_interval: must be positive, got %s", c.LivenessCheck))
+		}
+	}
+	if c.AnomalyDetection {
+		if c.AnomalyTopic != "" {
+			if err := ValidateTopicName(c.AnomalyTopic); err != nil {
+				errs = append(errs, fmt.Errorf("anomaly_topic_template: %w", err))
+			}
+		}
+		if !isRegistryPath(c.AnomalyLimitsPath) {
+			errs = append(errs, fmt.Errorf("anomaly_limits_path: invalid path %q", c.AnomalyLimitsPath))
+		}
+		if c.AnomalyAlpha <= 0 || c.AnomalyAlpha > 1 {
+			errs = append(errs, fmt.Errorf("anomaly_alpha: must be in (0, 1], got %g", c.AnomalyAlpha))
+		}
+		if c.AnomalyZScore <= 0 {
+			errs = append(errs, fmt.Errorf("anomaly_zscore: must be positive, got %g", c.AnomalyZScore))
+		}
+		if c.AnomalyWarmup < 2 {
+			errs = append(errs, fmt.Errorf("anomaly_warmup: must be at least 2, got %d", c.AnomalyWarmup))
+		}
+		if c.AnomalyCheckpoint <= 0 {
+			errs = append(errs, fmt.Errorf("anomaly_checkpoint_interval: must be positive, got %s", c.AnomalyCheckpoint))
+		}
+	}
+	if len(c.AggregateWindows) > 0 {
+		for i, window := range c.AggregateWindows {
+			if window < time.Second || window%time.Second != 0 {
+				errs = append(errs, fmt.Errorf("aggregate_windows: %s is not a whole number of seconds", window))
+			}
+			if slices.Contains(c.AggregateWindows[:i], window) {
+				errs = append(errs, fmt.Errorf("aggregate_windows: %s is listed twice", window))
+			}
+		}
+		if err := ValidateTopicName(c.AggregateTopic); err != nil {
+			errs = append(errs, fmt.Errorf("aggregate_topic_template: %w", err))
+		}
+		if c.AggregateLateness < 0 {
+			errs = append(errs, fmt.Errorf("aggregate_allowed_lateness: must not be negative, got %s", c.AggregateLateness))
+		}
+	}
+	if c.SummaryInterval < 0 {
+		errs = append(errs, fmt.Errorf("summary_interval: must not be negative, got %s", c.SummaryInterval))
+	}
+	if c.SummaryInterval > 0 {
+		if err := ValidateTopicName(c.SummaryTopic); err != nil {
+			errs = append(errs, fmt.Errorf("summary_topic_template: %w", err))
+		}
+		if strings.Contains(c.SummaryTopic, "{deviceId}") || strings.Contains(c.SummaryTopic, "{dataModel}") {
+			errs = append(errs, errors.New("summary_topic_template: summaries are per site, {deviceId} and {dataModel} are not available"))
+		}
+		if c.SummaryActiveWindow <= 0 {
+			errs = append(errs, fmt.Errorf("summary_active_window: must be positive, got %s", c.SummaryActiveWindow))
+		}
+	}
+	if c.BatchEnabled {
+		if err := ValidateTopicName(c.BatchTopicTemplate); err != nil {
+			errs = append(errs, fmt.Errorf("batch_topic_template: %w", err))
+		}
+		if c.BatchMaxCount < 0 {
+			errs = append(errs, fmt.Errorf("batch_max_count: must not be negative, got %d", c.BatchMaxCount))
+		}
+		if c.BatchMaxBytes < 0 {
+			errs = append(errs, fmt.Errorf("batch_max_bytes: must not be negative, got %d", c.BatchMaxBytes))
+		}
+		if c.BatchMaxLatency <= 0 {
+			errs = append(errs, fmt.Errorf("batch_max_latency: must be positive, got %s", c.BatchMaxLatency))
+		}
+	}
+	if c.DeadLetterTopic != "" {
+		if err := ValidateTopicName(c.DeadLetterTopic); err != nil {
+			errs = append(errs, fmt.Errorf("dead_letter_topic: %w", err))
+		}
+	}
+	if c.AdminAddr != "" {
+		if _, _, err := net.SplitHostPort(c.AdminAddr); err != nil {
+			errs = append(errs, fmt.Errorf("admin_addr: %w", err))
+		}
+		if c.AdminToken == "" {
+			errs = append(errs, errors.New("admin_token: required when admin_addr is set"))
+		}
+	}
+	if c.SchemaAddr != "" {
+		if _, _, err := net.SplitHostPort(c.SchemaAddr); err != nil {
+			errs = append(errs, fmt.Errorf("schema_addr: %w", err))
+		}
+		if c.SchemaAddr == c.AdminAddr {
+			errs = append(errs, errors.New("schema_addr: must differ from admin_addr"))
+		}
+	}
+	for _, validate := range validators {
+		if err := validate(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateTopicName checks an MQTT topic name used for publishing
+func ValidateTopicName(topic string) error {
+	if topic == "" {
+		return errors.New("must not be empty")
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("wildcards are not allowed in %q", topic)
+	}
+	if strings.ContainsRune(topic, 0) {
+		return fmt.Errorf("null character in %q", topic)
+	}
+	return nil
+}
+
+// ValidateTopicFilter checks an MQTT topic filter used for subscribing
+func ValidateTopicFilter(filter string) error {
+	if filter == "" {
+		return errors.New("must not be empty")
+	}
+	if strings.ContainsRune(filter, 0) {
+		return fmt.Errorf("null character in %q", filter)
+	}
+
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return fmt.Errorf("'#' must occupy the last level on its own in %q", filter)
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return fmt.Errorf("'+' must occupy a whole level in %q", filter)
+		}
+	}
+	return nil
+}
+
+func isRegistryPath(path string) bool {
+	return path != "" && !strings.HasPrefix(path, ".") && !strings.HasSuffix(path, ".") && !strings.Contains(path, "..")
+}
+
+func isOutputShape(shape string) bool {
+	return slices.Contains(outputShapes, shape)
+}
+
+func isSchemaMode(mode string) bool {
+	return mode == "strict" || mode == "lenient"
+}
+
+func isLogLevel(level string) bool {
+	for _, l := range logLevels {
+		if strings.ToLower(level) == l {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		change     func(c *Config)
+		validators []Validator
+		want       []string
+	}{
+		{name: "defaults", change: func(c *Config) {}},
+		{
+			name:   "every invalid setting is reported",
+			change: func(c *Config) { c.Port = 0; c.LogLevel = "verbose"; c.SubscriptionTopic = "a/#/b" },
+			want:   []string{"port:", "log_level:", "subscription_topic:"},
+		},
+		{
+			name:   "wildcard in a publish topic",
+			change: func(c *Config) { c.PublishTopicTemplate = "{base}/+" },
+			want:   []string{"publish_topic_template: wildcards"},
+		},
+		{
+			name:   "publish timeout",
+			change: func(c *Config) { c.MQTTPublishTimeout = 0 },
+			want:   []string{"mqtt_publish_timeout: must be positive"},
+		},
+		{
+			name:   "disabled sinks are not checked",
+			change: func(c *Config) { c.BatchEnabled = false; c.BatchTopicTemplate = "" },
+		},
+		{
+			name:   "enabled sink without topic",
+			change: func(c *Config) { c.BatchEnabled = true; c.BatchTopicTemplate = "" },
+			want:   []string{"batch_topic_template: must not be empty"},
+		},
+		{
+			name:   "summary per device",
+			change: func(c *Config) { c.SummaryInterval = time.Minute; c.SummaryTopic = "{base}/{deviceId}" },
+			want:   []string{"summary_topic_template: summaries are per site"},
+		},
+		{
+			name:   "aggregate window",
+			change: func(c *Config) { c.AggregateWindows = []time.Duration{1500 * time.Millisecond} },
+			want:   []string{"aggregate_windows: 1.5s is not a whole number of seconds"},
+		},
+		{
+			name:   "unknown sink",
+			change: func(c *Config) { c.Encodings = map[string]string{"other": "json"} },
+			want:   []string{`encodings: unknown sink "other"`},
+		},
+		{
+			name:   "admin without token",
+			change: func(c *Config) { c.AdminAddr = ":8080"; c.AdminToken = "" },
+			want:   []string{"admin_token: required"},
+		},
+		{
+			name:   "schema routes on the admin address",
+			change: func(c *Config) { c.AdminAddr = ":8080"; c.AdminToken = "secret"; c.SchemaAddr = ":8080" },
+			want:   []string{"schema_addr: must differ from admin_addr"},
+		},
+		{
+			name:   "schema routes without the admin API",
+			change: func(c *Config) { c.SchemaAddr = ":8082" },
+		},
+		{
+			name:   "validator errors are reported with the others",
+			change: func(c *Config) { c.Port = 0 },
+			validators: []Validator{
+				func(c *Config) error { return nil },
+				func(c *Config) error { return errors.New("redis_connection_string: invalid") },
+			},
+			want: []string{"port:", "redis_connection_string: invalid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			tt.change(c)
+			err := c.Validate(tt.validators...)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate = nil, want %v", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate = %v, want %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateTopicFilter(t *testing.T) {
+	tests := []struct {
+		filter  string
+		wantErr bool
+	}{
+		{filter: "a/b/c"},
+		{filter: "a/+/c"},
+		{filter: "a/#"},
+		{filter: "#"},
+		{filter: "", wantErr: true},
+		{filter: "a/#/c", wantErr: true},
+		{filter: "a/b#", wantErr: true},
+		{filter: "a/b+/c", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := ValidateTopicFilter(tt.filter); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateTopicFilter(%q) = %v, want error %t", tt.filter, err, tt.wantErr)
+		}
+	}
+}
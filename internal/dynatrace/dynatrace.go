@@ -1,19 +1,34 @@
 package dynatrace
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/apiconstants"
 	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
 	"github.com/dynatrace-oss/dynatrace-metric-utils-go/oneagentenrichment"
 	"github.com/rs/zerolog"
 )
 
+// maxBufferedLines bounds the metric lines kept while the ingest endpoint is unreachable
+const maxBufferedLines = 10000
+
 // DynatraceClient wraps Dynatrace metric functionality
 type DynatraceClient struct {
 	logger  *zerolog.Logger
 	enabled bool
+
+	mu       sync.Mutex
+	lines    []string
+	endpoint string
+	token    string
+	http     *http.Client
 }
 
 // NewDynatraceClient creates a new Dynatrace client
@@ -21,6 +36,107 @@ func NewDynatraceClient(logger *zerolog.Logger) *DynatraceClient {
 	return &DynatraceClient{
 		logger:  logger,
 		enabled: true, // You can make this configurable
+		http:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// WithExporter buffers the serialized metrics and sends them to the given ingest endpoint on Flush,
+// an empty endpoint uses the local OneAgent endpoint and an empty token sends no Authorization header
+func (d *DynatraceClient) WithExporter(endpoint string, token string) *DynatraceClient {
+	if endpoint == "" {
+		endpoint = apiconstants.GetDefaultOneAgentEndpoint()
+	}
+	d.endpoint = endpoint
+	d.token = token
+	return d
+}
+
+// Run flushes the buffered metrics every interval until the context is cancelled
+func (d *DynatraceClient) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := d.Flush(ctx)
+			if err != nil {
+				d.logger.Warn().Err(err).Msg("Failed to flush metrics to Dynatrace")
+			}
+		}
+	}
+}
+
+// Flush sends the buffered metric lines to the ingest endpoint, lines that could not be sent stay buffered
+func (d *DynatraceClient) Flush(ctx context.Context) error {
+	d.mu.Lock()
+	lines := d.lines
+	d.lines = nil
+	d.mu.Unlock()
+
+	for len(lines) > 0 {
+		n := min(len(lines), apiconstants.GetPayloadLinesLimit())
+		err := d.post(ctx, lines[:n])
+		if err != nil {
+			d.requeue(lines)
+			return err
+		}
+		lines = lines[n:]
+	}
+	return nil
+}
+
+func (d *DynatraceClient) post(ctx context.Context, lines []string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.endpoint, bytes.NewBufferString(strings.Join(lines, "\n")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if d.token != "" {
+		req.Header.Set("Authorization", "Api-Token "+d.token)
+	}
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("metrics ingest returned %s", resp.Status)
+	}
+	d.logger.Debug().Msgf("Flushed %d metric lines to Dynatrace", len(lines))
+	return nil
+}
+
+// export buffers a serialized metric line when an exporter is configured
+func (d *DynatraceClient) export(line string) {
+	if line == "" || d.endpoint == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.lines = append(d.lines, line)
+	d.trim()
+}
+
+// requeue puts lines that failed to send back in front of the ones buffered since
+func (d *DynatraceClient) requeue(lines []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.lines = append(lines, d.lines...)
+	d.trim()
+}
+
+// trim drops the oldest lines beyond maxBufferedLines
+func (d *DynatraceClient) trim() {
+	if len(d.lines) > maxBufferedLines {
+		d.lines = d.lines[len(d.lines)-maxBufferedLines:]
 	}
 }
 
@@ -47,17 +163,19 @@ func (d *DynatraceClient) RecordMessageProcessed(topic string, processingTimeMs
 		metric.WithDimensions(enrichedDims),
 		metric.WithDimensions(dims),
 		metric.WithTimestamp(time.Now()),
+		metric.WithIntCounterValueDelta(1),
 	)
 	if err != nil {
 		d.logger.Warn().Err(err).Msg("Failed to create message count metric")
 		return
 	}
 
-	_, err = countMetric.Serialize()
+	line, err := countMetric.Serialize()
 	if err != nil {
 		d.logger.Warn().Err(err).Msg("Failed to serialize message count metric")
 		return
 	}
+	d.export(line)
 
 	// Create and send gauge metric for processing time
 	if processingTimeMs > 0 {
@@ -67,11 +185,16 @@ func (d *DynatraceClient) RecordMessageProcessed(topic string, processingTimeMs
 			metric.WithTimestamp(time.Now()),
 			metric.WithFloatGaugeValue(processingTimeMs),
 		)
+		if err != nil {
+			d.logger.Warn().Err(err).Msg("Failed to create processing time metric")
+			return
+		}
 
-		_, err = timeMetric.Serialize()
+		line, err := timeMetric.Serialize()
 		if err != nil {
 			d.logger.Warn().Err(err).Msg("Failed to serialize processing time metric")
 		}
+		d.export(line)
 
 	}
 
@@ -102,17 +225,19 @@ func (d *DynatraceClient) RecordError(errorType, topic string) {
 		metric.WithDimensions(enrichedDims),
 		metric.WithDimensions(dims),
 		metric.WithTimestamp(time.Now()),
+		metric.WithIntCounterValueDelta(1),
 	)
 
 	if err != nil {
 		d.logger.Warn().Err(err).Msg("Failed to create error metric")
 		return
 	}
-	_, err = errorMetric.Serialize()
+	line, err := errorMetric.Serialize()
 	if err != nil {
 		d.logger.Warn().Err(err).Msg("Failed to serialize error metric")
 		return
 	}
+	d.export(line)
 
 	d.logger.Debug().
 		Str("error_type", errorType).
@@ -152,11 +277,12 @@ func (d *DynatraceClient) RecordConnectionStatus(service string, connected bool)
 		return
 	}
 
-	_, err = statusMetric.Serialize()
+	line, err := statusMetric.Serialize()
 	if err != nil {
 		d.logger.Warn().Err(err).Msg("Failed to serialize connection status metric")
 		return
 	}
+	d.export(line)
 
 	d.logger.Debug().
 		Str("service", service).
@@ -164,6 +290,45 @@ func (d *DynatraceClient) RecordConnectionStatus(service string, connected bool)
 		Msg("Sent connection status metric to Dynatrace")
 }
 
+// RecordConnectionEvent counts connection lifecycle events such as reconnections and resubscriptions
+func (d *DynatraceClient) RecordConnectionEvent(service string, event string) {
+	if !d.enabled {
+		return
+	}
+
+	dims := dimensions.NewNormalizedDimensionList(
+		dimensions.NewDimension("service_type", service),
+		dimensions.NewDimension("event", event),
+		dimensions.NewDimension("application", "data-enricher"),
+	)
+
+	enrichedDims := oneagentenrichment.GetOneAgentMetadata()
+
+	eventMetric, err := metric.NewMetric(
+		"dataenricher.connection.events.count",
+		metric.WithDimensions(enrichedDims),
+		metric.WithDimensions(dims),
+		metric.WithTimestamp(time.Now()),
+		metric.WithIntCounterValueDelta(1),
+	)
+	if err != nil {
+		d.logger.Warn().Err(err).Msg("Failed to create connection event metric")
+		return
+	}
+
+	line, err := eventMetric.Serialize()
+	if err != nil {
+		d.logger.Warn().Err(err).Msg("Failed to serialize connection event metric")
+		return
+	}
+	d.export(line)
+
+	d.logger.Debug().
+		Str("service", service).
+		Str("event", event).
+		Msg("Sent connection event metric to Dynatrace")
+}
+
 // RecordCacheOperation sends Redis cache operation metrics
 func (d *DynatraceClient) RecordCacheOperation(operation string, success bool, durationMs float64) {
 	if !d.enabled {
@@ -186,15 +351,17 @@ func (d *DynatraceClient) RecordCacheOperation(operation string, success bool, d
 		metric.WithDimensions(enrichedDims),
 		metric.WithDimensions(dims),
 		metric.WithTimestamp(time.Now()),
+		metric.WithIntCounterValueDelta(1),
 	)
 	if err != nil {
 		d.logger.Warn().Err(err).Msg("Failed to create cache operation count metric")
 		return
 	}
-	_, err = countMetric.Serialize()
+	line, err := countMetric.Serialize()
 	if err != nil {
 		d.logger.Warn().Err(err).Msg("Failed to serialize cache operation count metric")
 	}
+	d.export(line)
 
 	// Send operation duration if provided
 	if durationMs > 0 {
@@ -209,11 +376,120 @@ func (d *DynatraceClient) RecordCacheOperation(operation string, success bool, d
 			d.logger.Warn().Err(err).Msg("Failed to create cache operation duration metric")
 			return
 		}
-		_, err = durationMetric.Serialize()
+		line, err := durationMetric.Serialize()
 		if err != nil {
 			d.logger.Warn().Err(err).Msg("Failed to serialize cache operation duration metric")
 		}
+		d.export(line)
+	}
+}
+
+// RecordConfigReload sends the outcome of a configuration reload
+func (d *DynatraceClient) RecordConfigReload(outcome string) {
+	if !d.enabled {
+		return
+	}
+
+	dims := dimensions.NewNormalizedDimensionList(
+		dimensions.NewDimension("outcome", outcome),
+		dimensions.NewDimension("service", "data-enricher"),
+	)
+
+	enrichedDims := oneagentenrichment.GetOneAgentMetadata()
+
+	reloadMetric, err := metric.NewMetric(
+		"dataenricher.config.reloads.count",
+		metric.WithDimensions(enrichedDims),
+		metric.WithDimensions(dims),
+		metric.WithTimestamp(time.Now()),
+		metric.WithIntCounterValueDelta(1),
+	)
+	if err != nil {
+		d.logger.Warn().Err(err).Msg("Failed to create config reload metric")
+		return
+	}
+	line, err := reloadMetric.Serialize()
+	if err != nil {
+		d.logger.Warn().Err(err).Msg("Failed to serialize config reload metric")
+		return
+	}
+	d.export(line)
+
+	d.logger.Debug().
+		Str("outcome", outcome).
+		Msg("Sent config reload metric to Dynatrace")
+}
+
+// RecordOutboxBacklog sends the number of messages and bytes waiting in the publish outbox
+func (d *DynatraceClient) RecordOutboxBacklog(records int, bytes int64) {
+	if !d.enabled {
+		return
+	}
+
+	dims := dimensions.NewNormalizedDimensionList(
+		dimensions.NewDimension("service", "data-enricher"),
+	)
+
+	enrichedDims := oneagentenrichment.GetOneAgentMetadata()
+
+	for name, value := range map[string]float64{
+		"dataenricher.outbox.backlog.messages": float64(records),
+		"dataenricher.outbox.backlog.bytes":    float64(bytes),
+	} {
+		backlogMetric, err := metric.NewMetric(
+			name,
+			metric.WithDimensions(enrichedDims),
+			metric.WithDimensions(dims),
+			metric.WithTimestamp(time.Now()),
+			metric.WithFloatGaugeValue(value),
+		)
+		if err != nil {
+			d.logger.Warn().Err(err).Msg("Failed to create outbox backlog metric")
+			return
+		}
+		line, err := backlogMetric.Serialize()
+		if err != nil {
+			d.logger.Warn().Err(err).Msg("Failed to serialize outbox backlog metric")
+			return
+		}
+		d.export(line)
+	}
+
+	d.logger.Debug().
+		Int("records", records).
+		Int64("bytes", bytes).
+		Msg("Sent outbox backlog metric to Dynatrace")
+}
+
+// RecordDedupFailOpen counts a message processed without deduplication because the seen set was unavailable
+func (d *DynatraceClient) RecordDedupFailOpen() {
+	if !d.enabled {
+		return
+	}
+
+	dims := dimensions.NewNormalizedDimensionList(
+		dimensions.NewDimension("service", "data-enricher"),
+	)
+
+	enrichedDims := oneagentenrichment.GetOneAgentMetadata()
+
+	failOpenMetric, err := metric.NewMetric(
+		"dataenricher.dedup.failopen.count",
+		metric.WithDimensions(enrichedDims),
+		metric.WithDimensions(dims),
+		metric.WithTimestamp(time.Now()),
+		metric.WithIntCounterValueDelta(1),
+	)
+	if err != nil {
+		d.logger.Warn().Err(err).Msg("Failed to create dedup fail open metric")
+		return
+	}
+	line, err := failOpenMetric.Serialize()
+	if err != nil {
+		d.logger.Warn().Err(err).Msg("Failed to serialize dedup fail open metric")
+		return
 	}
+	d.export(line)
 }
 
 // Disable disables metric collection
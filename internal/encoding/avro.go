@@ -0,0 +1,280 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hamba/avro/v2"
+)
+
+// avroNamespace is the namespace of the Avro records
+const avroNamespace = "dataenricher"
+
+// AvroSchema returns the Avro writer schema of a message type, the records nested in it are defined inline
+func AvroSchema(name string) (string, error) {
+	s, err := lookupSchema(name)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(avroRecordType(s, make(map[string]bool)))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// AvroSchemaID returns the schema ID of a message type given the ID of the first one, false when the
+// message type is unknown
+func AvroSchemaID(baseID int, name string) (int, bool) {
+	for i, s := range Schemas {
+		if s == name {
+			return baseID + i, true
+		}
+	}
+	return 0, false
+}
+
+// ValidateAvroSchemaID checks the ID of the first message type, every message type gets its own ID counting up
+// from it and the IDs must fit the 4 bytes of the wire format header
+func ValidateAvroSchemaID(baseID int) error {
+	if maxID := math.MaxUint32 - len(Schemas) + 1; baseID < 0 || baseID > maxID {
+		return fmt.Errorf("must be between 0 and %d, got %d", maxID, baseID)
+	}
+	return nil
+}
+
+// AvroSchemaByID returns the Avro writer schema with the given ID, given the ID of the first one, false when
+// no message type has that ID
+func AvroSchemaByID(baseID int, id int) (string, bool) {
+	i := id - baseID
+	if i < 0 || i >= len(Schemas) {
+		return "", false
+	}
+	schema, err := AvroSchema(Schemas[i])
+	return schema, err == nil
+}
+
+func avroRecordType(s Schema, defined map[string]bool) any {
+	if defined[s.Name] {
+		return avroNamespace + "." + s.Name
+	}
+	defined[s.Name] = true
+
+	fields := make([]any, 0, len(s.Fields)+1)
+	for _, f := range s.Fields {
+		field := map[string]any{"name": f.Name, "type": avroFieldType(f, defined)}
+		if f.Optional {
+			field["type"] = []any{"null", field["type"]}
+			field["default"] = nil
+		}
+		fields = append(fields, field)
+	}
+	if s.Extra != "" {
+		// The extra members are free-form, they are written as JSON text
+		fields = append(fields, map[string]any{"name": s.Extra, "type": map[string]any{"type": "map", "values": "string"}})
+	}
+	return map[string]any{"type": "record", "name": s.Name, "namespace": avroNamespace, "fields": fields}
+}
+
+func avroFieldType(f Field, defined map[string]bool) any {
+	var t any
+	switch f.Kind {
+	case KindLong:
+		t = "long"
+	case KindDouble:
+		t = "double"
+	case KindBoolean:
+		t = "boolean"
+	case KindTime:
+		t = map[string]any{"type": "long", "logicalType": "timestamp-millis"}
+	case KindRecord:
+		t = avroRecordType(schemas[f.Record], defined)
+	default:
+		// KindJSON values are written as JSON text
+		t = "string"
+	}
+
+	switch {
+	case f.Repeated:
+		return map[string]any{"type": "array", "items": t}
+	case f.Map:
+		return map[string]any{"type": "map", "values": t}
+	default:
+		return t
+	}
+}
+
+// avroEncoder writes the documents with the schema of their message type, prefixed by the Confluent wire format
+// header (magic byte 0 and the big endian schema ID)
+type avroEncoder struct {
+	schemas map[string]avro.Schema
+	ids     map[string]int
+}
+
+func newAvroEncoder(baseID int) (*avroEncoder, error) {
+	e := &avroEncoder{schemas: make(map[string]avro.Schema), ids: make(map[string]int)}
+	for i, name := range Schemas {
+		text, err := AvroSchema(name)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := avro.Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("avro schema %s: %w", name, err)
+		}
+		e.schemas[name] = schema
+		e.ids[name] = baseID + i
+	}
+	return e, nil
+}
+
+func (e *avroEncoder) Name() string        { return Avro }
+func (e *avroEncoder) ContentType() string { return "application/vnd.confluent.avro" }
+
+func (e *avroEncoder) Encode(schema string, doc []byte) ([]byte, error) {
+	s, err := lookupSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	v, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	record, err := reshape(s, v)
+	if err != nil {
+		return nil, err
+	}
+	value, err := avroRecord(s, record)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", schema, err)
+	}
+	body, err := avro.Marshal(e.schemas[schema], value)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(0)
+	binary.Write(&buf, binary.BigEndian, uint32(e.ids[schema]))
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+// avroRecord converts a decoded JSON object to the Go values the Avro record of the schema is written from
+func avroRecord(s Schema, doc map[string]any) (map[string]any, error) {
+	out := make(map[string]any, len(s.Fields)+1)
+	for _, f := range s.Fields {
+		v, err := avroField(f, doc[f.Name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		out[f.Name] = v
+	}
+	if s.Extra != "" {
+		extra, _ := doc[s.Extra].(map[string]any)
+		values := make(map[string]any, len(extra))
+		for name, v := range extra {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			values[name] = string(b)
+		}
+		out[s.Extra] = values
+	}
+	return out, nil
+}
+
+func avroField(f Field, v any) (any, error) {
+	if v == nil && f.Optional {
+		return nil, nil
+	}
+
+	switch {
+	case f.Repeated:
+		items, ok := v.([]any)
+		if !ok && v != nil {
+			return nil, fmt.Errorf("expected an array, got %T", v)
+		}
+		out := make([]any, len(items))
+		for i, item := range items {
+			value, err := avroValue(f, item)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %w", i, err)
+			}
+			out[i] = value
+		}
+		return out, nil
+	case f.Map:
+		values, ok := v.(map[string]any)
+		if !ok && v != nil {
+			return nil, fmt.Errorf("expected an object, got %T", v)
+		}
+		out := make(map[string]any, len(values))
+		for key, item := range values {
+			value, err := avroValue(f, item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			out[key] = value
+		}
+		return out, nil
+	default:
+		return avroValue(f, v)
+	}
+}
+
+// avroValue converts a single value of a field, a missing value is written as the zero value of its type
+func avroValue(f Field, v any) (any, error) {
+	switch f.Kind {
+	case KindString:
+		s, ok := v.(string)
+		if !ok && v != nil {
+			return nil, fmt.Errorf("expected a string, got %T", v)
+		}
+		return s, nil
+	case KindLong:
+		n, ok := v.(float64)
+		if !ok && v != nil {
+			return nil, fmt.Errorf("expected a number, got %T", v)
+		}
+		return int64(n), nil
+	case KindDouble:
+		n, ok := v.(float64)
+		if !ok && v != nil {
+			return nil, fmt.Errorf("expected a number, got %T", v)
+		}
+		return n, nil
+	case KindBoolean:
+		b, ok := v.(bool)
+		if !ok && v != nil {
+			return nil, fmt.Errorf("expected a boolean, got %T", v)
+		}
+		return b, nil
+	case KindTime:
+		s, ok := v.(string)
+		if !ok {
+			if v != nil {
+				return nil, fmt.Errorf("expected a timestamp, got %T", v)
+			}
+			return time.Time{}, nil
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	case KindRecord:
+		doc, ok := v.(map[string]any)
+		if !ok && v != nil {
+			return nil, fmt.Errorf("expected an object, got %T", v)
+		}
+		return avroRecord(schemas[f.Record], doc)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+}
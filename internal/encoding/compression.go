@@ -0,0 +1,133 @@
+package encoding
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression names
+const (
+	Gzip   = "gzip"
+	Zstd   = "zstd"
+	Snappy = "snappy"
+)
+
+// Compressions lists the supported compressions
+var Compressions = []string{Gzip, Zstd, Snappy}
+
+var (
+	gzipMagic   = []byte{0x1f, 0x8b}
+	zstdMagic   = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	snappyMagic = []byte("\xff\x06\x00\x00sNaPpY")
+)
+
+// MaxDecompressedBytes bounds the size of a decompressed message
+const MaxDecompressedBytes = 64 << 20
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxDecompressedBytes))
+)
+
+// Compressor compresses the messages of at least threshold bytes, snappy uses the framing format so
+// every compression starts with its magic bytes
+type Compressor struct {
+	name      string
+	threshold int
+}
+
+// ValidateCompression checks a compression name
+func ValidateCompression(name string) error {
+	if !slices.Contains(Compressions, name) {
+		return fmt.Errorf("must be one of %s, got %q", strings.Join(Compressions, ", "), name)
+	}
+	return nil
+}
+
+// NewCompressor returns the compressor with the given name
+func NewCompressor(name string, threshold int) (*Compressor, error) {
+	switch name {
+	case Gzip, Zstd, Snappy:
+		return &Compressor{name: name, threshold: threshold}, nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q", name)
+	}
+}
+
+func (c *Compressor) Name() string {
+	return c.name
+}
+
+// Compress returns the compressed message and true, or the message unchanged and false when it is below
+// the threshold
+func (c *Compressor) Compress(b []byte) ([]byte, bool, error) {
+	if len(b) < c.threshold {
+		return b, false, nil
+	}
+
+	switch c.name {
+	case Zstd:
+		return zstdEncoder.EncodeAll(b, nil), true, nil
+	case Snappy:
+		var buf bytes.Buffer
+		w := snappy.NewBufferedWriter(&buf)
+		if _, err := w.Write(b); err != nil {
+			return nil, false, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, false, err
+		}
+		return buf.Bytes(), true, nil
+	default:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(b); err != nil {
+			return nil, false, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, false, err
+		}
+		return buf.Bytes(), true, nil
+	}
+}
+
+// Decompress detects a gzip, zstd or framed snappy message by its magic bytes and decompresses it, other
+// messages are returned unchanged with an empty compression name
+func Decompress(b []byte) ([]byte, string, error) {
+	switch {
+	case bytes.HasPrefix(b, gzipMagic):
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, Gzip, err
+		}
+		defer r.Close()
+		out, err := readAll(r)
+		return out, Gzip, err
+	case bytes.HasPrefix(b, zstdMagic):
+		out, err := zstdDecoder.DecodeAll(b, nil)
+		return out, Zstd, err
+	case bytes.HasPrefix(b, snappyMagic):
+		out, err := readAll(snappy.NewReader(bytes.NewReader(b)))
+		return out, Snappy, err
+	default:
+		return b, "", nil
+	}
+}
+
+func readAll(r io.Reader) ([]byte, error) {
+	out, err := io.ReadAll(io.LimitReader(r, MaxDecompressedBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > MaxDecompressedBytes {
+		return nil, fmt.Errorf("decompressed message exceeds %d bytes", MaxDecompressedBytes)
+	}
+	return out, nil
+}
@@ -0,0 +1,103 @@
+// Package encoding converts the JSON documents built by the enricher to the wire format of a sink
+package encoding
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Encoding names
+const (
+	JSON        = "json"
+	Protobuf    = "protobuf"
+	Avro        = "avro"
+	CBOR        = "cbor"
+	MessagePack = "msgpack"
+)
+
+// Names lists the supported encodings
+var Names = []string{JSON, Protobuf, Avro, CBOR, MessagePack}
+
+// Encoder converts a JSON document to a wire format, schema names the message type of the document, one of
+// Schemas, the schemaless encodings ignore it
+type Encoder interface {
+	Name() string
+	ContentType() string
+	Encode(schema string, doc []byte) ([]byte, error)
+}
+
+// Options configures the encoders
+type Options struct {
+	// AvroSchemaID is the schema ID of the first message type of Schemas, the following types get the next IDs,
+	// it is written in the Confluent wire format header of Avro messages
+	AvroSchemaID int
+}
+
+// ValidateName checks an encoding name
+func ValidateName(name string) error {
+	if !slices.Contains(Names, name) {
+		return fmt.Errorf("must be one of %s, got %q", strings.Join(Names, ", "), name)
+	}
+	return nil
+}
+
+// New returns the encoder with the given name
+func New(name string, opts Options) (Encoder, error) {
+	switch name {
+	case JSON, "":
+		return jsonEncoder{}, nil
+	case Protobuf:
+		return newProtobufEncoder()
+	case Avro:
+		return newAvroEncoder(opts.AvroSchemaID)
+	case CBOR:
+		return cborEncoder{}, nil
+	case MessagePack:
+		return msgpackEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+}
+
+func decode(doc []byte) (any, error) {
+	var v any
+	err := json.Unmarshal(doc, &v)
+	return v, err
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Name() string                                { return JSON }
+func (jsonEncoder) ContentType() string                         { return "application/json" }
+func (jsonEncoder) Encode(_ string, doc []byte) ([]byte, error) { return doc, nil }
+
+type cborEncoder struct{}
+
+func (cborEncoder) Name() string        { return CBOR }
+func (cborEncoder) ContentType() string { return "application/cbor" }
+
+func (cborEncoder) Encode(_ string, doc []byte) ([]byte, error) {
+	v, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.Marshal(v)
+}
+
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) Name() string        { return MessagePack }
+func (msgpackEncoder) ContentType() string { return "application/msgpack" }
+
+func (msgpackEncoder) Encode(_ string, doc []byte) ([]byte, error) {
+	v, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(v)
+}
@@ -0,0 +1,249 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestSchemas(t *testing.T) {
+	file, err := protoFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range Schemas {
+		text, err := AvroSchema(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := avro.Parse(text); err != nil {
+			t.Errorf("avro schema %s: %v", name, err)
+		}
+		if file.Messages().ByName(protoreflect.Name(name)) == nil {
+			t.Errorf("no protobuf message %s", name)
+		}
+		if !strings.Contains(ProtoFile(), "message "+name+" {") {
+			t.Errorf("no message %s in the .proto file", name)
+		}
+	}
+}
+
+func TestAvroSchemaByID(t *testing.T) {
+	tests := []struct {
+		id   int
+		want string
+		ok   bool
+	}{
+		{id: 9, ok: false},
+		{id: 10, want: SchemaEnrichedMessage, ok: true},
+		{id: 14, want: SchemaAlert, ok: true},
+		{id: 10 + len(Schemas), ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := AvroSchemaByID(10, tt.id)
+		if ok != tt.ok {
+			t.Errorf("AvroSchemaByID(%d) found = %t, want %t", tt.id, ok, tt.ok)
+			continue
+		}
+		if ok && !strings.Contains(got, `"name":"`+tt.want+`"`) {
+			t.Errorf("AvroSchemaByID(%d) = %s, want the %s schema", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestAvroEncode(t *testing.T) {
+	opened := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		schema  string
+		doc     string
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			name:   "enriched message",
+			schema: SchemaEnrichedMessage,
+			doc:    `{"source_topic":"in","device_id":"d1","site_code":"s1","data":{"a":1},"DataModel":"geokonapi","ingest_time":"2024-05-01T10:00:00Z","latency_ms":1.5,"zone":"north"}`,
+			want: map[string]any{
+				"source_topic": "in",
+				"device_id":    "d1",
+				"site_code":    "s1",
+				"data":         `{"a":1}`,
+				"registry":     nil,
+				"DataModel":    "geokonapi",
+				"ingest_time":  opened,
+				"latency_ms":   1.5,
+				"fields":       map[string]any{"zone": `"north"`},
+			},
+		},
+		{
+			name:   "metric records",
+			schema: SchemaMetricRecords,
+			doc:    `[{"time":"2024-05-01T10:00:00Z","metric":"t","unit":"C","value":20.5,"siteCode":"s1","deviceId":"d1"}]`,
+			want: map[string]any{
+				"records": []any{map[string]any{
+					"time":               opened,
+					"metric":             "t",
+					"unit":               "C",
+					"value":              20.5,
+					"siteCode":           "s1",
+					"deviceId":           "d1",
+					"engineeringValue":   nil,
+					"engineeringUnit":    nil,
+					"calibrationVersion": nil,
+					"skew":               nil,
+					"sequence":           nil,
+					"anomalyScore":       nil,
+				}},
+			},
+		},
+		{
+			name:   "batch",
+			schema: SchemaBatch,
+			doc:    `{"key":"k","count":2,"opened":"2024-05-01T10:00:00Z","closed":"2024-05-01T10:00:00Z","messages":[{"a":1},[2]]}`,
+			want: map[string]any{
+				"key":      "k",
+				"count":    int64(2),
+				"opened":   opened,
+				"closed":   opened,
+				"messages": []any{`{"a":1}`, `[2]`},
+			},
+		},
+		{
+			name:    "wrong type",
+			schema:  SchemaAlert,
+			doc:     `{"value":"high"}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown schema",
+			schema:  "Unknown",
+			doc:     `{}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := New(Avro, Options{AvroSchemaID: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := encoder.Encode(tt.schema, []byte(tt.doc))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Encode error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			wantID, _ := AvroSchemaID(10, tt.schema)
+			if b[0] != 0 || int(binary.BigEndian.Uint32(b[1:5])) != wantID {
+				t.Errorf("header = %v, want schema ID %d", b[:5], wantID)
+			}
+			text, _ := AvroSchema(tt.schema)
+			schema := avro.MustParse(text)
+			var got map[string]any
+			if err := avro.Unmarshal(schema, b[5:], &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decoded = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtobufEncode(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		doc     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "enriched message",
+			schema: SchemaEnrichedMessage,
+			doc:    `{"source_topic":"in","device_id":"d1","site_code":"s1","data":{"a":1},"DataModel":"geokonapi","zone":"north"}`,
+			want:   `{"source_topic":"in","device_id":"d1","site_code":"s1","data":{"a":1},"DataModel":"geokonapi","fields":{"zone":"north"}}`,
+		},
+		{
+			name:   "alert",
+			schema: SchemaAlert,
+			doc:    `{"event":"raised","level":"high","previousLevel":"normal","time":"2024-05-01T10:00:00Z","deviceId":"d1","siteCode":"s1","metric":"t","unit":"C","value":0,"threshold":30}`,
+			want:   `{"event":"raised","level":"high","previousLevel":"normal","time":"2024-05-01T10:00:00Z","deviceId":"d1","siteCode":"s1","metric":"t","unit":"C","threshold":30}`,
+		},
+		{
+			name:   "site summary",
+			schema: SchemaSiteSummary,
+			doc:    `{"siteCode":"s1","activeDevices":2,"devices":{"d1":{"values":{"t":20.5},"units":{"t":"C"}}}}`,
+			want:   `{"siteCode":"s1","activeDevices":"2","devices":{"d1":{"values":{"t":20.5},"units":{"t":"C"}}}}`,
+		},
+		{
+			name:    "wrong type",
+			schema:  SchemaGap,
+			doc:     `{"missedReports":"many"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := New(Protobuf, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := encoder.Encode(tt.schema, []byte(tt.doc))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Encode error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var packed anypb.Any
+			if err := proto.Unmarshal(b, &packed); err != nil {
+				t.Fatal(err)
+			}
+			if want := "type.googleapis.com/" + protoPackage + "." + tt.schema; packed.TypeUrl != want {
+				t.Errorf("type URL = %s, want %s", packed.TypeUrl, want)
+			}
+			file, _ := protoFile()
+			msg := dynamicpb.NewMessage(file.Messages().ByName(protoreflect.Name(tt.schema)))
+			if err := proto.Unmarshal(packed.Value, msg); err != nil {
+				t.Fatal(err)
+			}
+			got, err := protojson.Marshal(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotValue, wantValue any
+			json.Unmarshal(got, &gotValue)
+			json.Unmarshal([]byte(tt.want), &wantValue)
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("decoded = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemalessEncoders(t *testing.T) {
+	for _, name := range []string{JSON, CBOR, MessagePack} {
+		encoder, err := New(name, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := encoder.Encode("Unknown", []byte(`{"a":[1,"b",null]}`)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package encoding
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// protoPackage is the package of the protobuf messages, the name of the Avro namespace
+const protoPackage = avroNamespace
+
+// protoFile returns the descriptor of the protobuf messages, built once from the schemas
+var protoFile = sync.OnceValues(func() (protoreflect.FileDescriptor, error) {
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String(protoPackage + ".proto"),
+		Package: proto.String(protoPackage),
+		Syntax:  proto.String("proto3"),
+		Dependency: []string{
+			structpb.File_google_protobuf_struct_proto.Path(),
+			timestamppb.File_google_protobuf_timestamp_proto.Path(),
+		},
+	}
+	for _, name := range sortedSchemaNames() {
+		fd.MessageType = append(fd.MessageType, protoMessage(schemas[name]))
+	}
+	return protodesc.NewFile(fd, protoregistry.GlobalFiles)
+})
+
+func sortedSchemaNames() []string {
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// protoFields returns the fields of a schema with the Extra field last, numbered from 1 in that order
+func protoFields(s Schema) []Field {
+	fields := s.Fields
+	if s.Extra != "" {
+		fields = append(slices.Clip(fields), Field{Name: s.Extra, Kind: KindJSON, Map: true})
+	}
+	return fields
+}
+
+func protoMessage(s Schema) *descriptorpb.DescriptorProto {
+	m := &descriptorpb.DescriptorProto{Name: proto.String(s.Name)}
+	for i, f := range protoFields(s) {
+		field := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(f.Name),
+			JsonName: proto.String(f.Name),
+			Number:   proto.Int32(int32(i + 1)),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		protoType(field, f)
+
+		switch {
+		case f.Map:
+			entry := &descriptorpb.DescriptorProto{
+				Name:    proto.String(mapEntryName(f.Name)),
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("key"),
+						JsonName: proto.String("key"),
+						Number:   proto.Int32(1),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					},
+					{
+						Name:     proto.String("value"),
+						JsonName: proto.String("value"),
+						Number:   proto.Int32(2),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     field.Type,
+						TypeName: field.TypeName,
+					},
+				},
+			}
+			m.NestedType = append(m.NestedType, entry)
+			field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+			field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+			field.TypeName = proto.String("." + protoPackage + "." + s.Name + "." + entry.GetName())
+		case f.Repeated:
+			field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		case f.Optional && field.GetType() != descriptorpb.FieldDescriptorProto_TYPE_MESSAGE:
+			// Optional scalars are proto3 optional fields so a missing value is told apart from the zero value
+			field.Proto3Optional = proto.Bool(true)
+			field.OneofIndex = proto.Int32(int32(len(m.OneofDecl)))
+			m.OneofDecl = append(m.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String("_" + f.Name)})
+		}
+		m.Field = append(m.Field, field)
+	}
+	return m
+}
+
+func protoType(field *descriptorpb.FieldDescriptorProto, f Field) {
+	switch f.Kind {
+	case KindString:
+		field.Type = descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+	case KindLong:
+		field.Type = descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum()
+	case KindDouble:
+		field.Type = descriptorpb.FieldDescriptorProto_TYPE_DOUBLE.Enum()
+	case KindBoolean:
+		field.Type = descriptorpb.FieldDescriptorProto_TYPE_BOOL.Enum()
+	default:
+		field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		field.TypeName = proto.String("." + protoTypeName(f))
+	}
+}
+
+// protoTypeName returns the full name of the protobuf type of a single value of a field
+func protoTypeName(f Field) string {
+	switch f.Kind {
+	case KindString:
+		return "string"
+	case KindLong:
+		return "int64"
+	case KindDouble:
+		return "double"
+	case KindBoolean:
+		return "bool"
+	case KindTime:
+		return string((&timestamppb.Timestamp{}).ProtoReflect().Descriptor().FullName())
+	case KindRecord:
+		return protoPackage + "." + f.Record
+	default:
+		return string((&structpb.Value{}).ProtoReflect().Descriptor().FullName())
+	}
+}
+
+// mapEntryName is the name protoc gives the entry message of a map field
+func mapEntryName(field string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range field {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = []rune(strings.ToUpper(string(r)))[0]
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String() + "Entry"
+}
+
+// ProtoFile returns the .proto definition of the protobuf messages
+func ProtoFile() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "syntax = \"proto3\";\n\npackage %s;\n\n", protoPackage)
+	fmt.Fprintf(&b, "import %q;\nimport %q;\n", structpb.File_google_protobuf_struct_proto.Path(), timestamppb.File_google_protobuf_timestamp_proto.Path())
+	for _, name := range sortedSchemaNames() {
+		fmt.Fprintf(&b, "\nmessage %s {\n", name)
+		for i, f := range protoFields(schemas[name]) {
+			typeName := protoTypeName(f)
+			if f.Kind == KindRecord {
+				typeName = f.Record
+			}
+			switch {
+			case f.Map:
+				fmt.Fprintf(&b, "  map<string, %s> %s = %d;\n", typeName, f.Name, i+1)
+			case f.Repeated:
+				fmt.Fprintf(&b, "  repeated %s %s = %d;\n", typeName, f.Name, i+1)
+			case f.Optional && f.Kind != KindTime && f.Kind != KindJSON && f.Kind != KindRecord:
+				fmt.Fprintf(&b, "  optional %s %s = %d;\n", typeName, f.Name, i+1)
+			default:
+				fmt.Fprintf(&b, "  %s %s = %d;\n", typeName, f.Name, i+1)
+			}
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// protobufEncoder writes the documents as the protobuf message of their type packed in a google.protobuf.Any,
+// the type URL names the message, e.g. type.googleapis.com/dataenricher.EnrichedMessage
+type protobufEncoder struct {
+	file protoreflect.FileDescriptor
+}
+
+func newProtobufEncoder() (*protobufEncoder, error) {
+	file, err := protoFile()
+	if err != nil {
+		return nil, fmt.Errorf("protobuf schemas: %w", err)
+	}
+	return &protobufEncoder{file: file}, nil
+}
+
+func (e *protobufEncoder) Name() string { return Protobuf }
+func (e *protobufEncoder) ContentType() string {
+	return "application/x-protobuf; messageType=google.protobuf.Any"
+}
+
+func (e *protobufEncoder) Encode(schema string, doc []byte) ([]byte, error) {
+	msg, err := e.message(schema, doc)
+	if err != nil {
+		return nil, err
+	}
+	packed, err := anypb.New(msg)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(packed)
+}
+
+// message converts a JSON document to the protobuf message of its schema
+func (e *protobufEncoder) message(schema string, doc []byte) (*dynamicpb.Message, error) {
+	s, err := lookupSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	md := e.file.Messages().ByName(protoreflect.Name(schema))
+	if md == nil {
+		return nil, fmt.Errorf("unknown schema %q", schema)
+	}
+
+	v, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	record, err := reshape(s, v)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamicpb.NewMessage(md)
+	err = protojson.Unmarshal(b, msg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", schema, err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,272 @@
+package encoding
+
+import "fmt"
+
+// Kind is the type of a schema field
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindLong
+	KindDouble
+	KindBoolean
+	// KindTime is an RFC3339 timestamp
+	KindTime
+	// KindJSON is a free-form JSON value, such as the inbound payload or the registry entry
+	KindJSON
+	// KindRecord is a nested record, named by Field.Record
+	KindRecord
+)
+
+// Field is a member of the JSON documents of a schema, Name is the JSON member name
+type Field struct {
+	Name     string
+	Kind     Kind
+	Record   string
+	Optional bool
+	Repeated bool
+	Map      bool
+}
+
+// Schema describes the JSON documents of a published message type, the Avro and protobuf schemas are built
+// from it
+type Schema struct {
+	Name   string
+	Fields []Field
+	// Extra collects the top-level members without a field, as JSON values keyed by member name
+	Extra string
+	// Items is set for the documents that are JSON arrays, the array is the value of this field
+	Items string
+}
+
+// Names of the published message types
+const (
+	SchemaEnrichedMessage = "EnrichedMessage"
+	SchemaMetricRecords   = "MetricRecords"
+	SchemaBatch           = "BatchEnvelope"
+	SchemaDeadLetter      = "DeadLetter"
+	SchemaAlert           = "Alert"
+	SchemaDeviceStatus    = "DeviceStatus"
+	SchemaAggregate       = "Aggregate"
+	SchemaSiteSummary     = "SiteSummary"
+	SchemaGap             = "Gap"
+	SchemaAnomaly         = "Anomaly"
+)
+
+// Schemas are the published message types, in the order of their Avro schema IDs, new types are appended so
+// the IDs of the existing ones do not change
+var Schemas = []string{
+	SchemaEnrichedMessage,
+	SchemaMetricRecords,
+	SchemaBatch,
+	SchemaDeadLetter,
+	SchemaAlert,
+	SchemaDeviceStatus,
+	SchemaAggregate,
+	SchemaSiteSummary,
+	SchemaGap,
+	SchemaAnomaly,
+}
+
+// schemas holds the published message types and the records nested in them
+var schemas = map[string]Schema{
+	SchemaEnrichedMessage: {
+		Name: SchemaEnrichedMessage,
+		Fields: []Field{
+			{Name: "source_topic", Kind: KindString},
+			{Name: "device_id", Kind: KindString},
+			{Name: "site_code", Kind: KindString},
+			{Name: "data", Kind: KindJSON},
+			{Name: "registry", Kind: KindJSON, Optional: true},
+			{Name: "DataModel", Kind: KindString},
+			{Name: "ingest_time", Kind: KindTime, Optional: true},
+			{Name: "latency_ms", Kind: KindDouble, Optional: true},
+		},
+		Extra: "fields",
+	},
+	SchemaMetricRecords: {
+		Name:   SchemaMetricRecords,
+		Fields: []Field{{Name: "records", Kind: KindRecord, Record: "MetricRecord", Repeated: true}},
+		Items:  "records",
+	},
+	"MetricRecord": {
+		Name: "MetricRecord",
+		Fields: []Field{
+			{Name: "time", Kind: KindTime},
+			{Name: "metric", Kind: KindString},
+			{Name: "unit", Kind: KindString},
+			{Name: "value", Kind: KindDouble},
+			{Name: "siteCode", Kind: KindString},
+			{Name: "deviceId", Kind: KindString},
+			{Name: "engineeringValue", Kind: KindDouble, Optional: true},
+			{Name: "engineeringUnit", Kind: KindString, Optional: true},
+			{Name: "calibrationVersion", Kind: KindString, Optional: true},
+			{Name: "skew", Kind: KindString, Optional: true},
+			{Name: "sequence", Kind: KindString, Optional: true},
+			{Name: "anomalyScore", Kind: KindDouble, Optional: true},
+		},
+	},
+	SchemaBatch: {
+		Name: SchemaBatch,
+		Fields: []Field{
+			{Name: "key", Kind: KindString},
+			{Name: "count", Kind: KindLong},
+			{Name: "opened", Kind: KindTime},
+			{Name: "closed", Kind: KindTime},
+			{Name: "messages", Kind: KindJSON, Repeated: true},
+		},
+	},
+	SchemaDeadLetter: {
+		Name: SchemaDeadLetter,
+		Fields: []Field{
+			{Name: "time", Kind: KindTime},
+			{Name: "reason", Kind: KindString},
+			{Name: "error", Kind: KindString},
+			{Name: "violations", Kind: KindRecord, Record: "SchemaViolation", Repeated: true, Optional: true},
+			{Name: "message", Kind: KindJSON},
+		},
+	},
+	"SchemaViolation": {
+		Name: "SchemaViolation",
+		Fields: []Field{
+			{Name: "path", Kind: KindString},
+			{Name: "message", Kind: KindString},
+		},
+	},
+	SchemaAlert: {
+		Name: SchemaAlert,
+		Fields: []Field{
+			{Name: "event", Kind: KindString},
+			{Name: "level", Kind: KindString},
+			{Name: "previousLevel", Kind: KindString},
+			{Name: "time", Kind: KindTime},
+			{Name: "deviceId", Kind: KindString},
+			{Name: "siteCode", Kind: KindString},
+			{Name: "metric", Kind: KindString},
+			{Name: "unit", Kind: KindString},
+			{Name: "value", Kind: KindDouble},
+			{Name: "threshold", Kind: KindDouble, Optional: true},
+		},
+	},
+	SchemaDeviceStatus: {
+		Name: SchemaDeviceStatus,
+		Fields: []Field{
+			{Name: "event", Kind: KindString},
+			{Name: "time", Kind: KindTime},
+			{Name: "deviceId", Kind: KindString},
+			{Name: "siteCode", Kind: KindString},
+			{Name: "lastSeen", Kind: KindTime},
+		},
+	},
+	SchemaAggregate: {
+		Name: SchemaAggregate,
+		Fields: []Field{
+			{Name: "deviceId", Kind: KindString},
+			{Name: "siteCode", Kind: KindString},
+			{Name: "dataModel", Kind: KindString},
+			{Name: "metric", Kind: KindString},
+			{Name: "unit", Kind: KindString},
+			{Name: "window", Kind: KindString},
+			{Name: "start", Kind: KindTime},
+			{Name: "end", Kind: KindTime},
+			{Name: "min", Kind: KindDouble},
+			{Name: "max", Kind: KindDouble},
+			{Name: "mean", Kind: KindDouble},
+			{Name: "count", Kind: KindLong},
+			{Name: "last", Kind: KindDouble},
+			{Name: "lastTime", Kind: KindTime},
+			{Name: "partial", Kind: KindBoolean, Optional: true},
+		},
+	},
+	SchemaSiteSummary: {
+		Name: SchemaSiteSummary,
+		Fields: []Field{
+			{Name: "siteCode", Kind: KindString},
+			{Name: "periodStart", Kind: KindTime},
+			{Name: "periodEnd", Kind: KindTime},
+			{Name: "activeDevices", Kind: KindLong},
+			{Name: "messages", Kind: KindLong},
+			{Name: "errors", Kind: KindLong},
+			{Name: "messageRate", Kind: KindDouble},
+			{Name: "errorRate", Kind: KindDouble},
+			{Name: "devices", Kind: KindRecord, Record: "DeviceLatest", Map: true},
+		},
+	},
+	"DeviceLatest": {
+		Name: "DeviceLatest",
+		Fields: []Field{
+			{Name: "lastSeen", Kind: KindTime},
+			{Name: "time", Kind: KindTime},
+			{Name: "values", Kind: KindDouble, Map: true},
+			{Name: "units", Kind: KindString, Map: true},
+		},
+	},
+	SchemaGap: {
+		Name: SchemaGap,
+		Fields: []Field{
+			{Name: "deviceId", Kind: KindString},
+			{Name: "siteCode", Kind: KindString},
+			{Name: "from", Kind: KindTime},
+			{Name: "to", Kind: KindTime},
+			{Name: "gapSeconds", Kind: KindDouble},
+			{Name: "intervalSeconds", Kind: KindDouble},
+			{Name: "missedReports", Kind: KindLong},
+		},
+	},
+	SchemaAnomaly: {
+		Name: SchemaAnomaly,
+		Fields: []Field{
+			{Name: "kind", Kind: KindString},
+			{Name: "time", Kind: KindTime},
+			{Name: "deviceId", Kind: KindString},
+			{Name: "siteCode", Kind: KindString},
+			{Name: "metric", Kind: KindString},
+			{Name: "unit", Kind: KindString},
+			{Name: "value", Kind: KindDouble},
+			{Name: "score", Kind: KindDouble},
+			{Name: "mean", Kind: KindDouble},
+			{Name: "stdDev", Kind: KindDouble},
+			{Name: "rate", Kind: KindDouble, Optional: true},
+			{Name: "limit", Kind: KindDouble},
+		},
+	},
+}
+
+// reshape turns a decoded JSON document into the record of its schema, a JSON array becomes the Items field
+// and the members without a field are moved to the Extra field
+func reshape(s Schema, v any) (map[string]any, error) {
+	if s.Items != "" {
+		return map[string]any{s.Items: v}, nil
+	}
+	doc, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: the document is not a JSON object", s.Name)
+	}
+	if s.Extra == "" {
+		return doc, nil
+	}
+
+	known := make(map[string]bool, len(s.Fields))
+	for _, f := range s.Fields {
+		known[f.Name] = true
+	}
+	out := make(map[string]any, len(doc))
+	extra := make(map[string]any)
+	for name, value := range doc {
+		if known[name] {
+			out[name] = value
+		} else {
+			extra[name] = value
+		}
+	}
+	out[s.Extra] = extra
+	return out, nil
+}
+
+func lookupSchema(name string) (Schema, error) {
+	s, ok := schemas[name]
+	if !ok {
+		return Schema{}, fmt.Errorf("unknown schema %q", name)
+	}
+	return s, nil
+}
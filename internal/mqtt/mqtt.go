@@ -3,8 +3,12 @@ package controller
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Go-routine-4595/DataEnricher/usecase"
@@ -17,6 +21,9 @@ type Message struct {
 	mqtt.Message
 }
 
+// ErrNotConnected is returned by Publish while the connection is down, including while paho reconnects
+var ErrNotConnected = errors.New("not connected to the MQTT broker")
+
 // MQTTConfig holds configuration for MQTT connection
 type MQTTConfig struct {
 	Host           string
@@ -26,21 +33,66 @@ type MQTTConfig struct {
 	Password       *string
 	SubscribeTopic *string
 	ClientID       string
+
+	// Name identifies the connection in logs and metrics
+	Name string
+	// ConnectTimeout bounds a single connection attempt
+	ConnectTimeout time.Duration
+	// RetryInitialInterval and RetryMaxInterval bound the exponential backoff between connection attempts
+	RetryInitialInterval time.Duration
+	RetryMaxInterval     time.Duration
+	// StartupPolicy decides how Start behaves while the broker is unreachable
+	StartupPolicy StartupPolicy
+	// StartupTimeout bounds how long StartupWait retries, zero retries until the context is done
+	StartupTimeout time.Duration
+	// PublishTimeout bounds how long Publish waits for the broker acknowledgement
+	PublishTimeout time.Duration
 }
 
 // NewMQTTConfig creates a default MQTT configuration
 func NewMQTTConfig(host string, port int, clientid string) *MQTTConfig {
 	return &MQTTConfig{
-		Host:           host,
-		Port:           port,
-		Keepalive:      60,
-		Username:       nil,
-		Password:       nil,
-		SubscribeTopic: nil,
-		ClientID:       clientid,
+		Host:                 host,
+		Port:                 port,
+		Keepalive:            60,
+		Username:             nil,
+		Password:             nil,
+		SubscribeTopic:       nil,
+		ClientID:             clientid,
+		Name:                 "mqtt",
+		ConnectTimeout:       30 * time.Second,
+		RetryInitialInterval: time.Second,
+		RetryMaxInterval:     time.Minute,
+		StartupPolicy:        StartupWait,
+		PublishTimeout:       10 * time.Second,
 	}
 }
 
+func (c *MQTTConfig) WithName(name string) *MQTTConfig {
+	c.Name = name
+	return c
+}
+
+// WithRetry sets the connection attempt timeout and the backoff bounds between attempts
+func (c *MQTTConfig) WithRetry(connectTimeout time.Duration, initial time.Duration, max time.Duration) *MQTTConfig {
+	c.ConnectTimeout = connectTimeout
+	c.RetryInitialInterval = initial
+	c.RetryMaxInterval = max
+	return c
+}
+
+func (c *MQTTConfig) WithStartupPolicy(policy StartupPolicy, timeout time.Duration) *MQTTConfig {
+	c.StartupPolicy = policy
+	c.StartupTimeout = timeout
+	return c
+}
+
+// WithPublishTimeout bounds how long Publish waits for the broker acknowledgement
+func (c *MQTTConfig) WithPublishTimeout(timeout time.Duration) *MQTTConfig {
+	c.PublishTimeout = timeout
+	return c
+}
+
 func (c *MQTTConfig) WithUsername(username string) *MQTTConfig {
 	c.Username = &username
 	return c
@@ -62,6 +114,12 @@ type MQTTConnector struct {
 	client      mqtt.Client
 	logger      *zerolog.Logger
 	processData usecase.IGeoKonAPIMessage
+	subMu       sync.Mutex
+	paused      bool
+	onConnected []func()
+	observer    IConnectionObserver
+	connected   atomic.Bool
+	everUp      atomic.Bool
 }
 
 // NewMQTTConnector creates a new MQTT connector instance
@@ -88,6 +146,14 @@ func (m *MQTTConnector) WithSubscription(usecase usecase.IGeoKonAPIMessage) *MQT
 	return m
 }
 
+// WithOnConnect registers a callback run after every successful connection, reconnections included
+func (m *MQTTConnector) WithOnConnect(f func()) *MQTTConnector {
+	m.subMu.Lock()
+	m.onConnected = append(m.onConnected, f)
+	m.subMu.Unlock()
+	return m
+}
+
 func (m *MQTTConnector) WithLogger(logger *zerolog.Logger) *MQTTConnector {
 	m.logger = logger
 	return m
@@ -103,6 +169,11 @@ func (m *MQTTConnector) setupClient() {
 	opts.SetClientID(clientID)
 	opts.SetCleanSession(true)
 	opts.SetKeepAlive(time.Duration(m.config.Keepalive) * time.Second)
+	opts.SetConnectTimeout(m.config.ConnectTimeout)
+
+	// paho doubles the delay between reconnection attempts up to the max interval
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(m.config.RetryMaxInterval)
 
 	// Set TLS configuration (insecure)
 	tlsConfig := &tls.Config{
@@ -119,24 +190,81 @@ func (m *MQTTConnector) setupClient() {
 	// Set callbacks
 	opts.SetOnConnectHandler(m.onConnect)
 	opts.SetConnectionLostHandler(m.onDisconnect)
+	opts.SetReconnectingHandler(m.onReconnecting)
 
 	m.client = mqtt.NewClient(opts)
 }
 
 // onConnect callback for MQTT connection
 func (m *MQTTConnector) onConnect(client mqtt.Client) {
-	m.logger.Info().Msg("Connected to MQTT broker successfully")
+	m.logger.Info().Msgf("Connected %s to MQTT broker successfully", m.config.Name)
 
-	if m.config.SubscribeTopic == nil {
+	reconnected := m.everUp.Swap(true)
+	m.connected.Store(true)
+	m.recordStatus(true)
+	if reconnected {
+		m.recordEvent(EventReconnected)
+	} else {
+		m.recordEvent(EventConnected)
+	}
+
+	// The callbacks run without the lock, they may publish or resubscribe
+	m.subMu.Lock()
+	callbacks := slices.Clone(m.onConnected)
+	m.subMu.Unlock()
+	for _, f := range callbacks {
+		go f()
+	}
+
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	if m.config.SubscribeTopic == nil || m.paused {
 		return
 	}
 	token := client.Subscribe(*m.config.SubscribeTopic, 0, m.onMessage)
 	if token.Wait() && token.Error() != nil {
 		m.logger.Error().Msgf("Failed to subscribe to %s: %v", *m.config.SubscribeTopic, token.Error())
+		m.recordEvent(EventSubscribeFailed)
 		return
 	}
 
 	m.logger.Info().Msgf("Subscribed to %s", *m.config.SubscribeTopic)
+	if reconnected {
+		m.recordEvent(EventResubscribed)
+	}
+}
+
+// Resubscribe moves the subscription to a new topic filter, the new filter is subscribed before the old
+// one is released so no message is missed in between, a paused subscription only records the new filter
+func (m *MQTTConnector) Resubscribe(topic string) error {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	old := m.config.SubscribeTopic
+	if old != nil && *old == topic {
+		return nil
+	}
+
+	if !m.paused && m.client.IsConnectionOpen() {
+		token := m.client.Subscribe(topic, 0, m.onMessage)
+		if token.Wait() && token.Error() != nil {
+			return fmt.Errorf("failed to subscribe to %s: %v", topic, token.Error())
+		}
+		m.logger.Info().Msgf("Subscribed to %s", topic)
+
+		if old != nil {
+			token = m.client.Unsubscribe(*old)
+			if token.Wait() && token.Error() != nil {
+				m.logger.Warn().Msgf("Failed to unsubscribe from %s: %v", *old, token.Error())
+			} else {
+				m.logger.Info().Msgf("Unsubscribed from %s", *old)
+			}
+		}
+	}
+
+	m.config.SubscribeTopic = &topic
+	return nil
 }
 
 func (m *MQTTConnector) onMessage(client mqtt.Client, msg mqtt.Message) {
@@ -145,6 +273,10 @@ func (m *MQTTConnector) onMessage(client mqtt.Client, msg mqtt.Message) {
 
 // onDisconnect callback for MQTT disconnection
 func (m *MQTTConnector) onDisconnect(client mqtt.Client, err error) {
+	m.connected.Store(false)
+	m.recordStatus(false)
+	m.recordEvent(EventConnectionLost)
+
 	if err != nil {
 		m.logger.Warn().Msgf("Unexpected disconnection from MQTT broker: %v", err)
 	} else {
@@ -161,36 +293,108 @@ func (m *MQTTConnector) Connect() error {
 	return nil
 }
 
-// Publish sends data point to MQTT broker
+// Publish sends data point to MQTT broker at QoS 1 and waits for the acknowledgement, a message is only
+// reported as published once the broker has it, so a connection lost under it is an error and not a drop
 func (m *MQTTConnector) Publish(topic string, dataPoint []byte) error {
-	token := m.client.Publish(topic, 0, false, dataPoint)
-	if token.Wait() && token.Error() != nil {
-		m.logger.Warn().Msgf("Failed to publish to %s: %v", topic, token.Error())
-		return token.Error()
+	// paho keeps IsConnected true while it reconnects and silently drops QoS 0 messages meanwhile
+	if !m.connected.Load() || !m.client.IsConnectionOpen() {
+		return ErrNotConnected
+	}
+
+	token := m.client.Publish(topic, 1, false, dataPoint)
+	if !token.WaitTimeout(m.config.PublishTimeout) {
+		m.logger.Warn().Msgf("Failed to publish to %s: no acknowledgement within %s", topic, m.config.PublishTimeout)
+		return fmt.Errorf("publishing to %s: no acknowledgement within %s", topic, m.config.PublishTimeout)
+	}
+	if err := token.Error(); err != nil {
+		m.logger.Warn().Msgf("Failed to publish to %s: %v", topic, err)
+		return err
 	}
 
 	m.logger.Debug().Msgf("Published data to %s", topic)
 	return nil
 }
 
-// Start begins the MQTT client and starts processing messages
+// Start connects to the broker according to the startup policy, it returns the error that prevented the
+// startup, the context only bounds the connection attempts so a shutdown signal aborts them, the connection
+// itself is closed by Stop
 func (m *MQTTConnector) Start(ctx context.Context) error {
-	m.logger.Info().Msgf("Connecting to MQTT broker at %s:%d", m.config.Host, m.config.Port)
+	m.logger.Info().Msgf("Connecting %s to MQTT broker at %s:%d (startup policy %s)", m.config.Name, m.config.Host, m.config.Port, m.config.StartupPolicy)
 
-	if err := m.Connect(); err != nil {
-		return fmt.Errorf("error starting MQTT client: %v", err)
+	if err := m.connect(ctx); err != nil {
+		return fmt.Errorf("error starting MQTT client %s: %w", m.config.Name, err)
 	}
+	return nil
+}
 
-	res := <-ctx.Done()
-	m.logger.Info().Msgf("Received signal %v. Shutting down gracefully...", res)
+// Unsubscribe releases the subscription, it is not restored on reconnect
+func (m *MQTTConnector) Unsubscribe() error {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	if m.config.SubscribeTopic == nil {
+		return nil
+	}
+	topic := *m.config.SubscribeTopic
+	m.config.SubscribeTopic = nil
 
-	m.Stop()
+	if !m.client.IsConnectionOpen() {
+		return nil
+	}
+	token := m.client.Unsubscribe(topic)
+	if token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to unsubscribe from %s: %v", topic, token.Error())
+	}
+	m.logger.Info().Msgf("Unsubscribed from %s", topic)
 	return nil
+}
+
+// PauseSubscription releases the subscription until ResumeSubscription, the broker stops delivering instead of
+// the messages piling up in the use case queue, the subscription is not restored on reconnect meanwhile
+func (m *MQTTConnector) PauseSubscription() error {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
 
+	if m.paused {
+		return nil
+	}
+	m.paused = true
+	if m.config.SubscribeTopic == nil || !m.client.IsConnectionOpen() {
+		return nil
+	}
+	token := m.client.Unsubscribe(*m.config.SubscribeTopic)
+	if token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to unsubscribe from %s: %v", *m.config.SubscribeTopic, token.Error())
+	}
+	m.logger.Info().Msgf("Subscription to %s paused", *m.config.SubscribeTopic)
+	return nil
+}
+
+// ResumeSubscription subscribes again after PauseSubscription, when the connection is down the subscription
+// is restored on reconnect
+func (m *MQTTConnector) ResumeSubscription() error {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	if !m.paused {
+		return nil
+	}
+	m.paused = false
+	if m.config.SubscribeTopic == nil || !m.client.IsConnectionOpen() {
+		return nil
+	}
+	token := m.client.Subscribe(*m.config.SubscribeTopic, 0, m.onMessage)
+	if token.Wait() && token.Error() != nil {
+		m.paused = true
+		return fmt.Errorf("failed to subscribe to %s: %v", *m.config.SubscribeTopic, token.Error())
+	}
+	m.logger.Info().Msgf("Subscription to %s resumed", *m.config.SubscribeTopic)
+	return nil
 }
 
-// Stop gracefully stops the MQTT client
+// Stop gracefully stops the MQTT client, it always disconnects since paho keeps reconnecting a client that
+// lost its connection, stopping an already stopped client does nothing
 func (m *MQTTConnector) Stop() {
-	m.logger.Info().Msg("Stopping MQTT client...")
+	m.logger.Info().Msgf("Stopping MQTT client %s...", m.config.Name)
 	m.client.Disconnect(250) // 250ms timeout for graceful disconnect
 }
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// StartupPolicy decides how a connector starts while the broker is unreachable
+type StartupPolicy string
+
+const (
+	// StartupFail makes a single connection attempt and returns its error
+	StartupFail StartupPolicy = "fail"
+	// StartupWait retries with exponential backoff until connected or StartupTimeout elapses
+	StartupWait StartupPolicy = "wait"
+	// StartupBackground returns immediately and keeps retrying in the background
+	StartupBackground StartupPolicy = "background"
+)
+
+// Connection events reported to the observer
+const (
+	EventConnected       = "connected"
+	EventReconnected     = "reconnected"
+	EventReconnecting    = "reconnecting"
+	EventResubscribed    = "resubscribed"
+	EventConnectFailed   = "connect_failed"
+	EventConnectionLost  = "connection_lost"
+	EventSubscribeFailed = "subscribe_failed"
+)
+
+// IConnectionObserver receives the connection status and events of a connector
+type IConnectionObserver interface {
+	RecordConnectionStatus(service string, connected bool)
+	RecordConnectionEvent(service string, event string)
+}
+
+// WithConnectionObserver reports the connection status and events to the observer
+func (m *MQTTConnector) WithConnectionObserver(observer IConnectionObserver) *MQTTConnector {
+	m.observer = observer
+	return m
+}
+
+// IsConnected reports whether the connector currently holds a connection to the broker
+func (m *MQTTConnector) IsConnected() bool {
+	return m.connected.Load()
+}
+
+// connect applies the startup policy
+func (m *MQTTConnector) connect(ctx context.Context) error {
+	switch m.config.StartupPolicy {
+	case StartupFail:
+		err := m.Connect()
+		if err != nil {
+			m.recordEvent(EventConnectFailed)
+		}
+		return err
+	case StartupBackground:
+		go func() {
+			err := m.connectWithRetry(ctx)
+			if err != nil {
+				m.logger.Error().Msgf("Stopped connecting %s to MQTT broker: %v", m.config.Name, err)
+			}
+		}()
+		return nil
+	default:
+		if m.config.StartupTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, m.config.StartupTimeout)
+			defer cancel()
+		}
+		return m.connectWithRetry(ctx)
+	}
+}
+
+// connectWithRetry attempts to connect until it succeeds or the context is done, doubling the delay
+// between attempts up to RetryMaxInterval
+func (m *MQTTConnector) connectWithRetry(ctx context.Context) error {
+	delay := m.config.RetryInitialInterval
+
+	for attempt := 1; ; attempt++ {
+		err := m.Connect()
+		if err == nil {
+			return nil
+		}
+		m.recordEvent(EventConnectFailed)
+		m.logger.Warn().Msgf("Connection attempt %d of %s failed, retrying in %s: %v", attempt, m.config.Name, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, m.config.RetryMaxInterval)
+	}
+}
+
+// onReconnecting callback run before every automatic reconnection attempt
+func (m *MQTTConnector) onReconnecting(client mqtt.Client, opts *mqtt.ClientOptions) {
+	m.logger.Info().Msgf("Reconnecting %s to MQTT broker", m.config.Name)
+	m.recordEvent(EventReconnecting)
+}
+
+func (m *MQTTConnector) recordStatus(connected bool) {
+	if m.observer != nil {
+		m.observer.RecordConnectionStatus(m.config.Name, connected)
+	}
+}
+
+func (m *MQTTConnector) recordEvent(event string) {
+	if m.observer != nil {
+		m.observer.RecordConnectionEvent(m.config.Name, event)
+	}
+}
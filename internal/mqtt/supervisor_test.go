@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// eventRecorder is a connection observer keeping the events it receives
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *eventRecorder) RecordConnectionStatus(service string, connected bool) {}
+
+func (r *eventRecorder) RecordConnectionEvent(service string, event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// closedPort is a local port nothing listens on, connecting to it fails right away
+func closedPort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+// unreachableConnector is a connector to a broker that refuses every connection, logging as JSON into logs
+func unreachableConnector(t *testing.T, policy StartupPolicy, timeout time.Duration, logs *bytes.Buffer) (*MQTTConnector, *eventRecorder) {
+	config := NewMQTTConfig("127.0.0.1", closedPort(t), "test").
+		WithRetry(time.Second, time.Millisecond, 4*time.Millisecond).
+		WithStartupPolicy(policy, timeout)
+	logger := zerolog.New(logs)
+	observer := &eventRecorder{}
+	return NewMQTTConnector(config, &logger).WithConnectionObserver(observer), observer
+}
+
+func TestStartupPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       StartupPolicy
+		timeout      time.Duration
+		wantErr      string
+		wantAttempts int
+	}{
+		{name: "fail", policy: StartupFail, wantErr: "failed to connect", wantAttempts: 1},
+		{name: "wait", policy: StartupWait, timeout: 50 * time.Millisecond, wantErr: "giving up after"},
+		{name: "background", policy: StartupBackground},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			connector, observer := unreachableConnector(t, tt.policy, tt.timeout, &bytes.Buffer{})
+
+			err := connector.connect(ctx)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("connect error = %v, want none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("connect error = %v, want %q", err, tt.wantErr)
+			}
+
+			observer.mu.Lock()
+			defer observer.mu.Unlock()
+			if len(observer.events) == 0 || (tt.wantAttempts > 0 && len(observer.events) != tt.wantAttempts) {
+				t.Errorf("events = %q, want %d connection failures", observer.events, tt.wantAttempts)
+			}
+			for _, e := range observer.events {
+				if e != EventConnectFailed {
+					t.Errorf("event = %s, want %s", e, EventConnectFailed)
+				}
+			}
+		})
+	}
+}
+
+func TestConnectBackoff(t *testing.T) {
+	var logs bytes.Buffer
+	connector, _ := unreachableConnector(t, StartupWait, 0, &logs)
+
+	// The attempts stop once the context is done, the delays are read from the retry logs
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := connector.connectWithRetry(ctx); err == nil {
+		t.Fatal("connectWithRetry to an unreachable broker did not fail")
+	}
+
+	retrying := regexp.MustCompile(`retrying in (\S+):`)
+	var delays []string
+	for line := range bytes.Lines(logs.Bytes()) {
+		var entry struct{ Message string }
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatal(err)
+		}
+		if m := retrying.FindStringSubmatch(entry.Message); m != nil {
+			delays = append(delays, m[1])
+		}
+	}
+	if len(delays) < 4 {
+		t.Fatalf("delays = %q, want at least 4 attempts", delays)
+	}
+	if want := []string{"1ms", "2ms", "4ms", "4ms"}; !slices.Equal(delays[:4], want) {
+		t.Errorf("delays = %q, want %q then capped", delays[:4], want)
+	}
+}
@@ -0,0 +1,538 @@
+package outbox
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	segmentExt = ".seg"
+	cursorFile = "cursor"
+
+	// headerSize is the record length and CRC32 preceding every payload
+	headerSize = 8
+	// metaSize is the timestamp and topic length at the start of every payload
+	metaSize = 10
+
+	// cursorSyncRecords is how many records a replay publishes between two cursor writes, a crash replays
+	// at most that many records again
+	cursorSyncRecords = 64
+)
+
+var errCorrupt = errors.New("corrupt outbox record")
+
+// Options bounds the outbox on disk
+type Options struct {
+	// MaxBytes caps the pending records, the oldest segments are dropped to make room
+	MaxBytes int64
+	// MaxAge drops records older than this instead of replaying them, zero keeps records forever
+	MaxAge time.Duration
+	// SegmentBytes is the size after which a new segment file is started
+	SegmentBytes int64
+}
+
+// Record is a message waiting to be published
+type Record struct {
+	Time    time.Time
+	Topic   string
+	Message []byte
+}
+
+type position struct {
+	segment uint64
+	offset  int64
+}
+
+type segmentStats struct {
+	records int
+	bytes   int64
+}
+
+// Outbox is a persistent FIFO of messages stored in append-only segment files. Records are framed with
+// their length and CRC32 so a record torn by a crash is detected and truncated when the outbox is opened.
+// The read position is kept in a cursor file, a record is only passed once the publish succeeded so
+// delivery is at least once. The cursor is persisted in batches during a replay, so a crash may publish
+// up to cursorSyncRecords records again.
+type Outbox struct {
+	mu     sync.Mutex
+	dir    string
+	opts   Options
+	logger *zerolog.Logger
+
+	segments   []uint64
+	stats      map[uint64]*segmentStats
+	active     *os.File
+	activeSize int64
+	reader     *os.File
+	readerID   uint64
+	cursor     position
+	// cursorDirty is set while the cursor moved past records without being persisted
+	cursorDirty bool
+	records     int
+	bytes       int64
+}
+
+// Open opens or creates the outbox in dir and recovers the records left by a previous run
+func Open(dir string, opts Options, l *zerolog.Logger) (*Outbox, error) {
+	var logger zerolog.Logger
+
+	if l == nil {
+		logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+	} else {
+		logger = *l
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating outbox directory: %w", err)
+	}
+
+	o := &Outbox{
+		dir:    dir,
+		opts:   opts,
+		logger: &logger,
+		stats:  make(map[uint64]*segmentStats),
+	}
+	if err := o.recover(); err != nil {
+		return nil, err
+	}
+
+	o.logger.Info().Msgf("Outbox %s opened with %d pending messages (%d bytes)", dir, o.records, o.bytes)
+	return o, nil
+}
+
+// Append stores a message at the end of the outbox
+func (o *Outbox) Append(topic string, message []byte) error {
+	if len(topic) > 0xFFFF {
+		return fmt.Errorf("topic too long for outbox: %d bytes", len(topic))
+	}
+	record := encode(Record{Time: time.Now(), Topic: topic, Message: message})
+	size := int64(len(record))
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.opts.MaxBytes > 0 && size > o.opts.MaxBytes {
+		return fmt.Errorf("message of %d bytes exceeds the outbox size cap", size)
+	}
+	for o.opts.MaxBytes > 0 && o.bytes+size > o.opts.MaxBytes && o.records > 0 {
+		if len(o.segments) == 1 {
+			if err := o.roll(); err != nil {
+				return err
+			}
+		}
+		if err := o.dropOldest(); err != nil {
+			return err
+		}
+	}
+	if o.opts.SegmentBytes > 0 && o.activeSize >= o.opts.SegmentBytes {
+		if err := o.roll(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := o.active.Write(record); err != nil {
+		return fmt.Errorf("writing outbox record: %w", err)
+	}
+	if err := o.active.Sync(); err != nil {
+		return fmt.Errorf("syncing outbox segment: %w", err)
+	}
+
+	id := o.segments[len(o.segments)-1]
+	o.activeSize += size
+	o.stats[id].records++
+	o.stats[id].bytes += size
+	o.records++
+	o.bytes += size
+	return nil
+}
+
+// Replay passes the pending records, oldest first, to publish and removes each one once it has been
+// published. It stops at the first publish error, leaving that record at the head of the outbox.
+// Records older than MaxAge are dropped without being published.
+func (o *Outbox) Replay(publish func(topic string, message []byte) error) (sent int, expired int, err error) {
+	defer func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if o.cursorDirty {
+			err = errors.Join(err, o.writeCursor())
+		}
+	}()
+
+	for {
+		// The lock is released while publishing, so Append may evict the segment holding the record. The
+		// cursor is only moved when it has not changed in between, otherwise the record was already dropped.
+		o.mu.Lock()
+		record, size, err := o.next()
+		pos := o.cursor
+		o.mu.Unlock()
+		if err != nil {
+			return sent, expired, err
+		}
+		if size == 0 {
+			return sent, expired, nil
+		}
+
+		if o.opts.MaxAge > 0 && time.Since(record.Time) > o.opts.MaxAge {
+			expired++
+		} else {
+			err = publish(record.Topic, record.Message)
+			if err != nil {
+				return sent, expired, err
+			}
+			sent++
+		}
+
+		o.mu.Lock()
+		if o.cursor == pos {
+			o.advance(size)
+		}
+		if o.cursorDirty && (sent+expired)%cursorSyncRecords == 0 {
+			err = o.writeCursor()
+		}
+		o.mu.Unlock()
+		if err != nil {
+			return sent, expired, err
+		}
+	}
+}
+
+// Pending returns the number of records waiting to be published
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.records
+}
+
+// Size returns the number of records and bytes waiting to be published
+func (o *Outbox) Size() (records int, bytes int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.records, o.bytes
+}
+
+// Close persists the cursor and releases the segment files
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var err error
+	if o.cursorDirty {
+		err = o.writeCursor()
+	}
+	if o.reader != nil {
+		o.reader.Close()
+		o.reader = nil
+	}
+	return errors.Join(err, o.active.Close())
+}
+
+// recover loads the segments and cursor, truncates a torn record at the end of the last segment
+// and counts the pending records
+func (o *Outbox) recover() error {
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		return fmt.Errorf("reading outbox directory: %w", err)
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentExt)
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		o.segments = append(o.segments, id)
+	}
+	sort.Slice(o.segments, func(i, j int) bool { return o.segments[i] < o.segments[j] })
+	if len(o.segments) == 0 {
+		o.segments = []uint64{1}
+	}
+
+	o.cursor = o.readCursor()
+	if o.cursor.segment < o.segments[0] || o.cursor.segment > o.segments[len(o.segments)-1] {
+		o.cursor = position{segment: o.segments[0]}
+	}
+
+	// Segments before the cursor were fully published before the previous run stopped
+	for len(o.segments) > 1 && o.segments[0] < o.cursor.segment {
+		os.Remove(o.segmentPath(o.segments[0]))
+		o.segments = o.segments[1:]
+	}
+	// A cursor on a missing segment or past the end of its segment does not match the files, the records
+	// are replayed from the first segment rather than lost
+	if o.cursor.segment != o.segments[0] {
+		o.logger.Warn().Msgf("Outbox cursor on missing segment %d, replaying from segment %d", o.cursor.segment, o.segments[0])
+		o.cursor = position{segment: o.segments[0]}
+	}
+	if info, err := os.Stat(o.segmentPath(o.cursor.segment)); err == nil && o.cursor.offset > info.Size() {
+		o.logger.Warn().Msgf("Outbox cursor at %d is past the end of segment %d, replaying it from the start", o.cursor.offset, o.cursor.segment)
+		o.cursor.offset = 0
+	}
+
+	for i, id := range o.segments {
+		last := i == len(o.segments)-1
+		start := int64(0)
+		if id == o.cursor.segment {
+			start = o.cursor.offset
+		}
+
+		stats, end, err := o.scan(id, start)
+		if err != nil && !last {
+			o.logger.Warn().Msgf("Outbox segment %d is damaged after %d bytes, the rest of it is skipped: %v", id, end, err)
+		}
+		if last {
+			if err != nil {
+				o.logger.Warn().Msgf("Outbox recovered from an interrupted write, truncating segment %d at %d bytes: %v", id, end, err)
+				if err := os.Truncate(o.segmentPath(id), end); err != nil {
+					return fmt.Errorf("truncating outbox segment: %w", err)
+				}
+			}
+			o.activeSize = end
+		}
+
+		o.stats[id] = &stats
+		o.records += stats.records
+		o.bytes += stats.bytes
+	}
+
+	f, err := os.OpenFile(o.segmentPath(o.segments[len(o.segments)-1]), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("opening outbox segment: %w", err)
+	}
+	o.active = f
+	return o.syncDir()
+}
+
+// scan counts the valid records of a segment from start, it returns the offset after the last valid
+// record and the reason the scan stopped early, if any
+func (o *Outbox) scan(id uint64, start int64) (segmentStats, int64, error) {
+	var stats segmentStats
+
+	f, err := os.Open(o.segmentPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return stats, 0, nil
+	}
+	if err != nil {
+		return stats, start, err
+	}
+	defer f.Close()
+
+	offset := start
+	for {
+		_, size, err := readRecord(f, offset)
+		if errors.Is(err, io.EOF) {
+			return stats, offset, nil
+		}
+		if err != nil {
+			return stats, offset, err
+		}
+		stats.records++
+		stats.bytes += size
+		offset += size
+	}
+}
+
+// next reads the record at the cursor, moving to the next segment when the current one is exhausted.
+// A zero size means the outbox is empty.
+func (o *Outbox) next() (Record, int64, error) {
+	for o.records > 0 {
+		if o.reader == nil || o.readerID != o.cursor.segment {
+			if o.reader != nil {
+				o.reader.Close()
+			}
+			f, err := os.Open(o.segmentPath(o.cursor.segment))
+			if err != nil {
+				return Record{}, 0, fmt.Errorf("opening outbox segment: %w", err)
+			}
+			o.reader = f
+			o.readerID = o.cursor.segment
+		}
+
+		record, size, err := readRecord(o.reader, o.cursor.offset)
+		if err == nil {
+			return record, size, nil
+		}
+		if o.cursor.segment == o.segments[len(o.segments)-1] {
+			return Record{}, 0, fmt.Errorf("reading outbox record: %w", err)
+		}
+		if !errors.Is(err, io.EOF) {
+			o.logger.Warn().Msgf("Skipping damaged outbox segment %d: %v", o.cursor.segment, err)
+		}
+		if err := o.dropOldest(); err != nil {
+			return Record{}, 0, err
+		}
+	}
+	return Record{}, 0, nil
+}
+
+// advance moves the cursor past a record of the given size, the cursor is persisted by the caller
+func (o *Outbox) advance(size int64) {
+	stats := o.stats[o.cursor.segment]
+	stats.records--
+	stats.bytes -= size
+	o.records--
+	o.bytes -= size
+	o.cursor.offset += size
+	o.cursorDirty = true
+}
+
+// roll starts a new active segment
+func (o *Outbox) roll() error {
+	id := o.segments[len(o.segments)-1] + 1
+	f, err := os.OpenFile(o.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("creating outbox segment: %w", err)
+	}
+
+	o.active.Close()
+	o.active = f
+	o.activeSize = 0
+	o.segments = append(o.segments, id)
+	o.stats[id] = &segmentStats{}
+	return o.syncDir()
+}
+
+// dropOldest removes the segment holding the cursor, along with its pending records, and moves the
+// cursor to the start of the next segment
+func (o *Outbox) dropOldest() error {
+	id := o.segments[0]
+	stats := o.stats[id]
+	if stats.records > 0 {
+		o.logger.Warn().Msgf("Outbox dropping %d pending messages from segment %d", stats.records, id)
+	}
+
+	o.records -= stats.records
+	o.bytes -= stats.bytes
+	delete(o.stats, id)
+	o.segments = o.segments[1:]
+	o.cursor = position{segment: o.segments[0]}
+
+	if o.reader != nil && o.readerID == id {
+		o.reader.Close()
+		o.reader = nil
+	}
+	if err := o.writeCursor(); err != nil {
+		return err
+	}
+	if err := os.Remove(o.segmentPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing outbox segment: %w", err)
+	}
+	return o.syncDir()
+}
+
+func (o *Outbox) readCursor() position {
+	var cursor position
+
+	b, err := os.ReadFile(filepath.Join(o.dir, cursorFile))
+	if err != nil {
+		return cursor
+	}
+	fmt.Sscanf(string(b), "%d %d", &cursor.segment, &cursor.offset)
+	return cursor
+}
+
+// writeCursor replaces the cursor file atomically so a crash leaves either the old or the new position
+func (o *Outbox) writeCursor() error {
+	tmp := filepath.Join(o.dir, cursorFile+".tmp")
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("writing outbox cursor: %w", err)
+	}
+	fmt.Fprintf(f, "%d %d\n", o.cursor.segment, o.cursor.offset)
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("writing outbox cursor: %w", err)
+	}
+	f.Close()
+
+	if err := os.Rename(tmp, filepath.Join(o.dir, cursorFile)); err != nil {
+		return fmt.Errorf("writing outbox cursor: %w", err)
+	}
+	o.cursorDirty = false
+	return o.syncDir()
+}
+
+// syncDir flushes the directory entries so the segments created or removed and the renamed cursor
+// survive a crash
+func (o *Outbox) syncDir() error {
+	d, err := os.Open(o.dir)
+	if err != nil {
+		return fmt.Errorf("syncing outbox directory: %w", err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("syncing outbox directory: %w", err)
+	}
+	return nil
+}
+
+func (o *Outbox) segmentPath(id uint64) string {
+	return filepath.Join(o.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// encode frames a record as length, CRC32, timestamp, topic length, topic and message
+func encode(r Record) []byte {
+	payload := make([]byte, metaSize+len(r.Topic)+len(r.Message))
+	binary.BigEndian.PutUint64(payload[0:8], uint64(r.Time.UnixNano()))
+	binary.BigEndian.PutUint16(payload[8:10], uint16(len(r.Topic)))
+	copy(payload[metaSize:], r.Topic)
+	copy(payload[metaSize+len(r.Topic):], r.Message)
+
+	record := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[headerSize:], payload)
+	return record
+}
+
+// readRecord decodes the record at offset, io.EOF means there is no record left, io.ErrUnexpectedEOF
+// and errCorrupt mean the record was torn or damaged
+func readRecord(f *os.File, offset int64) (Record, int64, error) {
+	header := make([]byte, headerSize)
+	n, err := f.ReadAt(header, offset)
+	if n == 0 && errors.Is(err, io.EOF) {
+		return Record{}, 0, io.EOF
+	}
+	if n < headerSize {
+		return Record{}, 0, io.ErrUnexpectedEOF
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < metaSize {
+		return Record{}, 0, errCorrupt
+	}
+	payload := make([]byte, length)
+	n, _ = f.ReadAt(payload, offset+headerSize)
+	if n < int(length) {
+		return Record{}, 0, io.ErrUnexpectedEOF
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return Record{}, 0, errCorrupt
+	}
+
+	topicLen := int(binary.BigEndian.Uint16(payload[8:10]))
+	if metaSize+topicLen > len(payload) {
+		return Record{}, 0, errCorrupt
+	}
+	record := Record{
+		Time:    time.Unix(0, int64(binary.BigEndian.Uint64(payload[0:8]))),
+		Topic:   string(payload[metaSize : metaSize+topicLen]),
+		Message: payload[metaSize+topicLen:],
+	}
+	return record, headerSize + int64(length), nil
+}
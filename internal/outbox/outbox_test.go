@@ -0,0 +1,361 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func openTest(t *testing.T, dir string, opts Options) *Outbox {
+	t.Helper()
+
+	logger := zerolog.Nop()
+	o, err := Open(dir, opts, &logger)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return o
+}
+
+func appendAll(t *testing.T, o *Outbox, messages ...string) {
+	t.Helper()
+
+	for _, m := range messages {
+		if err := o.Append("topic/"+m, []byte(m)); err != nil {
+			t.Fatalf("Append %s: %v", m, err)
+		}
+	}
+}
+
+// drain replays the whole outbox and returns the messages in the order they were published
+func drain(t *testing.T, o *Outbox) []string {
+	t.Helper()
+
+	var got []string
+	_, _, err := o.Replay(func(topic string, message []byte) error {
+		if topic != "topic/"+string(message) {
+			t.Errorf("record %s published to %s", message, topic)
+		}
+		got = append(got, string(message))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	return got
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReplayOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		messages []string
+	}{
+		{name: "empty", opts: Options{}},
+		{name: "single segment", opts: Options{}, messages: []string{"a", "b", "c"}},
+		{name: "several segments", opts: Options{SegmentBytes: 30}, messages: []string{"a", "b", "c", "d", "e", "f"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := openTest(t, t.TempDir(), tt.opts)
+			defer o.Close()
+
+			appendAll(t, o, tt.messages...)
+			if got := o.Pending(); got != len(tt.messages) {
+				t.Fatalf("Pending = %d, want %d", got, len(tt.messages))
+			}
+			if got := drain(t, o); !equal(got, tt.messages) {
+				t.Errorf("replayed %v, want %v", got, tt.messages)
+			}
+			if records, bytes := o.Size(); records != 0 || bytes != 0 {
+				t.Errorf("Size = %d records %d bytes after replay, want empty", records, bytes)
+			}
+		})
+	}
+}
+
+func TestReplayStopsAtPublishError(t *testing.T) {
+	o := openTest(t, t.TempDir(), Options{SegmentBytes: 30})
+	defer o.Close()
+	appendAll(t, o, "a", "b", "c", "d")
+
+	failure := errors.New("broker down")
+	sent, _, err := o.Replay(func(topic string, message []byte) error {
+		if string(message) == "c" {
+			return failure
+		}
+		return nil
+	})
+	if !errors.Is(err, failure) || sent != 2 {
+		t.Fatalf("Replay = %d sent, %v, want 2 sent, %v", sent, err, failure)
+	}
+	if got := drain(t, o); !equal(got, []string{"c", "d"}) {
+		t.Errorf("replayed %v after the error, want [c d]", got)
+	}
+}
+
+func TestReplayDropsExpired(t *testing.T) {
+	o := openTest(t, t.TempDir(), Options{MaxAge: time.Millisecond})
+	defer o.Close()
+	appendAll(t, o, "a", "b")
+	time.Sleep(5 * time.Millisecond)
+
+	sent, expired, err := o.Replay(func(string, []byte) error {
+		t.Error("expired record published")
+		return nil
+	})
+	if err != nil || sent != 0 || expired != 2 {
+		t.Errorf("Replay = %d sent %d expired %v, want 0 sent 2 expired", sent, expired, err)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	record := int64(len(encode(Record{Topic: "topic/a", Message: []byte("a")})))
+
+	tests := []struct {
+		name     string
+		opts     Options
+		messages []string
+		want     []string
+	}{
+		{
+			name:     "under the cap",
+			opts:     Options{MaxBytes: 4 * record},
+			messages: []string{"a", "b", "c"},
+			want:     []string{"a", "b", "c"},
+		},
+		{
+			name:     "single segment rolled and dropped",
+			opts:     Options{MaxBytes: 2 * record},
+			messages: []string{"a", "b", "c"},
+			want:     []string{"c"},
+		},
+		{
+			name:     "oldest segments dropped",
+			opts:     Options{MaxBytes: 4 * record, SegmentBytes: 2 * record},
+			messages: []string{"a", "b", "c", "d", "e"},
+			want:     []string{"c", "d", "e"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := openTest(t, t.TempDir(), tt.opts)
+			defer o.Close()
+
+			appendAll(t, o, tt.messages...)
+			if _, bytes := o.Size(); bytes > tt.opts.MaxBytes {
+				t.Errorf("outbox holds %d bytes, over the %d cap", bytes, tt.opts.MaxBytes)
+			}
+			if got := drain(t, o); !equal(got, tt.want) {
+				t.Errorf("replayed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendTooLarge(t *testing.T) {
+	o := openTest(t, t.TempDir(), Options{MaxBytes: 16})
+	defer o.Close()
+
+	if err := o.Append("topic", make([]byte, 32)); err == nil {
+		t.Error("Append of a record over the cap succeeded")
+	}
+}
+
+// An Append evicting the segment being replayed must not move the cursor of the next segment
+func TestEvictionDuringReplay(t *testing.T) {
+	record := int64(len(encode(Record{Topic: "topic/a", Message: []byte("a")})))
+	o := openTest(t, t.TempDir(), Options{MaxBytes: 3 * record, SegmentBytes: record})
+	defer o.Close()
+	appendAll(t, o, "a", "b", "c")
+
+	var got []string
+	_, _, err := o.Replay(func(topic string, message []byte) error {
+		got = append(got, string(message))
+		if string(message) == "a" {
+			// Drops the segment of a while it is being published
+			appendAll(t, o, "d")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if want := []string{"a", "b", "c", "d"}; !equal(got, want) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+	if records, bytes := o.Size(); records != 0 || bytes != 0 {
+		t.Errorf("Size = %d records %d bytes after replay, want empty", records, bytes)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name string
+		// damage changes the files left by a run that appended a, b, c, d over two segments and published a
+		damage func(t *testing.T, dir string)
+		want   []string
+	}{
+		{
+			name:   "clean restart",
+			damage: func(*testing.T, string) {},
+			want:   []string{"b", "c", "d"},
+		},
+		{
+			name: "torn tail",
+			damage: func(t *testing.T, dir string) {
+				appendRaw(t, dir, 2, encode(Record{Topic: "topic/e", Message: []byte("e")})[:12])
+			},
+			want: []string{"b", "c", "d"},
+		},
+		{
+			name: "corrupt tail",
+			damage: func(t *testing.T, dir string) {
+				record := encode(Record{Topic: "topic/e", Message: []byte("e")})
+				record[len(record)-1] ^= 0xFF
+				appendRaw(t, dir, 2, record)
+			},
+			want: []string{"b", "c", "d"},
+		},
+		{
+			name: "cursor missing",
+			damage: func(t *testing.T, dir string) {
+				removeFile(t, filepath.Join(dir, cursorFile))
+			},
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			name: "cursor behind the segments",
+			damage: func(t *testing.T, dir string) {
+				writeRaw(t, filepath.Join(dir, cursorFile), "0 0\n")
+			},
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			name: "cursor ahead of the segments",
+			damage: func(t *testing.T, dir string) {
+				writeRaw(t, filepath.Join(dir, cursorFile), "9 0\n")
+			},
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			name: "cursor past the end of its segment",
+			damage: func(t *testing.T, dir string) {
+				writeRaw(t, filepath.Join(dir, cursorFile), "1 4096\n")
+			},
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			name: "cursor on a missing segment",
+			damage: func(t *testing.T, dir string) {
+				removeFile(t, filepath.Join(dir, fmt.Sprintf("%020d%s", 1, segmentExt)))
+				writeRaw(t, filepath.Join(dir, cursorFile), "1 0\n")
+			},
+			want: []string{"c", "d"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			record := int64(len(encode(Record{Topic: "topic/a", Message: []byte("a")})))
+
+			o := openTest(t, dir, Options{SegmentBytes: 2 * record})
+			appendAll(t, o, "a", "b", "c", "d")
+			_, _, err := o.Replay(func(topic string, message []byte) error {
+				if string(message) != "a" {
+					return errors.New("broker down")
+				}
+				return nil
+			})
+			if err == nil {
+				t.Fatal("Replay did not stop at the publish error")
+			}
+			if err := o.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			tt.damage(t, dir)
+
+			o = openTest(t, dir, Options{SegmentBytes: 2 * record})
+			defer o.Close()
+			if got := o.Pending(); got != len(tt.want) {
+				t.Errorf("Pending = %d after recovery, want %d", got, len(tt.want))
+			}
+			if got := drain(t, o); !equal(got, tt.want) {
+				t.Errorf("replayed %v, want %v", got, tt.want)
+			}
+
+			// The recovered outbox keeps accepting records after the truncated tail
+			appendAll(t, o, "f")
+			if got := drain(t, o); !equal(got, []string{"f"}) {
+				t.Errorf("replayed %v after recovery, want [f]", got)
+			}
+		})
+	}
+}
+
+// A replay persists the cursor, a restart does not publish the replayed records again
+func TestReplayPersistsCursor(t *testing.T) {
+	dir := t.TempDir()
+	messages := make([]string, cursorSyncRecords+3)
+	for i := range messages {
+		messages[i] = fmt.Sprint(i)
+	}
+
+	o := openTest(t, dir, Options{})
+	appendAll(t, o, messages...)
+	drain(t, o)
+	o.Close()
+
+	o = openTest(t, dir, Options{})
+	defer o.Close()
+	if got := o.Pending(); got != 0 {
+		t.Errorf("Pending = %d after restart, want 0", got)
+	}
+}
+
+func appendRaw(t *testing.T, dir string, segment uint64, b []byte) {
+	t.Helper()
+
+	f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%020d%s", segment, segmentExt)), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeRaw(t *testing.T, path string, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func removeFile(t *testing.T, path string) {
+	t.Helper()
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,8 +3,10 @@ package redis
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/url"
 	"strconv"
 	"strings"
@@ -15,8 +17,17 @@ import (
 
 const (
 	DefaultExpiration = 5 * time.Millisecond
+	// DedupTimeout bounds SetNX and Del, a deduplication mark that times out lets a duplicate through so it
+	// is given more time than the cached reads
+	DedupTimeout = 100 * time.Millisecond
+	// StateTimeout bounds the reads and writes of the state carried from one message to the next, a call that
+	// times out loses an update of the state instead of a cache refresh so it is given a realistic round trip
+	StateTimeout = 500 * time.Millisecond
 )
 
+// ErrNotFound is returned by Get when the key does not exist
+var ErrNotFound = errors.New("not found")
+
 // Client represents a Redis client wrapper
 type Client struct {
 	//client *redis.Client
@@ -42,6 +53,11 @@ type ConnectionInfo struct {
 func ParseConnectionString(connectionString string) (*ConnectionInfo, error) {
 	parsedURL, err := url.Parse(connectionString)
 	if err != nil {
+		// url.Error quotes the whole string, password included
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
 		return nil, fmt.Errorf("invalid connection string format: %w", err)
 	}
 
@@ -234,13 +250,22 @@ func (c *Client) isRemoteConnection() bool {
 
 // Get retrieves a value from Redis by key
 func (c *Client) Get(key string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultExpiration)
+	return c.get(key, DefaultExpiration)
+}
+
+// GetState retrieves a value of the state kept across messages, bounded by StateTimeout
+func (c *Client) GetState(key string) (string, error) {
+	return c.get(key, StateTimeout)
+}
+
+func (c *Client) get(key string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	val, err := c.client.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return "", fmt.Errorf("key '%s' not found", key)
+			return "", fmt.Errorf("key '%s' %w", key, ErrNotFound)
 		}
 		return "", fmt.Errorf("failed to get key '%s': %w", key, err)
 	}
@@ -250,7 +275,16 @@ func (c *Client) Get(key string) (string, error) {
 
 // Set stores a value in Redis with optional expiration
 func (c *Client) Set(key, value string, expiration time.Duration) error {
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultExpiration)
+	return c.set(key, value, expiration, DefaultExpiration)
+}
+
+// SetState stores a value of the state kept across messages without expiration, bounded by StateTimeout
+func (c *Client) SetState(key, value string) error {
+	return c.set(key, value, 0, StateTimeout)
+}
+
+func (c *Client) set(key, value string, expiration time.Duration, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	err := c.client.Set(ctx, key, value, expiration).Err()
@@ -261,6 +295,143 @@ func (c *Client) Set(key, value string, expiration time.Duration) error {
 	return nil
 }
 
+// SetNX stores a value with an expiration only when the key does not exist (SET NX EX), it returns whether
+// the value was stored
+func (c *Client) SetNX(key, value string, expiration time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DedupTimeout)
+	defer cancel()
+
+	ok, err := c.client.SetNX(ctx, key, value, expiration).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to set key '%s': %w", key, err)
+	}
+
+	return ok, nil
+}
+
+// Del removes a key, removing a missing key is not an error
+func (c *Client) Del(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DedupTimeout)
+	defer cancel()
+
+	err := c.client.Del(ctx, key).Err()
+	if err != nil {
+		return fmt.Errorf("failed to delete key '%s': %w", key, err)
+	}
+
+	return nil
+}
+
+// ScoredMember is a member of a sorted set with its score
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+// Script is a Lua script Redis runs atomically, the keys it touches must share a hash tag to be in the same
+// cluster slot
+type Script struct {
+	script *redis.Script
+}
+
+func NewScript(src string) *Script {
+	return &Script{script: redis.NewScript(src)}
+}
+
+// Run runs a script with its keys and arguments, bounded by StateTimeout, a nil reply is returned as nil
+func (c *Client) Run(script *Script, keys []string, args ...interface{}) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), StateTimeout)
+	defer cancel()
+
+	result, err := script.script.Run(ctx, c.client, keys, args...).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to run script on '%s': %w", strings.Join(keys, "', '"), err)
+	}
+
+	return result, nil
+}
+
+// SAdd adds a member to a set
+func (c *Client) SAdd(key, member string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), StateTimeout)
+	defer cancel()
+
+	err := c.client.SAdd(ctx, key, member).Err()
+	if err != nil {
+		return fmt.Errorf("failed to add to set '%s': %w", key, err)
+	}
+
+	return nil
+}
+
+// SMembers returns the members of a set
+func (c *Client) SMembers(key string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), StateTimeout)
+	defer cancel()
+
+	members, err := c.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read set '%s': %w", key, err)
+	}
+
+	return members, nil
+}
+
+// HMGet retrieves fields of a hash in a single call, the missing fields are left out of the result
+func (c *Client) HMGet(key string, fields ...string) (map[string]string, error) {
+	values := make(map[string]string, len(fields))
+	if len(fields) == 0 {
+		return values, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), StateTimeout)
+	defer cancel()
+
+	result, err := c.client.HMGet(ctx, key, fields...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fields of '%s': %w", key, err)
+	}
+
+	for i, value := range result {
+		if s, ok := value.(string); ok {
+			values[fields[i]] = s
+		}
+	}
+	return values, nil
+}
+
+// ZRangeByScore returns the members of a sorted set scored between min and max, lowest first
+func (c *Client) ZRangeByScore(key string, min, max float64) ([]ScoredMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), StateTimeout)
+	defer cancel()
+
+	zs, err := c.client.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+		Min: scoreBound(min),
+		Max: scoreBound(max),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sorted set '%s': %w", key, err)
+	}
+
+	members := make([]ScoredMember, 0, len(zs))
+	for _, z := range zs {
+		member, _ := z.Member.(string)
+		members = append(members, ScoredMember{Member: member, Score: z.Score})
+	}
+	return members, nil
+}
+
+func scoreBound(score float64) string {
+	switch {
+	case math.IsInf(score, -1):
+		return "-inf"
+	case math.IsInf(score, 1):
+		return "+inf"
+	default:
+		return strconv.FormatFloat(score, 'f', -1, 64)
+	}
+}
+
 // Close closes the Redis connection
 func (c *Client) Close() error {
 	return c.client.Close()
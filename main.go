@@ -2,15 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Go-routine-4595/DataEnricher/adapters/controller"
 	"github.com/Go-routine-4595/DataEnricher/adapters/gateways"
 	"github.com/Go-routine-4595/DataEnricher/internal/config"
 	"github.com/Go-routine-4595/DataEnricher/internal/dynatrace"
+	"github.com/Go-routine-4595/DataEnricher/internal/encoding"
+	"github.com/Go-routine-4595/DataEnricher/internal/outbox"
 	"github.com/Go-routine-4595/DataEnricher/service"
 	"github.com/Go-routine-4595/DataEnricher/usecase"
 
@@ -20,11 +27,29 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "check" {
+		os.Exit(configCheck(os.Args[3:]))
+	}
+	if len(os.Args) > 2 && os.Args[1] == "rules" && os.Args[2] == "test" {
+		os.Exit(rulesTest(os.Args[3:]))
+	}
+
 	// Load configuration
-	cfg := config.Load()
+	cfg, err := config.Load(os.Args[1:], configValidators...)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
 
-	// Setup context for cancellation
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	// Setup context for cancellation, ctx ends on the shutdown signal and aborts the startup while runCtx
+	// keeps the components alive until the queue is drained
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	// Setup logger
 	logger := setupLogger(cfg.LogLevel, cfg.LogFilePath)
@@ -33,20 +58,21 @@ func main() {
 	printConfig(*cfg, &logger)
 
 	// Setup Redis client
-	redis, err := gateways.NewRepository(cfg.RedisConnectionString, &logger)
+	redis, err := gateways.NewRepository(cfg.RedisConnectionString.Value(), &logger)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to connect to Redis")
 	}
+	redis.WithCacheTTL(cfg.RegistryCacheTTL)
 	if redis.IsConnected() == false {
 		logger.Fatal().Msg("Failed to connect to Redis")
 	}
 	logger.Info().Msg("Connected to Redis")
-	defer redis.Close()
 
 	// Setup Dynatrace client
 	var dynatraceClient *dynatrace.DynatraceClient
 	if cfg.DynatraceEnabled {
-		dynatraceClient = dynatrace.NewDynatraceClient(&logger)
+		dynatraceClient = dynatrace.NewDynatraceClient(&logger).WithExporter(cfg.DynatraceIngestURL, cfg.DynatraceAPIToken.Value())
+		go dynatraceClient.Run(runCtx, cfg.DynatraceFlushPeriod)
 		logger.Info().Msg("Dynatrace metrics enabled")
 	} else {
 		dynatraceClient = dynatrace.NewDynatraceClient(&logger)
@@ -55,30 +81,260 @@ func main() {
 	}
 
 	// Setup publisher client
-	pub := gateways.NewPublish(cfg, &logger)
-	defer pub.Close()
+	pub := gateways.NewPublish(cfg, &logger).WithConnectionObserver(dynatraceClient)
+	if cfg.OutboxDir != "" {
+		ob, err := outbox.Open(cfg.OutboxDir, outbox.Options{
+			MaxBytes:     cfg.OutboxMaxBytes,
+			MaxAge:       cfg.OutboxMaxAge,
+			SegmentBytes: cfg.OutboxSegmentBytes,
+		}, &logger)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to open outbox")
+		}
+		pub.WithOutbox(ob, dynatraceClient)
+		go pub.Run(runCtx)
+	}
+	err = pub.Start(ctx)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to start publisher")
+	}
 
 	// Setup service and use case
-	srv := service.NewService(redis, &logger)
-	useCase := usecase.NewUseCase(pub, srv, dynatraceClient, cfg.PublishTopicBase, &logger, ctx)
+	srv := service.NewService(redis, &logger).WithRegistryProjection(cfg.RegistryFields, cfg.RegistryOmitRaw)
+	switch cfg.Dedup {
+	case "memory":
+		srv.WithDeduplication(service.NewMemorySeenSet(cfg.DedupCapacity), cfg.DedupWindow, dynatraceClient)
+	case "redis":
+		srv.WithDeduplication(redis, cfg.DedupWindow, dynatraceClient)
+	}
+	if cfg.ClockSkew != "off" {
+		srv.WithClockSkew(service.NewClockSkew(cfg.ClockSkewMaxFuture, cfg.ClockSkewMaxPast, cfg.ClockSkew == "reject"))
+	}
+	var sequenceState service.ISequenceState
+	switch cfg.Sequence {
+	case "memory":
+		sequenceState = service.NewMemorySequenceState()
+	case "redis":
+		sequenceState = redis
+	}
+	if sequenceState != nil {
+		srv.WithSequence(service.NewSequencer(sequenceState, cfg.SequenceIntervalPath, cfg.SequenceInterval, cfg.SequenceMissed))
+	}
+	if cfg.CalibrationEnabled {
+		srv.WithTransforms(service.NewCalibration(cfg.CalibrationPath))
+	}
+	if cfg.UnitConversion {
+		srv.WithTransforms(service.NewUnitConversion(redis, cfg.UnknownUnits == "reject"))
+	}
+	switch cfg.SchemaSource {
+	case "dir":
+		srv.WithSchemaValidator(service.NewSchemaValidator(gateways.NewSchemaDirectory(cfg.SchemaDir),
+			service.SchemaMode(cfg.SchemaDefaultMode), cfg.SchemaModes, &logger))
+	case "redis":
+		srv.WithSchemaValidator(service.NewSchemaValidator(redis,
+			service.SchemaMode(cfg.SchemaDefaultMode), cfg.SchemaModes, &logger))
+	}
+	shaper, err := usecase.NewShaper(cfg.OutputShape, cfg.OutputShapes)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid output shape")
+	}
+	useCase := usecase.NewUseCase(pub, srv, dynatraceClient, cfg.PublishTopicBase, &logger).
+		WithDeadLetterTopic(cfg.DeadLetterTopic).
+		WithShaper(shaper)
+	for sink, name := range cfg.Encodings {
+		encoder, err := encoding.New(name, encoding.Options{AvroSchemaID: cfg.AvroSchemaID})
+		if err != nil {
+			logger.Fatal().Err(err).Msgf("Invalid encoding of sink %s", sink)
+		}
+		useCase.WithEncoder(sink, encoder)
+		logger.Info().Msgf("Sink %s encoded as %s", sink, encoder.ContentType())
+	}
+	if cfg.Compression != "" {
+		compressor, err := encoding.NewCompressor(cfg.Compression, cfg.CompressionThreshold)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid compression")
+		}
+		useCase.WithCompression(compressor)
+	}
+	router, err := usecase.NewTopicRouter(cfg.PublishTopicBase, cfg.PublishTopicTemplate)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid publish topic template")
+	}
+	useCase.SetRouter(router)
+	if cfg.AlertTopic != "" {
+		alertRouter, err := usecase.NewTopicRouter(cfg.PublishTopicBase, cfg.AlertTopic)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid alert topic")
+		}
+		var state service.IAlertState = service.NewMemoryAlertState()
+		if cfg.AlertState == "redis" {
+			state = redis
+		}
+		useCase.WithAlerts(service.NewAlerter(cfg.AlertThresholdsPath, state), alertRouter)
+	}
+	if cfg.AnomalyDetection {
+		var anomalyRouter *usecase.TopicRouter
+		if cfg.AnomalyTopic != "" {
+			anomalyRouter, err = usecase.NewTopicRouter(cfg.PublishTopicBase, cfg.AnomalyTopic)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("Invalid anomaly topic template")
+			}
+		}
+		detector := service.NewAnomalyDetector(redis, cfg.AnomalyLimitsPath, service.AnomalyOptions{
+			Alpha:  cfg.AnomalyAlpha,
+			ZScore: cfg.AnomalyZScore,
+			Warmup: cfg.AnomalyWarmup,
+		})
+		useCase.WithAnomalies(detector, anomalyRouter, cfg.AnomalyCheckpoint)
+	}
+	if len(cfg.AggregateWindows) > 0 {
+		aggregateRouter, err := usecase.NewTopicRouter(cfg.PublishTopicBase, cfg.AggregateTopic)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid aggregate topic template")
+		}
+		useCase.WithAggregator(usecase.NewAggregator(cfg.AggregateWindows, cfg.AggregateLateness, aggregateRouter))
+	}
+	if cfg.GapTopic != "" {
+		gapRouter, err := usecase.NewTopicRouter(cfg.PublishTopicBase, cfg.GapTopic)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid gap topic")
+		}
+		useCase.WithGaps(gapRouter)
+	}
+	if cfg.SummaryInterval > 0 {
+		summaryRouter, err := usecase.NewTopicRouter(cfg.PublishTopicBase, cfg.SummaryTopic)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid summary topic template")
+		}
+		useCase.WithSummary(usecase.NewSummarizer(cfg.SummaryInterval, cfg.SummaryActiveWindow, summaryRouter))
+	}
+	if cfg.LivenessTopic != "" {
+		livenessRouter, err := usecase.NewTopicRouter(cfg.PublishTopicBase, cfg.LivenessTopic)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid liveness topic")
+		}
+		liveness := service.NewLiveness(redis, cfg.LivenessIntervalPath, cfg.LivenessInterval, cfg.LivenessMissed)
+		useCase.WithLiveness(liveness, livenessRouter, cfg.LivenessCheck)
+	}
+	var rules usecase.IRuleSource
+	switch cfg.RulesSource {
+	case "file":
+		rules = gateways.NewRuleFile(cfg.RulesFile)
+	case "redis":
+		rules = redis
+	}
+	if rules != nil {
+		ruleSet, err := usecase.LoadRules(rules, cfg.PublishTopicBase)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid rules")
+		}
+		useCase.WithRules(rules, ruleSet)
+		logger.Info().Msgf("Loaded %d rules", ruleSet.Len())
+	}
+	if cfg.BatchEnabled {
+		batchRouter, err := usecase.NewTopicRouter(cfg.PublishTopicBase, cfg.BatchTopicTemplate)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid batch topic template")
+		}
+		useCase.WithBatcher(usecase.NewBatcher(batchRouter, usecase.BatchOptions{
+			MaxCount:   cfg.BatchMaxCount,
+			MaxBytes:   cfg.BatchMaxBytes,
+			MaxLatency: cfg.BatchMaxLatency,
+		}))
+	}
+
+	useCase.Start(runCtx)
 
 	// Setup MQTT controller
-	ctl := controller.NewMqttController(cfg, useCase, &logger)
+	ctl := controller.NewMqttController(cfg, useCase, &logger).WithConnectionObserver(dynatraceClient)
 
 	err = ctl.Start(ctx)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to start controller")
 	}
 
-	// Setup signal handler for graceful shutdown
-	//sigChan := make(chan os.Signal, 1)
-	//signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// Setup schema API, the admin API serves the schema routes when it has no address
+	if cfg.SchemaAddr != "" {
+		err = controller.NewSchemaController(cfg, &logger).Start(runCtx)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to start schema API")
+		}
+	}
+
+	// Setup admin API
+	if cfg.AdminAddr != "" {
+		admin := controller.NewAdminController(cfg, useCase, ctl, srv, srv, &logger)
+		err = admin.Start(runCtx)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to start admin API")
+		}
+	}
+
+	// Setup configuration reload on SIGHUP and config file changes
+	reload := &reloader{
+		cfg:        cfg,
+		args:       os.Args[1:],
+		logger:     &logger,
+		controller: ctl,
+		useCase:    useCase,
+		repository: redis,
+		dynatrace:  dynatraceClient,
+	}
+	go reload.Run(ctx)
 
-	// Wait for signal
-	//sig := <-sigChan
+	// Wait for SIGINT or SIGTERM
 	<-ctx.Done()
+	// Restore the default signal handling so a second signal forces the exit during the drain
+	stop()
+	logger.Info().Msg("Received shutdown signal. Shutting down gracefully, signal again to force the exit...")
+
+	// Stop the input first so nothing new is queued, then drain what is queued
+	err = ctl.Unsubscribe()
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to unsubscribe from input")
+	}
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	drained, abandoned := useCase.Drain(drainCtx)
+	cancelDrain()
+	if abandoned > 0 {
+		logger.Warn().Msgf("Shutdown deadline of %s reached: drained %d queued messages, abandoned %d", cfg.ShutdownTimeout, drained, abandoned)
+	} else {
+		logger.Info().Msgf("Drained %d queued messages", drained)
+	}
+
+	// Flush metrics while the process can still report, then release the connections
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	err = dynatraceClient.Flush(flushCtx)
+	cancelFlush()
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to flush metrics to Dynatrace")
+	}
+
 	cancel()
-	logger.Info().Msg("Received signal SIGINIT. Shutting down gracefully...")
+	ctl.Stop()
+	pub.Close()
+	redis.Close()
+	logger.Info().Msg("Shutdown complete")
+}
+
+// configCheck validates the configuration and prints the effective merged result
+func configCheck(args []string) int {
+	cfg, err := config.Load(args, configValidators...)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		return 1
+	}
+
+	b, err := cfg.YAML()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to render configuration: %v\n", err)
+		return 1
+	}
+	fmt.Print(string(b))
+	return 0
 }
 
 func setupLogger(level string, logDir string) zerolog.Logger {
@@ -103,7 +359,14 @@ func setupLogger(level string, logDir string) zerolog.Logger {
 		fileWriter,
 	)
 
-	// Set global log level
+	setLogLevel(level)
+
+	// Set global logger
+	return zerolog.New(multi).With().Timestamp().Logger()
+}
+
+// setLogLevel sets the global log level, unknown levels fall back to info
+func setLogLevel(level string) {
 	switch strings.ToLower(level) {
 	case "debug":
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
@@ -116,9 +379,6 @@ func setupLogger(level string, logDir string) zerolog.Logger {
 	default:
 		zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	}
-
-	// Set global logger
-	return zerolog.New(multi).With().Timestamp().Logger()
 }
 
 func printConfig(cfg config.Config, logger *zerolog.Logger) {
@@ -126,11 +386,81 @@ func printConfig(cfg config.Config, logger *zerolog.Logger) {
 	logger.Info().Str("LOG_LEVEL", cfg.LogLevel).Msg("Log level")
 	logger.Info().Str("HOST", cfg.Host).Msg("MQTT host")
 	logger.Info().Int("PORT", cfg.Port).Msg("MQTT port")
-	logger.Info().Str("REDIS_CONNECTION_STRING", cfg.RedisConnectionString).Msg("Redis connection string")
+	logger.Info().Stringer("REDIS_CONNECTION_STRING", cfg.RedisConnectionString).Msg("Redis connection string")
 	logger.Info().Str("PUBLISH_TOPIC_BASE", cfg.PublishTopicBase).Msg("Publish topic base")
+	logger.Info().Str("PUBLISH_TOPIC_TEMPLATE", cfg.PublishTopicTemplate).Msg("Publish topic template")
 	logger.Info().Str("USER", cfg.User).Msg("MQTT user")
-	logger.Info().Str("PASSWORD", cfg.Password).Msg("MQTT password")
+	logger.Info().Stringer("PASSWORD", cfg.Password).Msg("MQTT password")
 	logger.Info().Str("LOG_FILE_PATH", cfg.LogFilePath).Msg("Log file path")
 	logger.Info().Str("SUBSCRIPTION_TOPIC", cfg.SubscriptionTopic).Msg("Subscription topic")
+	logger.Info().Str("MQTT_STARTUP_POLICY", cfg.MQTTStartupPolicy).Msg("MQTT startup policy")
+	logger.Info().Str("MQTT_STARTUP_TIMEOUT", cfg.MQTTStartupTimeout.String()).Msg("MQTT startup timeout")
+	logger.Info().Str("MQTT_PUBLISH_TIMEOUT", cfg.MQTTPublishTimeout.String()).Msg("MQTT publish timeout")
+	logger.Info().Str("MQTT_RETRY_MAX_INTERVAL", cfg.MQTTRetryMax.String()).Msg("MQTT max retry interval")
 	logger.Info().Bool("DYNATRACE_ENABLED", cfg.DynatraceEnabled).Msg("Dynatrace enabled")
+	logger.Info().Str("DYNATRACE_INGEST_URL", cfg.DynatraceIngestURL).Msg("Dynatrace ingest URL")
+	logger.Info().Stringer("DYNATRACE_API_TOKEN", cfg.DynatraceAPIToken).Msg("Dynatrace API token")
+	logger.Info().Str("REGISTRY_CACHE_TTL", cfg.RegistryCacheTTL.String()).Msg("Registry cache TTL")
+	logger.Info().Str("ADMIN_ADDR", cfg.AdminAddr).Msg("Admin API address")
+	logger.Info().Str("SCHEMA_ADDR", cfg.SchemaAddr).Msg("Schema API address")
+	logger.Info().Str("CONFIG_FILE", cfg.File).Msg("Config file")
+	logger.Info().Str("CONFIG_WATCH_INTERVAL", cfg.ConfigWatchInterval.String()).Msg("Config watch interval")
+	logger.Info().Str("SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout.String()).Msg("Shutdown timeout")
+	logger.Info().Str("OUTBOX_DIR", cfg.OutboxDir).Msg("Outbox directory")
+	logger.Info().Int64("OUTBOX_MAX_BYTES", cfg.OutboxMaxBytes).Msg("Outbox size cap")
+	logger.Info().Str("OUTBOX_MAX_AGE", cfg.OutboxMaxAge.String()).Msg("Outbox max age")
+	logger.Info().Str("SCHEMA_SOURCE", cfg.SchemaSource).Msg("Payload schema source")
+	logger.Info().Str("SCHEMA_DIR", cfg.SchemaDir).Msg("Payload schema directory")
+	logger.Info().Str("SCHEMA_DEFAULT_MODE", cfg.SchemaDefaultMode).Msg("Payload schema default mode")
+	logger.Info().Stringer("SCHEMA_MODES", cfg.SchemaModes).Msg("Payload schema modes")
+	logger.Info().Str("OUTPUT_SHAPE", cfg.OutputShape).Msg("Output shape")
+	logger.Info().Stringer("OUTPUT_SHAPES", cfg.OutputShapes).Msg("Output shapes")
+	logger.Info().Stringer("REGISTRY_FIELDS", cfg.RegistryFields).Msg("Registry fields")
+	logger.Info().Bool("REGISTRY_OMIT_RAW", cfg.RegistryOmitRaw).Msg("Omit raw registry")
+	logger.Info().Bool("CALIBRATION_ENABLED", cfg.CalibrationEnabled).Msg("Calibration enabled")
+	logger.Info().Str("CALIBRATION_PATH", cfg.CalibrationPath).Msg("Calibration registry path")
+	logger.Info().Bool("UNIT_CONVERSION", cfg.UnitConversion).Msg("Unit conversion")
+	logger.Info().Str("UNKNOWN_UNITS", cfg.UnknownUnits).Msg("Unknown units")
+	logger.Info().Str("CLOCK_SKEW", cfg.ClockSkew).Msg("Clock skew")
+	logger.Info().Str("CLOCK_SKEW_MAX_FUTURE", cfg.ClockSkewMaxFuture.String()).Msg("Clock skew max future")
+	logger.Info().Str("CLOCK_SKEW_MAX_PAST", cfg.ClockSkewMaxPast.String()).Msg("Clock skew max past")
+	logger.Info().Str("DEDUP", cfg.Dedup).Msg("Deduplication")
+	logger.Info().Str("DEDUP_WINDOW", cfg.DedupWindow.String()).Msg("Deduplication window")
+	logger.Info().Str("SEQUENCE", cfg.Sequence).Msg("Sequence tracking")
+	logger.Info().Str("SEQUENCE_INTERVAL_PATH", cfg.SequenceIntervalPath).Msg("Sequence interval registry path")
+	logger.Info().Str("SEQUENCE_DEFAULT_INTERVAL", cfg.SequenceInterval.String()).Msg("Sequence default interval")
+	logger.Info().Int("SEQUENCE_MISSED_REPORTS", cfg.SequenceMissed).Msg("Sequence missed reports")
+	logger.Info().Str("GAP_TOPIC", cfg.GapTopic).Msg("Gap topic")
+	logger.Info().Stringer("ENCODINGS", cfg.Encodings).Msg("Encodings")
+	logger.Info().Str("COMPRESSION", cfg.Compression).Msg("Compression")
+	logger.Info().Int("COMPRESSION_THRESHOLD", cfg.CompressionThreshold).Msg("Compression threshold")
+	logger.Info().Str("ALERT_TOPIC", cfg.AlertTopic).Msg("Alert topic")
+	logger.Info().Str("ALERT_THRESHOLDS_PATH", cfg.AlertThresholdsPath).Msg("Alert thresholds registry path")
+	logger.Info().Str("ALERT_STATE", cfg.AlertState).Msg("Alert state")
+	logger.Info().Bool("ANOMALY_DETECTION", cfg.AnomalyDetection).Msg("Anomaly detection")
+	logger.Info().Str("ANOMALY_TOPIC_TEMPLATE", cfg.AnomalyTopic).Msg("Anomaly topic template")
+	logger.Info().Str("ANOMALY_LIMITS_PATH", cfg.AnomalyLimitsPath).Msg("Anomaly limits registry path")
+	logger.Info().Float64("ANOMALY_ALPHA", cfg.AnomalyAlpha).Msg("Anomaly alpha")
+	logger.Info().Float64("ANOMALY_ZSCORE", cfg.AnomalyZScore).Msg("Anomaly z-score")
+	logger.Info().Int("ANOMALY_WARMUP", cfg.AnomalyWarmup).Msg("Anomaly warmup")
+	logger.Info().Str("ANOMALY_CHECKPOINT_INTERVAL", cfg.AnomalyCheckpoint.String()).Msg("Anomaly checkpoint interval")
+	logger.Info().Stringer("AGGREGATE_WINDOWS", cfg.AggregateWindows).Msg("Aggregate windows")
+	logger.Info().Str("AGGREGATE_TOPIC_TEMPLATE", cfg.AggregateTopic).Msg("Aggregate topic template")
+	logger.Info().Str("AGGREGATE_ALLOWED_LATENESS", cfg.AggregateLateness.String()).Msg("Aggregate allowed lateness")
+	logger.Info().Str("SUMMARY_INTERVAL", cfg.SummaryInterval.String()).Msg("Summary interval")
+	logger.Info().Str("SUMMARY_TOPIC_TEMPLATE", cfg.SummaryTopic).Msg("Summary topic template")
+	logger.Info().Str("SUMMARY_ACTIVE_WINDOW", cfg.SummaryActiveWindow.String()).Msg("Summary active window")
+	logger.Info().Str("LIVENESS_TOPIC", cfg.LivenessTopic).Msg("Liveness topic")
+	logger.Info().Str("LIVENESS_INTERVAL_PATH", cfg.LivenessIntervalPath).Msg("Liveness interval registry path")
+	logger.Info().Str("LIVENESS_DEFAULT_INTERVAL", cfg.LivenessInterval.String()).Msg("Liveness default interval")
+	logger.Info().Int("LIVENESS_MISSED_REPORTS", cfg.LivenessMissed).Msg("Liveness missed reports")
+	logger.Info().Str("LIVENESS_CHECK_INTERVAL", cfg.LivenessCheck.String()).Msg("Liveness check interval")
+	logger.Info().Str("RULES_SOURCE", cfg.RulesSource).Msg("Rules source")
+	logger.Info().Str("RULES_FILE", cfg.RulesFile).Msg("Rules file")
+	logger.Info().Bool("BATCH_ENABLED", cfg.BatchEnabled).Msg("Batching")
+	logger.Info().Str("BATCH_TOPIC_TEMPLATE", cfg.BatchTopicTemplate).Msg("Batch topic template")
+	logger.Info().Int("BATCH_MAX_COUNT", cfg.BatchMaxCount).Msg("Batch max count")
+	logger.Info().Int("BATCH_MAX_BYTES", cfg.BatchMaxBytes).Msg("Batch max bytes")
+	logger.Info().Str("BATCH_MAX_LATENCY", cfg.BatchMaxLatency.String()).Msg("Batch max latency")
+	logger.Info().Str("DEAD_LETTER_TOPIC", cfg.DeadLetterTopic).Msg("Dead-letter topic")
 }
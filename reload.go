@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/adapters/controller"
+	"github.com/Go-routine-4595/DataEnricher/adapters/gateways"
+	"github.com/Go-routine-4595/DataEnricher/internal/config"
+	"github.com/Go-routine-4595/DataEnricher/internal/dynatrace"
+	"github.com/Go-routine-4595/DataEnricher/usecase"
+
+	"github.com/rs/zerolog"
+)
+
+// Reload outcomes, reported in the logs and as the outcome dimension of the reload metric
+const (
+	reloadApplied   = "applied"
+	reloadPartial   = "partial"
+	reloadUnchanged = "unchanged"
+	reloadFailed    = "failed"
+)
+
+// reloader re-reads the configuration on SIGHUP or when the config file changes and applies the
+// settings that can change without a restart, the others are reported and keep their current value
+type reloader struct {
+	mu         sync.Mutex
+	cfg        *config.Config
+	args       []string
+	logger     *zerolog.Logger
+	controller *controller.MqttController
+	useCase    *usecase.UseCase
+	repository *gateways.Repository
+	dynatrace  *dynatrace.DynatraceClient
+}
+
+// Run reloads on SIGHUP and, when a config file is used, whenever its modification time changes
+func (r *reloader) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var (
+		tick    <-chan time.Time
+		modTime time.Time
+	)
+	if r.cfg.File != "" && r.cfg.ConfigWatchInterval > 0 {
+		ticker := time.NewTicker(r.cfg.ConfigWatchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+		modTime = fileModTime(r.cfg.File)
+		r.logger.Info().Msgf("Watching %s for changes every %s", r.cfg.File, r.cfg.ConfigWatchInterval)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logger.Info().Msg("Received SIGHUP, reloading configuration")
+			r.Reload()
+		case <-tick:
+			current := fileModTime(r.cfg.File)
+			if current.Equal(modTime) {
+				continue
+			}
+			modTime = current
+			r.logger.Info().Msgf("Config file %s changed, reloading configuration", r.cfg.File)
+			r.Reload()
+		}
+	}
+}
+
+// Reload loads the configuration again and applies the reloadable settings that changed
+func (r *reloader) Reload() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	outcome, err := r.reload()
+	if err != nil {
+		r.logger.Error().Msgf("Configuration reload %s: %v", outcome, err)
+	} else {
+		r.logger.Info().Msgf("Configuration reload %s", outcome)
+	}
+	r.dynatrace.RecordConfigReload(outcome)
+	return outcome
+}
+
+func (r *reloader) reload() (string, error) {
+	next, err := config.Load(r.args, configValidators...)
+	if err != nil {
+		return reloadFailed, err
+	}
+
+	live, restart := r.cfg.Diff(next)
+	if len(live) == 0 && len(restart) == 0 {
+		return reloadUnchanged, nil
+	}
+	if len(restart) > 0 {
+		r.logger.Warn().Msgf("Configuration changes require a restart and were not applied: %s", strings.Join(restart, ", "))
+	}
+
+	// Build the router up front so a bad template rejects the reload before anything is applied, the base needs a
+	// restart so the current one is kept
+	router, err := usecase.NewTopicRouter(r.cfg.PublishTopicBase, next.PublishTopicTemplate)
+	if err != nil {
+		return reloadFailed, fmt.Errorf("publish_topic_template: %w", err)
+	}
+
+	var errs []error
+	for _, name := range live {
+		switch name {
+		case "subscription_topic":
+			if err := r.controller.SetSubscriptionTopic(next.SubscriptionTopic); err != nil {
+				errs = append(errs, fmt.Errorf("subscription_topic: %w", err))
+				continue
+			}
+			r.cfg.SubscriptionTopic = next.SubscriptionTopic
+		case "publish_topic_template":
+			r.useCase.SetRouter(router)
+			r.cfg.PublishTopicTemplate = next.PublishTopicTemplate
+		case "log_level":
+			setLogLevel(next.LogLevel)
+			r.cfg.LogLevel = next.LogLevel
+		case "registry_cache_ttl":
+			r.repository.WithCacheTTL(next.RegistryCacheTTL)
+			r.cfg.RegistryCacheTTL = next.RegistryCacheTTL
+		}
+		r.logger.Info().Msgf("Applied configuration change: %s", name)
+	}
+
+	if len(errs) > 0 {
+		return reloadFailed, errors.Join(errs...)
+	}
+	if len(restart) > 0 {
+		return reloadPartial, nil
+	}
+	return reloadApplied, nil
+}
+
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Go-routine-4595/DataEnricher/adapters/gateways"
+	"github.com/Go-routine-4595/DataEnricher/domain"
+	"github.com/Go-routine-4595/DataEnricher/internal/config"
+	"github.com/Go-routine-4595/DataEnricher/usecase"
+)
+
+// rulesTest evaluates a rule file against sample inbound messages and prints the outcome of every rule,
+// it returns 1 when a rule or a sample is invalid
+func rulesTest(args []string) int {
+	fs := flag.NewFlagSet("rules test", flag.ContinueOnError)
+	rulesFile := fs.String("rules", "", "YAML or JSON rule file")
+	registryFile := fs.String("registry", "", "registry entry used for the samples that have no registry field")
+	base := fs.String("publish-topic-base", config.Default().PublishTopicBase, "base of the route topics")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: DataEnricher rules test -rules <file> [-registry <file>] <sample>...")
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+	if *rulesFile == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	rules, err := usecase.LoadRules(gateways.NewRuleFile(*rulesFile), *base)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid rules:\n%v\n", err)
+		return 1
+	}
+	var registry []byte
+	if *registryFile != "" {
+		registry, err = os.ReadFile(*registryFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read registry: %v\n", err)
+			return 1
+		}
+	}
+
+	status := 0
+	for _, sample := range fs.Args() {
+		msg, err := loadSample(sample, registry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", sample, err)
+			status = 1
+			continue
+		}
+
+		result := rules.Evaluate(msg)
+		fmt.Println(sample)
+		for _, match := range result.Matches {
+			switch {
+			case match.Err != nil:
+				fmt.Printf("  %s: error: %s\n", match.Rule, strings.ReplaceAll(match.Err.Error(), "\n", "\n    "))
+				status = 1
+			case match.Matched && match.Topic != "":
+				fmt.Printf("  %s: matched, route to %s\n", match.Rule, match.Topic)
+			case match.Matched:
+				fmt.Printf("  %s: matched\n", match.Rule)
+			default:
+				fmt.Printf("  %s: no match\n", match.Rule)
+			}
+		}
+		switch {
+		case result.Drop != "":
+			fmt.Printf("  => dropped by %s\n", result.Drop)
+		case len(result.Routes) > 0:
+			fmt.Printf("  => published, also to %s\n", strings.Join(result.Routes, ", "))
+		default:
+			fmt.Println("  => published")
+		}
+	}
+	return status
+}
+
+// loadSample reads an inbound message and enriches it with its registry field, or registry when it has none
+func loadSample(path string, registry []byte) (domain.EnrichedMessage, error) {
+	var (
+		msg    domain.EnrichedMessage
+		sample struct {
+			Registry json.RawMessage `json:"registry"`
+		}
+	)
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return msg, err
+	}
+	err = json.Unmarshal(b, &msg)
+	if err != nil {
+		return msg, err
+	}
+	err = json.Unmarshal(b, &sample)
+	if err != nil {
+		return msg, err
+	}
+	if len(sample.Registry) > 0 {
+		registry = sample.Registry
+	}
+	if len(registry) > 0 {
+		err = msg.Enrich(registry)
+		if err != nil {
+			return msg, fmt.Errorf("registry: %w", err)
+		}
+	}
+	err = msg.ParseGeoKonPayload()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: payload values unavailable to the rules: %v\n", path, err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// IAlertState keeps the alert level of every device metric, keyed by <deviceId>/<metric>
+type IAlertState interface {
+	AlertLevel(key string) (domain.AlertLevel, error)
+	SetAlertLevel(key string, level domain.AlertLevel) error
+}
+
+// ThresholdLimits are the limits of one direction, nil when not set
+type ThresholdLimits struct {
+	Warning  *float64 `json:"warning"`
+	Critical *float64 `json:"critical"`
+}
+
+// MetricThresholds raises an alert when the value reaches a high limit or falls to a low limit, the alert
+// only goes back down once the value is hysteresis past the limit
+type MetricThresholds struct {
+	High       ThresholdLimits `json:"high"`
+	Low        ThresholdLimits `json:"low"`
+	Hysteresis float64         `json:"hysteresis"`
+}
+
+// ErrAlert is returned when the alerts of a message cannot be evaluated
+type ErrAlert struct {
+	DeviceID string
+	Err      error
+}
+
+func (e *ErrAlert) Error() string {
+	return fmt.Sprintf("alerts of device %s: %v", e.DeviceID, e.Err)
+}
+
+func (e *ErrAlert) Unwrap() error {
+	return e.Err
+}
+
+// Alerter evaluates every observation against the thresholds found in the registry at path and returns
+// an alert each time the level of a device metric changes
+type Alerter struct {
+	path  string
+	state IAlertState
+}
+
+func NewAlerter(path string, state IAlertState) *Alerter {
+	return &Alerter{path: path, state: state}
+}
+
+// Evaluate returns the alerts raised or cleared by the observations of the message, in observation order,
+// the values are the engineering values of the calibrated metrics
+func (a *Alerter) Evaluate(msg domain.EnrichedMessage) ([]domain.Alert, error) {
+	raw, ok := msg.RegistryValue(a.path)
+	if !ok || msg.GeoKon == nil || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var thresholds map[string]MetricThresholds
+	err := json.Unmarshal(raw, &thresholds)
+	if err != nil {
+		return nil, &ErrAlert{DeviceID: msg.DeviceID, Err: fmt.Errorf("registry %s: %w", a.path, err)}
+	}
+	err = checkThresholds(thresholds)
+	if err != nil {
+		return nil, &ErrAlert{DeviceID: msg.DeviceID, Err: fmt.Errorf("registry %s: %w", a.path, err)}
+	}
+
+	var (
+		alerts []domain.Alert
+		errs   []error
+	)
+	payload := msg.GeoKon
+	for j, metric := range payload.Metric {
+		t, ok := thresholds[metric]
+		if !ok {
+			continue
+		}
+
+		key := msg.DeviceID + "/" + metric
+		current, err := a.state.AlertLevel(key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		previous := current
+
+		for _, o := range payload.Observations {
+			value, unit, ok := payload.Reading(o, j)
+			if !ok {
+				continue
+			}
+			level, threshold := t.level(value, current)
+			if level == current {
+				continue
+			}
+
+			alert := domain.Alert{
+				Event:         domain.AlertRaised,
+				Level:         level,
+				PreviousLevel: current,
+				Time:          o.Time,
+				DeviceID:      msg.DeviceID,
+				SiteCode:      msg.SiteCode,
+				Metric:        metric,
+				Unit:          unit,
+				Value:         value,
+				Threshold:     threshold,
+			}
+			if level == domain.AlertOK {
+				alert.Event = domain.AlertCleared
+			}
+			alerts = append(alerts, alert)
+			current = level
+		}
+
+		if current != previous {
+			err = a.state.SetAlertLevel(key, current)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return alerts, &ErrAlert{DeviceID: msg.DeviceID, Err: errors.Join(errs...)}
+	}
+	return alerts, nil
+}
+
+// level returns the level of value and the limit it reached, a level below current is only taken once the
+// value is hysteresis past the limit of current
+func (t MetricThresholds) level(value float64, current domain.AlertLevel) (domain.AlertLevel, *float64) {
+	level, threshold := t.limit(value, 0)
+	if level.Severity() >= current.Severity() || t.Hysteresis == 0 {
+		return level, threshold
+	}
+
+	held, _ := t.limit(value, t.Hysteresis)
+	if held.Severity() > level.Severity() {
+		if held.Severity() > current.Severity() {
+			held = current
+		}
+		return held, nil
+	}
+	return level, threshold
+}
+
+// limit returns the highest level whose limit value reaches, the limits moved towards value by shift
+func (t MetricThresholds) limit(value float64, shift float64) (domain.AlertLevel, *float64) {
+	switch {
+	case t.High.Critical != nil && value >= *t.High.Critical-shift:
+		return domain.AlertCritical, t.High.Critical
+	case t.Low.Critical != nil && value <= *t.Low.Critical+shift:
+		return domain.AlertCritical, t.Low.Critical
+	case t.High.Warning != nil && value >= *t.High.Warning-shift:
+		return domain.AlertWarning, t.High.Warning
+	case t.Low.Warning != nil && value <= *t.Low.Warning+shift:
+		return domain.AlertWarning, t.Low.Warning
+	default:
+		return domain.AlertOK, nil
+	}
+}
+
+func checkThresholds(thresholds map[string]MetricThresholds) error {
+	var errs []error
+
+	metrics := make([]string, 0, len(thresholds))
+	for metric := range thresholds {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	for _, metric := range metrics {
+		t := thresholds[metric]
+		if t.Hysteresis < 0 {
+			errs = append(errs, fmt.Errorf("%s: negative hysteresis", metric))
+		}
+		if t.High.Warning != nil && t.High.Critical != nil && *t.High.Warning > *t.High.Critical {
+			errs = append(errs, fmt.Errorf("%s: high warning above high critical", metric))
+		}
+		if t.Low.Warning != nil && t.Low.Critical != nil && *t.Low.Warning < *t.Low.Critical {
+			errs = append(errs, fmt.Errorf("%s: low warning below low critical", metric))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MemoryAlertState keeps the alert levels in the process, they are lost on restart
+type MemoryAlertState struct {
+	mu     sync.Mutex
+	levels map[string]domain.AlertLevel
+}
+
+func NewMemoryAlertState() *MemoryAlertState {
+	return &MemoryAlertState{levels: make(map[string]domain.AlertLevel)}
+}
+
+func (m *MemoryAlertState) AlertLevel(key string) (domain.AlertLevel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if level, ok := m.levels[key]; ok {
+		return level, nil
+	}
+	return domain.AlertOK, nil
+}
+
+func (m *MemoryAlertState) SetAlertLevel(key string, level domain.AlertLevel) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if level == domain.AlertOK {
+		delete(m.levels, key)
+		return nil
+	}
+	m.levels[key] = level
+	return nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// failingAlertState fails every read and write
+type failingAlertState struct{}
+
+func (failingAlertState) AlertLevel(string) (domain.AlertLevel, error) {
+	return "", errors.New("state unavailable")
+}
+
+func (failingAlertState) SetAlertLevel(string, domain.AlertLevel) error {
+	return errors.New("state unavailable")
+}
+
+func TestAlerterEvaluate(t *testing.T) {
+	const thresholds = `{"thresholds":{"t":{"high":{"warning":30,"critical":40},"low":{"warning":5},"hysteresis":2}}}`
+
+	tests := []struct {
+		name      string
+		registry  string
+		initial   domain.AlertLevel
+		values    []float64
+		want      []string
+		wantLevel domain.AlertLevel
+		wantErr   bool
+	}{
+		{
+			name:      "within limits",
+			registry:  thresholds,
+			values:    []float64{20, 25},
+			wantLevel: domain.AlertOK,
+		},
+		{
+			name:      "raised then cleared past the hysteresis",
+			registry:  thresholds,
+			values:    []float64{31, 29, 28.5, 27},
+			want:      []string{"raised warning from ok", "cleared ok from warning"},
+			wantLevel: domain.AlertOK,
+		},
+		{
+			name:      "critical held within the hysteresis then lowered",
+			registry:  thresholds,
+			values:    []float64{41, 39, 37, 10},
+			want:      []string{"raised critical from ok", "raised warning from critical", "cleared ok from warning"},
+			wantLevel: domain.AlertOK,
+		},
+		{
+			name:      "low limit",
+			registry:  thresholds,
+			values:    []float64{4, 6, 8},
+			want:      []string{"raised warning from ok", "cleared ok from warning"},
+			wantLevel: domain.AlertOK,
+		},
+		{
+			name:      "level kept from the previous messages",
+			registry:  thresholds,
+			initial:   domain.AlertWarning,
+			values:    []float64{29, 45},
+			want:      []string{"raised critical from warning"},
+			wantLevel: domain.AlertCritical,
+		},
+		{
+			name:      "without hysteresis",
+			registry:  `{"thresholds":{"t":{"high":{"warning":30}}}}`,
+			values:    []float64{31, 29},
+			want:      []string{"raised warning from ok", "cleared ok from warning"},
+			wantLevel: domain.AlertOK,
+		},
+		{
+			name:      "no thresholds for the device",
+			registry:  `{"siteCode":"s1"}`,
+			values:    []float64{100},
+			wantLevel: domain.AlertOK,
+		},
+		{
+			name:     "inconsistent thresholds",
+			registry: `{"thresholds":{"t":{"high":{"warning":50,"critical":40}}}}`,
+			values:   []float64{45},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := NewMemoryAlertState()
+			if tt.initial != "" {
+				state.SetAlertLevel("d1/t", tt.initial)
+			}
+			alerts, err := NewAlerter("thresholds", state).Evaluate(readingsMessage(tt.registry, tt.values...))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Evaluate error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var got []string
+			for _, a := range alerts {
+				got = append(got, fmt.Sprintf("%s %s from %s", a.Event, a.Level, a.PreviousLevel))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("alerts = %q, want %q", got, tt.want)
+			}
+			if level, _ := state.AlertLevel("d1/t"); level != tt.wantLevel {
+				t.Errorf("stored level = %s, want %s", level, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestAlerterStateError(t *testing.T) {
+	registry := `{"thresholds":{"t":{"high":{"warning":30}}}}`
+	_, err := NewAlerter("thresholds", failingAlertState{}).Evaluate(readingsMessage(registry, 31))
+
+	var alertErr *ErrAlert
+	if !errors.As(err, &alertErr) || alertErr.DeviceID != "d1" {
+		t.Errorf("Evaluate error = %v, want an ErrAlert of d1", err)
+	}
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// IAnomalyState keeps the checkpoints of the anomaly models, keyed by <deviceId>/<metric>
+type IAnomalyState interface {
+	// AnomalyModel returns the checkpoint of a model, false when there is none
+	AnomalyModel(key string) (domain.AnomalyModel, bool, error)
+	SetAnomalyModel(key string, model domain.AnomalyModel) error
+}
+
+// AnomalyLimits overrides the z-score limit of a metric and sets its rate of change limit, per second
+type AnomalyLimits struct {
+	ZScore  *float64 `json:"zscore"`
+	MaxRate *float64 `json:"maxRate"`
+}
+
+// AnomalyOptions are the defaults of the models, Alpha is the weight of a new value in the moving mean and
+// variance and Warmup the number of values a model needs before its z-scores are used
+type AnomalyOptions struct {
+	Alpha  float64
+	ZScore float64
+	Warmup int
+}
+
+// ErrAnomaly is returned when the anomalies of a message cannot be detected
+type ErrAnomaly struct {
+	DeviceID string
+	Err      error
+}
+
+func (e *ErrAnomaly) Error() string {
+	return fmt.Sprintf("anomalies of device %s: %v", e.DeviceID, e.Err)
+}
+
+func (e *ErrAnomaly) Unwrap() error {
+	return e.Err
+}
+
+type anomalyEntry struct {
+	model domain.AnomalyModel
+	dirty bool
+}
+
+// AnomalyDetector scores every observation against an exponentially weighted model of its device metric and
+// checks its rate of change against the limits found in the registry at path, the models are kept in memory
+// and checkpointed to the state, it is only used from the use case goroutine
+type AnomalyDetector struct {
+	state  IAnomalyState
+	path   string
+	opts   AnomalyOptions
+	models map[string]*anomalyEntry
+}
+
+func NewAnomalyDetector(state IAnomalyState, path string, opts AnomalyOptions) *AnomalyDetector {
+	return &AnomalyDetector{state: state, path: path, opts: opts, models: make(map[string]*anomalyEntry)}
+}
+
+// Detect attaches the z-scores to the observations of the message and returns the anomalies, in observation
+// order per metric, skewed and out of order observations are left out
+func (d *AnomalyDetector) Detect(msg *domain.EnrichedMessage) ([]domain.Anomaly, error) {
+	payload := msg.GeoKon
+	if payload == nil {
+		return nil, nil
+	}
+
+	limits := map[string]AnomalyLimits{}
+	raw, ok := msg.RegistryValue(d.path)
+	if ok && string(raw) != "null" {
+		err := json.Unmarshal(raw, &limits)
+		if err != nil {
+			return nil, &ErrAnomaly{DeviceID: msg.DeviceID, Err: fmt.Errorf("registry %s: %w", d.path, err)}
+		}
+	}
+
+	var (
+		anomalies []domain.Anomaly
+		errs      []error
+	)
+	for j, metric := range payload.Metric {
+		entry, err := d.entry(msg.DeviceID + "/" + metric)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		limit := limits[metric]
+		zscore := d.opts.ZScore
+		if limit.ZScore != nil {
+			zscore = *limit.ZScore
+		}
+
+		for i := range payload.Observations {
+			o := &payload.Observations[i]
+			if o.Skew != "" || o.Sequence == domain.SequenceOutOfOrder {
+				continue
+			}
+			value, unit, ok := payload.Reading(*o, j)
+			model := &entry.model
+			if !ok || (model.Count > 0 && o.Time.Before(model.LastTime)) {
+				continue
+			}
+
+			anomaly := domain.Anomaly{
+				Time:     o.Time,
+				DeviceID: msg.DeviceID,
+				SiteCode: msg.SiteCode,
+				Metric:   metric,
+				Unit:     unit,
+				Value:    value,
+				Mean:     model.Mean,
+				StdDev:   math.Sqrt(model.Variance),
+			}
+			if model.Count >= d.opts.Warmup && model.Variance > 0 {
+				anomaly.Score = model.Score(value)
+				if o.AnomalyScore == nil {
+					o.AnomalyScore = make([]*float64, len(payload.Metric))
+				}
+				o.AnomalyScore[j] = &anomaly.Score
+				if math.Abs(anomaly.Score) > zscore {
+					anomaly.Kind = domain.AnomalyZScore
+					anomaly.Limit = zscore
+					anomalies = append(anomalies, anomaly)
+				}
+			}
+			if limit.MaxRate != nil && model.Count > 0 && o.Time.After(model.LastTime) {
+				rate := (value - model.Last) / o.Time.Sub(model.LastTime).Seconds()
+				if math.Abs(rate) > *limit.MaxRate {
+					anomaly.Kind = domain.AnomalyRate
+					anomaly.Rate = &rate
+					anomaly.Limit = *limit.MaxRate
+					anomalies = append(anomalies, anomaly)
+				}
+			}
+
+			model.Add(o.Time, value, d.opts.Alpha)
+			entry.dirty = true
+		}
+	}
+	if len(errs) > 0 {
+		return anomalies, &ErrAnomaly{DeviceID: msg.DeviceID, Err: errors.Join(errs...)}
+	}
+	return anomalies, nil
+}
+
+// Checkpoint saves the models updated since the previous checkpoint, the models that failed are saved on
+// the next one
+func (d *AnomalyDetector) Checkpoint() (int, error) {
+	var (
+		saved int
+		errs  []error
+	)
+
+	keys := make([]string, 0, len(d.models))
+	for key, entry := range d.models {
+		if entry.dirty {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		entry := d.models[key]
+		err := d.state.SetAnomalyModel(key, entry.model)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("model %s: %w", key, err))
+			continue
+		}
+		entry.dirty = false
+		saved++
+	}
+	return saved, errors.Join(errs...)
+}
+
+// entry returns the model of a device metric, restored from its checkpoint the first time it is used
+func (d *AnomalyDetector) entry(key string) (*anomalyEntry, error) {
+	if entry, ok := d.models[key]; ok {
+		return entry, nil
+	}
+
+	model, _, err := d.state.AnomalyModel(key)
+	if err != nil {
+		return nil, fmt.Errorf("model %s: %w", key, err)
+	}
+	entry := &anomalyEntry{model: model}
+	d.models[key] = entry
+	return entry, nil
+}
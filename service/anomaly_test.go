@@ -0,0 +1,197 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// jsonAnomalyState keeps the checkpoints as JSON, the way the Redis state stores them
+type jsonAnomalyState struct {
+	models map[string][]byte
+	err    error
+}
+
+func newJSONAnomalyState() *jsonAnomalyState {
+	return &jsonAnomalyState{models: make(map[string][]byte)}
+}
+
+func (s *jsonAnomalyState) AnomalyModel(key string) (domain.AnomalyModel, bool, error) {
+	var model domain.AnomalyModel
+	if s.err != nil {
+		return model, false, s.err
+	}
+	b, ok := s.models[key]
+	if !ok {
+		return model, false, nil
+	}
+	return model, true, json.Unmarshal(b, &model)
+}
+
+func (s *jsonAnomalyState) SetAnomalyModel(key string, model domain.AnomalyModel) error {
+	if s.err != nil {
+		return s.err
+	}
+	b, err := json.Marshal(model)
+	if err != nil {
+		return err
+	}
+	s.models[key] = b
+	return nil
+}
+
+var anomalyOptions = AnomalyOptions{Alpha: 0.5, ZScore: 3, Warmup: 3}
+
+func TestAnomalyDetect(t *testing.T) {
+	tests := []struct {
+		name       string
+		registry   string
+		checkpoint *domain.AnomalyModel
+		values     []float64
+		mark       func(p *domain.GeoKonPayload)
+		want       []string
+		wantScored int
+	}{
+		{
+			name:   "no score while warming up",
+			values: []float64{10, 12, 100},
+		},
+		{
+			name:       "z-score after the warmup",
+			values:     []float64{10, 12, 10, 12, 100},
+			want:       []string{"zscore 100"},
+			wantScored: 2,
+		},
+		{
+			name:       "z-score limit from the registry",
+			registry:   `{"anomaly":{"t":{"zscore":1}}}`,
+			values:     []float64{10, 12, 10, 12},
+			want:       []string{"zscore 12"},
+			wantScored: 1,
+		},
+		{
+			name:     "rate of change",
+			registry: `{"anomaly":{"t":{"maxRate":0.5}}}`,
+			values:   []float64{10, 30, 100},
+			want:     []string{"rate 100"},
+		},
+		{
+			name:       "restored from the checkpoint",
+			checkpoint: &domain.AnomalyModel{Mean: 10, Variance: 1, Count: 10, Last: 10, LastTime: readingsStart.Add(-time.Minute)},
+			values:     []float64{11, 20},
+			want:       []string{"zscore 20"},
+			wantScored: 2,
+		},
+		{
+			name:       "older than the checkpoint",
+			checkpoint: &domain.AnomalyModel{Mean: 10, Variance: 1, Count: 10, Last: 10, LastTime: readingsStart.Add(time.Hour)},
+			values:     []float64{100},
+		},
+		{
+			name:       "skewed and out of order observations left out",
+			checkpoint: &domain.AnomalyModel{Mean: 10, Variance: 1, Count: 10, Last: 10, LastTime: readingsStart.Add(-time.Minute)},
+			values:     []float64{100, 200, 10},
+			mark: func(p *domain.GeoKonPayload) {
+				p.Observations[0].Skew = "future"
+				p.Observations[1].Sequence = domain.SequenceOutOfOrder
+			},
+			wantScored: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := newJSONAnomalyState()
+			if tt.checkpoint != nil {
+				state.SetAnomalyModel("d1/t", *tt.checkpoint)
+			}
+			registry := tt.registry
+			if registry == "" {
+				registry = `{}`
+			}
+			msg := readingsMessage(registry, tt.values...)
+			if tt.mark != nil {
+				tt.mark(msg.GeoKon)
+			}
+
+			anomalies, err := NewAnomalyDetector(state, "anomaly", anomalyOptions).Detect(&msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, a := range anomalies {
+				got = append(got, a.Kind+" "+formatValue(a.Value))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("anomalies = %q, want %q", got, tt.want)
+			}
+
+			scored := 0
+			for _, o := range msg.GeoKon.Observations {
+				if len(o.AnomalyScore) > 0 && o.AnomalyScore[0] != nil {
+					scored++
+				}
+			}
+			if scored != tt.wantScored {
+				t.Errorf("scored observations = %d, want %d", scored, tt.wantScored)
+			}
+		})
+	}
+}
+
+func formatValue(v float64) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestAnomalyCheckpoint(t *testing.T) {
+	state := newJSONAnomalyState()
+	detector := NewAnomalyDetector(state, "anomaly", anomalyOptions)
+	msg := readingsMessage(`{}`, 10, 12, 10)
+	if _, err := detector.Detect(&msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed checkpoint keeps the model dirty for the next one
+	state.err = errors.New("state unavailable")
+	if saved, err := detector.Checkpoint(); saved != 0 || err == nil {
+		t.Fatalf("Checkpoint = %d, %v, want 0 and an error", saved, err)
+	}
+	state.err = nil
+	if saved, err := detector.Checkpoint(); saved != 1 || err != nil {
+		t.Fatalf("Checkpoint = %d, %v, want 1", saved, err)
+	}
+	if saved, err := detector.Checkpoint(); saved != 0 || err != nil {
+		t.Fatalf("Checkpoint without updates = %d, %v, want 0", saved, err)
+	}
+
+	// A new detector, e.g. after a restart, continues from the checkpoint
+	restored := NewAnomalyDetector(state, "anomaly", anomalyOptions)
+	next := readingsMessage(`{}`, 12)
+	next.GeoKon.Observations[0].Time = msg.GeoKon.Observations[2].Time.Add(time.Minute)
+	if _, err := restored.Detect(&next); err != nil {
+		t.Fatal(err)
+	}
+	if score := next.GeoKon.Observations[0].AnomalyScore; len(score) == 0 || score[0] == nil {
+		t.Error("restored model did not score the observation")
+	}
+	model, ok, _ := state.AnomalyModel("d1/t")
+	if !ok || model.Count != 3 || model.Mean != 10.5 || model.Variance != 0.75 {
+		t.Errorf("checkpoint = %+v, want 3 values with mean 10.5 and variance 0.75", model)
+	}
+}
+
+func TestAnomalyStateError(t *testing.T) {
+	state := newJSONAnomalyState()
+	state.err = errors.New("state unavailable")
+	msg := readingsMessage(`{}`, 10)
+
+	_, err := NewAnomalyDetector(state, "anomaly", anomalyOptions).Detect(&msg)
+	var anomalyErr *ErrAnomaly
+	if !errors.As(err, &anomalyErr) {
+		t.Errorf("Detect error = %v, want an ErrAnomaly", err)
+	}
+}
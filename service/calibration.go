@@ -0,0 +1,146 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// CalibrationSheet is the calibration of a device as stored in the registry
+type CalibrationSheet struct {
+	Version string                       `json:"version"`
+	Metrics map[string]MetricCalibration `json:"metrics"`
+}
+
+// MetricCalibration converts the raw value of a metric to engineering units, either linearly with gain and
+// offset or with polynomial coefficients in increasing order, optionally compensated for temperature
+type MetricCalibration struct {
+	Gain        *float64                 `json:"gain"`
+	Offset      float64                  `json:"offset"`
+	Polynomial  []float64                `json:"polynomial"`
+	Temperature *TemperatureCompensation `json:"temperature"`
+	Unit        string                   `json:"unit"`
+}
+
+// TemperatureCompensation adds factor * (T - reference) where T is the value of metric in the same observation
+type TemperatureCompensation struct {
+	Metric    string  `json:"metric"`
+	Reference float64 `json:"reference"`
+	Factor    float64 `json:"factor"`
+}
+
+// Calibration is the transform computing the engineering values of the observations from the calibration
+// found in the registry at path, devices without calibration are left unchanged
+type Calibration struct {
+	path string
+}
+
+func NewCalibration(path string) *Calibration {
+	return &Calibration{path: path}
+}
+
+func (c *Calibration) Name() string {
+	return "calibration"
+}
+
+func (c *Calibration) Apply(msg *domain.EnrichedMessage) error {
+	raw, ok := msg.RegistryValue(c.path)
+	if !ok || msg.GeoKon == nil || string(raw) == "null" {
+		return nil
+	}
+
+	var sheet CalibrationSheet
+	err := json.Unmarshal(raw, &sheet)
+	if err != nil {
+		return fmt.Errorf("registry %s: %w", c.path, err)
+	}
+	err = sheet.check()
+	if err != nil {
+		return fmt.Errorf("registry %s: %w", c.path, err)
+	}
+
+	payload := msg.GeoKon
+	units := make([]string, len(payload.Metric))
+	calibrated := false
+	for j, metric := range payload.Metric {
+		if cal, ok := sheet.Metrics[metric]; ok {
+			units[j] = cal.Unit
+			if units[j] == "" {
+				units[j] = payload.UnitOf(metric)
+			}
+			calibrated = true
+		}
+	}
+	if !calibrated {
+		return nil
+	}
+
+	for i := range payload.Observations {
+		o := &payload.Observations[i]
+		o.Engineering = make([]*float64, len(o.Value))
+		for j, metric := range payload.Metric {
+			cal, ok := sheet.Metrics[metric]
+			if !ok || j >= len(o.Value) {
+				continue
+			}
+			value, err := cal.apply(payload, *o, o.Value[j])
+			if err != nil {
+				return fmt.Errorf("/observations/%d %s: %w", i, metric, err)
+			}
+			o.Engineering[j] = &value
+		}
+	}
+	payload.EngineeringUnit = units
+	payload.CalibrationVersion = sheet.Version
+	return nil
+}
+
+func (s *CalibrationSheet) check() error {
+	var errs []error
+
+	metrics := make([]string, 0, len(s.Metrics))
+	for metric := range s.Metrics {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	for _, metric := range metrics {
+		cal := s.Metrics[metric]
+		if len(cal.Polynomial) > 0 && (cal.Gain != nil || cal.Offset != 0) {
+			errs = append(errs, fmt.Errorf("%s: gain/offset and polynomial are exclusive", metric))
+		}
+		if cal.Temperature != nil && cal.Temperature.Metric == "" {
+			errs = append(errs, fmt.Errorf("%s: temperature compensation without metric", metric))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c MetricCalibration) apply(payload *domain.GeoKonPayload, o domain.Observation, raw float64) (float64, error) {
+	var value float64
+
+	if len(c.Polynomial) > 0 {
+		for k, coefficient := range c.Polynomial {
+			value += coefficient * math.Pow(raw, float64(k))
+		}
+	} else {
+		gain := 1.0
+		if c.Gain != nil {
+			gain = *c.Gain
+		}
+		value = gain*raw + c.Offset
+	}
+
+	if c.Temperature != nil {
+		k, ok := payload.Index(c.Temperature.Metric)
+		if !ok || k >= len(o.Value) {
+			return 0, fmt.Errorf("no %s value for the temperature compensation", c.Temperature.Metric)
+		}
+		value += c.Temperature.Factor * (o.Value[k] - c.Temperature.Reference)
+	}
+	return value, nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestMetricCalibrationApply(t *testing.T) {
+	payload := &domain.GeoKonPayload{Metric: []string{"strain", "temp"}, Unit: []string{"digits", "C"}}
+	observation := domain.Observation{Value: []float64{100, 30}}
+
+	tests := []struct {
+		name        string
+		calibration MetricCalibration
+		want        float64
+		wantErr     string
+	}{
+		{name: "identity", want: 100},
+		{name: "gain and offset", calibration: MetricCalibration{Gain: float(0.5), Offset: -10}, want: 40},
+		{name: "offset only", calibration: MetricCalibration{Offset: 5}, want: 105},
+		{name: "zero gain", calibration: MetricCalibration{Gain: float(0), Offset: 1}, want: 1},
+		{name: "polynomial", calibration: MetricCalibration{Polynomial: []float64{1, 2, 0.01}}, want: 301},
+		{
+			name:        "temperature compensation",
+			calibration: MetricCalibration{Gain: float(2), Temperature: &TemperatureCompensation{Metric: "temp", Reference: 20, Factor: 0.5}},
+			want:        205,
+		},
+		{
+			name:        "temperature metric missing",
+			calibration: MetricCalibration{Temperature: &TemperatureCompensation{Metric: "humidity", Factor: 1}},
+			wantErr:     "no humidity value",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.calibration.apply(payload, observation, observation.Value[0])
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("apply error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("apply = %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalibrationSheetCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics map[string]MetricCalibration
+		wantErr []string
+	}{
+		{name: "valid", metrics: map[string]MetricCalibration{"a": {Gain: float(2)}, "b": {Polynomial: []float64{0, 1}}}},
+		{name: "polynomial with gain", metrics: map[string]MetricCalibration{"a": {Gain: float(2), Polynomial: []float64{0, 1}}}, wantErr: []string{"a: gain/offset and polynomial are exclusive"}},
+		{name: "polynomial with offset", metrics: map[string]MetricCalibration{"a": {Offset: 1, Polynomial: []float64{0, 1}}}, wantErr: []string{"a: gain/offset and polynomial are exclusive"}},
+		{
+			name: "every error",
+			metrics: map[string]MetricCalibration{
+				"b": {Temperature: &TemperatureCompensation{Factor: 1}},
+				"a": {Offset: 1, Polynomial: []float64{0, 1}},
+			},
+			wantErr: []string{"a: gain/offset", "b: temperature compensation without metric"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&CalibrationSheet{Metrics: tt.metrics}).check()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("check error = %v, want none", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("check error = nil, want %q", tt.wantErr)
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(tt.wantErr) {
+				t.Fatalf("check error = %v, want %q", err, tt.wantErr)
+			}
+			for i, want := range tt.wantErr {
+				if !strings.HasPrefix(lines[i], want) {
+					t.Errorf("error %d = %q, want %q", i, lines[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCalibrationApply(t *testing.T) {
+	const registry = `{"calibration":{"version":"2024-05","metrics":{
+		"strain":{"gain":2,"temperature":{"metric":"temp","reference":20,"factor":0.5},"unit":"ue"},
+		"temp":{"offset":1}
+	}}}`
+	msg := domain.EnrichedMessage{
+		DeviceID:    "d1",
+		RegistryRaw: []byte(registry),
+		GeoKon: &domain.GeoKonPayload{
+			Metric:       []string{"strain", "temp", "battery"},
+			Unit:         []string{"digits", "C", "V"},
+			Observations: []domain.Observation{{Value: []float64{100, 30, 3.6}}},
+		},
+	}
+	if err := NewCalibration("calibration").Apply(&msg); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := msg.GeoKon
+	if payload.CalibrationVersion != "2024-05" {
+		t.Errorf("calibration version = %q, want 2024-05", payload.CalibrationVersion)
+	}
+	if got, want := strings.Join(payload.EngineeringUnit, ","), "ue,C,"; got != want {
+		t.Errorf("engineering units = %s, want %s", got, want)
+	}
+	// The compensation uses the raw temperature, not the calibrated one
+	engineering := payload.Observations[0].Engineering
+	if engineering[0] == nil || *engineering[0] != 205 {
+		t.Errorf("strain = %v, want 205", engineering[0])
+	}
+	if engineering[1] == nil || *engineering[1] != 31 {
+		t.Errorf("temp = %v, want 31", engineering[1])
+	}
+	if engineering[2] != nil {
+		t.Errorf("battery = %g, want no engineering value", *engineering[2])
+	}
+}
+
+func TestCalibrationApplyErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		registry string
+		want     string
+	}{
+		{name: "invalid sheet", registry: `{"calibration":{"metrics":[]}}`, want: "registry calibration"},
+		{name: "exclusive coefficients", registry: `{"calibration":{"metrics":{"strain":{"gain":2,"polynomial":[0,1]}}}}`, want: "exclusive"},
+		{name: "compensation metric missing", registry: `{"calibration":{"metrics":{"strain":{"temperature":{"metric":"temp"}}}}}`, want: "/observations/0 strain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := domain.EnrichedMessage{
+				RegistryRaw: []byte(tt.registry),
+				GeoKon: &domain.GeoKonPayload{
+					Metric:       []string{"strain"},
+					Unit:         []string{"digits"},
+					Observations: []domain.Observation{{Value: []float64{100}}},
+				},
+			}
+			err := NewCalibration("calibration").Apply(&msg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Apply error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// ErrClockSkew is returned for a message with observation timestamps out of bounds when skewed readings
+// are rejected
+type ErrClockSkew struct {
+	DeviceID string
+	Err      error
+}
+
+func (e *ErrClockSkew) Error() string {
+	return fmt.Sprintf("clock skew on device %s: %v", e.DeviceID, e.Err)
+}
+
+func (e *ErrClockSkew) Unwrap() error {
+	return e.Err
+}
+
+// ClockSkew checks the observation timestamps against the ingest time, a reading more than maxFuture ahead or
+// maxPast behind is flagged or rejects the message, maxPast 0 accepts any past reading
+type ClockSkew struct {
+	maxFuture time.Duration
+	maxPast   time.Duration
+	reject    bool
+
+	mu      sync.Mutex
+	devices map[string]*domain.SkewedDevice
+}
+
+func NewClockSkew(maxFuture, maxPast time.Duration, reject bool) *ClockSkew {
+	return &ClockSkew{
+		maxFuture: maxFuture,
+		maxPast:   maxPast,
+		reject:    reject,
+		devices:   make(map[string]*domain.SkewedDevice),
+	}
+}
+
+// Check flags the skewed observations of the message and counts its device, it returns an error instead
+// when skewed readings are rejected
+func (c *ClockSkew) Check(msg *domain.EnrichedMessage) error {
+	if msg.GeoKon == nil {
+		return nil
+	}
+
+	var (
+		errs    []error
+		skewed  int
+		maxSkew time.Duration
+	)
+	for i := range msg.GeoKon.Observations {
+		o := &msg.GeoKon.Observations[i]
+		skew := o.Time.Sub(msg.IngestTime)
+		switch {
+		case skew > c.maxFuture:
+			o.Skew = domain.SkewFuture
+			errs = append(errs, fmt.Errorf("/observations/%d/time: %s is %s ahead of the ingest time", i, o.Time.Format(domain.TimestampLayout), skew))
+		case c.maxPast > 0 && -skew > c.maxPast:
+			o.Skew = domain.SkewPast
+			errs = append(errs, fmt.Errorf("/observations/%d/time: %s is %s behind the ingest time", i, o.Time.Format(domain.TimestampLayout), -skew))
+		default:
+			continue
+		}
+		skewed++
+		if skew.Abs() > maxSkew.Abs() {
+			maxSkew = skew
+		}
+	}
+	if skewed == 0 {
+		return nil
+	}
+
+	c.count(msg, skewed, maxSkew)
+	if c.reject {
+		return &ErrClockSkew{DeviceID: msg.DeviceID, Err: errors.Join(errs...)}
+	}
+	return nil
+}
+
+// SkewedDevices returns the devices that sent skewed readings since startup, the most skewed readings first
+func (c *ClockSkew) SkewedDevices() []domain.SkewedDevice {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	devices := make([]domain.SkewedDevice, 0, len(c.devices))
+	for _, device := range c.devices {
+		devices = append(devices, *device)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Readings != devices[j].Readings {
+			return devices[i].Readings > devices[j].Readings
+		}
+		return devices[i].DeviceID < devices[j].DeviceID
+	})
+	return devices
+}
+
+func (c *ClockSkew) count(msg *domain.EnrichedMessage, readings int, skew time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	device := c.devices[msg.DeviceID]
+	if device == nil {
+		device = &domain.SkewedDevice{DeviceID: msg.DeviceID}
+		c.devices[msg.DeviceID] = device
+	}
+	device.SiteCode = msg.SiteCode
+	device.Readings += readings
+	device.LastSkewMs = skew.Milliseconds()
+	device.LastSeen = msg.IngestTime
+}
+
+// WithClockSkew checks the observation timestamps of the messages against their ingest time
+func (s *Service) WithClockSkew(check *ClockSkew) *Service {
+	s.clockSkew = check
+	return s
+}
+
+// SkewedDevices returns the devices that sent skewed readings, nil when the check is disabled
+func (s *Service) SkewedDevices() []domain.SkewedDevice {
+	if s.clockSkew == nil {
+		return nil
+	}
+	return s.clockSkew.SkewedDevices()
+}
+
+func (s *Service) checkClockSkew(msg *domain.EnrichedMessage) error {
+	if s.clockSkew == nil {
+		return nil
+	}
+	return s.clockSkew.Check(msg)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// ISeenSet remembers keys for a time window
+type ISeenSet interface {
+	// MarkSeen records the key and reports whether it was not already seen within the window
+	MarkSeen(key string, window time.Duration) (bool, error)
+	// Forget removes a key so the next MarkSeen of it succeeds
+	Forget(key string) error
+}
+
+// IDedupMetrics counts the messages processed without deduplication because the seen set was unavailable
+type IDedupMetrics interface {
+	RecordDedupFailOpen()
+}
+
+// ErrDuplicate is returned for a message whose event was already processed within the deduplication window
+type ErrDuplicate struct {
+	DeviceID  string
+	EventUUID string
+}
+
+func (e *ErrDuplicate) Error() string {
+	return fmt.Sprintf("duplicate event %s from device %s", e.EventUUID, e.DeviceID)
+}
+
+// WithDeduplication drops the messages whose (device_id, eventUuid) was already seen within window, the
+// messages processed while the seen set is unavailable are counted in metrics
+func (s *Service) WithDeduplication(seen ISeenSet, window time.Duration, metrics IDedupMetrics) *Service {
+	s.seen = seen
+	s.dedupWindow = window
+	s.dedupMetrics = metrics
+	return s
+}
+
+// ForgetEvent releases the deduplication mark of a message that was not published, so its redelivery is
+// processed instead of dropped as a duplicate
+func (s *Service) ForgetEvent(msg domain.EnrichedMessage) {
+	if s.seen == nil || msg.GeoKon == nil || msg.GeoKon.EventUUID == "" {
+		return
+	}
+
+	err := s.seen.Forget(dedupKey(msg))
+	if err != nil {
+		s.logger.Warn().Msgf("Failed to release event %s from device %s, its redelivery will be dropped: %v", msg.GeoKon.EventUUID, msg.DeviceID, err)
+	}
+}
+
+// deduplicate fails open, a message is processed when the seen set is unavailable
+func (s *Service) deduplicate(msg *domain.EnrichedMessage) error {
+	if s.seen == nil || msg.GeoKon == nil || msg.GeoKon.EventUUID == "" {
+		return nil
+	}
+
+	first, err := s.seen.MarkSeen(dedupKey(*msg), s.dedupWindow)
+	if err != nil {
+		s.logger.Warn().Msgf("Deduplication unavailable, processing event %s from device %s: %v", msg.GeoKon.EventUUID, msg.DeviceID, err)
+		if s.dedupMetrics != nil {
+			s.dedupMetrics.RecordDedupFailOpen()
+		}
+		return nil
+	}
+	if !first {
+		return &ErrDuplicate{DeviceID: msg.DeviceID, EventUUID: msg.GeoKon.EventUUID}
+	}
+	return nil
+}
+
+func dedupKey(msg domain.EnrichedMessage) string {
+	return msg.DeviceID + "/" + msg.GeoKon.EventUUID
+}
+
+// MemorySeenSet is an in-memory seen set holding at most capacity keys, the oldest are evicted first
+type MemorySeenSet struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	keys     map[string]*list.Element
+}
+
+type seenKey struct {
+	key     string
+	expires time.Time
+}
+
+func NewMemorySeenSet(capacity int) *MemorySeenSet {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &MemorySeenSet{
+		capacity: capacity,
+		order:    list.New(),
+		keys:     make(map[string]*list.Element),
+	}
+}
+
+func (m *MemorySeenSet) MarkSeen(key string, window time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.expire(now)
+
+	if _, ok := m.keys[key]; ok {
+		return false, nil
+	}
+	if m.order.Len() >= m.capacity {
+		oldest := m.order.Front()
+		delete(m.keys, oldest.Value.(seenKey).key)
+		m.order.Remove(oldest)
+	}
+	m.keys[key] = m.order.PushBack(seenKey{key: key, expires: now.Add(window)})
+	return true, nil
+}
+
+func (m *MemorySeenSet) Forget(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.keys[key]; ok {
+		delete(m.keys, key)
+		m.order.Remove(e)
+	}
+	return nil
+}
+
+// expire drops the expired keys, they are ordered by expiry since the window does not change
+func (m *MemorySeenSet) expire(now time.Time) {
+	for e := m.order.Front(); e != nil; e = m.order.Front() {
+		if now.Before(e.Value.(seenKey).expires) {
+			return
+		}
+		delete(m.keys, e.Value.(seenKey).key)
+		m.order.Remove(e)
+	}
+}
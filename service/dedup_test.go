@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemorySeenSet(t *testing.T) {
+	type step struct {
+		key    string
+		forget bool
+		sleep  time.Duration
+		want   bool
+	}
+	tests := []struct {
+		name     string
+		capacity int
+		window   time.Duration
+		steps    []step
+	}{
+		{
+			name:     "duplicate within the window",
+			capacity: 10,
+			window:   time.Hour,
+			steps:    []step{{key: "a", want: true}, {key: "b", want: true}, {key: "a", want: false}},
+		},
+		{
+			name:     "expired",
+			capacity: 10,
+			window:   time.Millisecond,
+			steps:    []step{{key: "a", want: true}, {key: "a", sleep: 5 * time.Millisecond, want: true}},
+		},
+		{
+			name:     "oldest evicted over capacity",
+			capacity: 2,
+			window:   time.Hour,
+			steps:    []step{{key: "a", want: true}, {key: "b", want: true}, {key: "c", want: true}, {key: "a", want: true}, {key: "c", want: false}},
+		},
+		{
+			name:     "forgotten",
+			capacity: 10,
+			window:   time.Hour,
+			steps:    []step{{key: "a", want: true}, {key: "a", forget: true}, {key: "a", want: true}, {key: "a", want: false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := NewMemorySeenSet(tt.capacity)
+			for i, s := range tt.steps {
+				time.Sleep(s.sleep)
+				if s.forget {
+					if err := seen.Forget(s.key); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				got, err := seen.MarkSeen(s.key, tt.window)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != s.want {
+					t.Errorf("step %d: MarkSeen(%s) = %t, want %t", i, s.key, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+type failingSeenSet struct{}
+
+func (failingSeenSet) MarkSeen(string, time.Duration) (bool, error) {
+	return false, errors.New("redis timeout")
+}
+
+func (failingSeenSet) Forget(string) error {
+	return errors.New("redis timeout")
+}
+
+type countingDedupMetrics struct {
+	failOpen int
+}
+
+func (m *countingDedupMetrics) RecordDedupFailOpen() {
+	m.failOpen++
+}
+
+func TestDeduplicate(t *testing.T) {
+	tests := []struct {
+		name string
+		// messages are processed in order, want is whether each one is a duplicate
+		messages [][]byte
+		want     []bool
+		failOpen int
+		seen     func() ISeenSet
+		skew     *ClockSkew
+	}{
+		{
+			name:     "duplicate dropped",
+			messages: [][]byte{geoKonMessage("e1", "2024-05-01T10:00:00Z"), geoKonMessage("e1", "2024-05-01T10:00:00Z"), geoKonMessage("e2", "2024-05-01T10:00:00Z")},
+			want:     []bool{false, true, false},
+			seen:     func() ISeenSet { return NewMemorySeenSet(10) },
+		},
+		{
+			name:     "no event uuid",
+			messages: [][]byte{geoKonMessage("", "2024-05-01T10:00:00Z"), geoKonMessage("", "2024-05-01T10:00:00Z")},
+			want:     []bool{false, false},
+			seen:     func() ISeenSet { return NewMemorySeenSet(10) },
+		},
+		{
+			name:     "fail open counted",
+			messages: [][]byte{geoKonMessage("e1", "2024-05-01T10:00:00Z"), geoKonMessage("e1", "2024-05-01T10:00:00Z")},
+			want:     []bool{false, false},
+			failOpen: 2,
+			seen:     func() ISeenSet { return failingSeenSet{} },
+		},
+		{
+			name:     "rejected event released",
+			messages: [][]byte{geoKonMessage("e1", "2999-01-01T00:00:00Z"), geoKonMessage("e1", "2999-01-01T00:00:00Z")},
+			want:     []bool{false, false},
+			seen:     func() ISeenSet { return NewMemorySeenSet(10) },
+			skew:     NewClockSkew(time.Minute, 0, true),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := &countingDedupMetrics{}
+			s := newTestService().WithDeduplication(tt.seen(), time.Hour, metrics)
+			if tt.skew != nil {
+				s.WithClockSkew(tt.skew)
+			}
+
+			for i, msg := range tt.messages {
+				_, err := s.ProcessMessage(msg)
+				var duplicate *ErrDuplicate
+				if got := errors.As(err, &duplicate); got != tt.want[i] {
+					t.Errorf("message %d: duplicate = %t (%v), want %t", i, got, err, tt.want[i])
+				}
+			}
+			if metrics.failOpen != tt.failOpen {
+				t.Errorf("%d fail open recorded, want %d", metrics.failOpen, tt.failOpen)
+			}
+		})
+	}
+}
+
+func TestForgetEvent(t *testing.T) {
+	s := newTestService().WithDeduplication(NewMemorySeenSet(10), time.Hour, nil)
+
+	msg, err := s.ProcessMessage(geoKonMessage("e1", "2024-05-01T10:00:00Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ForgetEvent(msg)
+	if _, err := s.ProcessMessage(geoKonMessage("e1", "2024-05-01T10:00:00Z")); err != nil {
+		t.Errorf("redelivery of a released event: %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// readingsStart is the time of the first observation of readingsMessage
+var readingsStart = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+// readingsMessage is a message of device d1 of site s1 with one observation of metric t in C per value, a minute
+// apart from readingsStart
+func readingsMessage(registry string, values ...float64) domain.EnrichedMessage {
+	payload := &domain.GeoKonPayload{SerialID: "d1", Metric: []string{"t"}, Unit: []string{"C"}}
+	for i, v := range values {
+		payload.Observations = append(payload.Observations, domain.Observation{
+			Time:  readingsStart.Add(time.Duration(i) * time.Minute),
+			Value: []float64{v},
+		})
+	}
+	return domain.EnrichedMessage{DeviceID: "d1", SiteCode: "s1", RegistryRaw: []byte(registry), GeoKon: payload}
+}
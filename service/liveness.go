@@ -0,0 +1,148 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// ILivenessStore keeps the last report of every device per site and the deadline after which the device is
+// stale, it is shared between replicas
+type ILivenessStore interface {
+	// RecordReport records a report, it returns whether the device was stale and when it was last seen before
+	RecordReport(siteCode, deviceID string, at, deadline time.Time) (stale bool, lastSeen time.Time, err error)
+	LivenessSites() ([]string, error)
+	// OverdueDevices returns the devices of the site whose deadline passed and that are not stale yet
+	OverdueDevices(siteCode string, now time.Time) ([]domain.SilentDevice, error)
+	// MarkStale moves an overdue device to the stale devices, it returns false when it is no longer overdue,
+	// e.g. another replica marked it first or the device reported since device.LastSeen
+	MarkStale(siteCode string, device domain.SilentDevice) (bool, error)
+	StaleDevices(siteCode string) ([]domain.SilentDevice, error)
+}
+
+// Liveness tracks when the devices report against the interval found in their registry entry at path, a
+// device is stale after missing missed reports
+type Liveness struct {
+	store           ILivenessStore
+	path            string
+	defaultInterval time.Duration
+	missed          int
+}
+
+// NewLiveness creates a tracker, devices without an interval in the registry use defaultInterval and are not
+// tracked when it is zero
+func NewLiveness(store ILivenessStore, path string, defaultInterval time.Duration, missed int) *Liveness {
+	if missed <= 0 {
+		missed = 1
+	}
+	return &Liveness{store: store, path: path, defaultInterval: defaultInterval, missed: missed}
+}
+
+// Seen records a report of the device and returns a recovered event when the device was stale
+func (l *Liveness) Seen(msg domain.EnrichedMessage, now time.Time) (*domain.DeviceStatus, error) {
+	interval, err := reportingInterval(msg, l.path, l.defaultInterval)
+	if err != nil || interval <= 0 {
+		return nil, err
+	}
+
+	deadline := now.Add(interval * time.Duration(l.missed))
+	stale, lastSeen, err := l.store.RecordReport(msg.SiteCode, msg.DeviceID, now, deadline)
+	if err != nil || !stale {
+		return nil, err
+	}
+	return &domain.DeviceStatus{
+		Event:    domain.DeviceRecovered,
+		Time:     now,
+		DeviceID: msg.DeviceID,
+		SiteCode: msg.SiteCode,
+		LastSeen: lastSeen,
+	}, nil
+}
+
+// Check marks the overdue devices of every site stale and returns their stale events
+func (l *Liveness) Check(now time.Time) ([]domain.DeviceStatus, error) {
+	var (
+		events []domain.DeviceStatus
+		errs   []error
+	)
+
+	sites, err := l.store.LivenessSites()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(sites)
+	for _, site := range sites {
+		overdue, err := l.store.OverdueDevices(site, now)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, device := range overdue {
+			marked, err := l.store.MarkStale(site, device)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if !marked {
+				continue
+			}
+			events = append(events, domain.DeviceStatus{
+				Event:    domain.DeviceStale,
+				Time:     now,
+				DeviceID: device.DeviceID,
+				SiteCode: site,
+				LastSeen: device.LastSeen,
+			})
+		}
+	}
+	return events, errors.Join(errs...)
+}
+
+// Silent returns the stale and overdue devices of a site, silent the longest first
+func (l *Liveness) Silent(siteCode string, now time.Time) ([]domain.SilentDevice, error) {
+	stale, err := l.store.StaleDevices(siteCode)
+	if err != nil {
+		return nil, err
+	}
+	overdue, err := l.store.OverdueDevices(siteCode, now)
+	if err != nil {
+		return nil, err
+	}
+
+	silent := append(stale, overdue...)
+	sort.SliceStable(silent, func(i, j int) bool {
+		return silent[i].LastSeen.Before(silent[j].LastSeen)
+	})
+	return silent, nil
+}
+
+// reportingInterval reads the reporting interval of the device at path, a duration string such as "15m" or a
+// number of seconds, defaultInterval when the registry has none
+func reportingInterval(msg domain.EnrichedMessage, path string, defaultInterval time.Duration) (time.Duration, error) {
+	raw, ok := msg.RegistryValue(path)
+	if !ok || string(raw) == "null" {
+		return defaultInterval, nil
+	}
+
+	var value any
+	err := json.Unmarshal(raw, &value)
+	if err != nil {
+		return 0, fmt.Errorf("registry %s of device %s: %w", path, msg.DeviceID, err)
+	}
+	switch v := value.(type) {
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("registry %s of device %s: %w", path, msg.DeviceID, err)
+		}
+		return d, nil
+	default:
+		return 0, fmt.Errorf("registry %s of device %s: expected a duration or a number of seconds", path, msg.DeviceID)
+	}
+}
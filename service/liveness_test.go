@@ -0,0 +1,197 @@
+package service
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+type livenessEntry struct {
+	lastSeen time.Time
+	deadline time.Time
+	stale    bool
+}
+
+// memoryLivenessStore keeps the reports in the test, keyed by site then device
+type memoryLivenessStore map[string]map[string]*livenessEntry
+
+func (s memoryLivenessStore) RecordReport(siteCode, deviceID string, at, deadline time.Time) (bool, time.Time, error) {
+	if s[siteCode] == nil {
+		s[siteCode] = make(map[string]*livenessEntry)
+	}
+	previous := s[siteCode][deviceID]
+	s[siteCode][deviceID] = &livenessEntry{lastSeen: at, deadline: deadline}
+	if previous == nil {
+		return false, time.Time{}, nil
+	}
+	return previous.stale, previous.lastSeen, nil
+}
+
+func (s memoryLivenessStore) LivenessSites() ([]string, error) {
+	var sites []string
+	for site := range s {
+		sites = append(sites, site)
+	}
+	return sites, nil
+}
+
+func (s memoryLivenessStore) devices(siteCode string, keep func(e *livenessEntry) bool) []domain.SilentDevice {
+	var devices []domain.SilentDevice
+	for id, e := range s[siteCode] {
+		if keep(e) {
+			devices = append(devices, domain.SilentDevice{DeviceID: id, LastSeen: e.lastSeen})
+		}
+	}
+	slices.SortFunc(devices, func(a, b domain.SilentDevice) int { return a.LastSeen.Compare(b.LastSeen) })
+	return devices
+}
+
+func (s memoryLivenessStore) OverdueDevices(siteCode string, now time.Time) ([]domain.SilentDevice, error) {
+	return s.devices(siteCode, func(e *livenessEntry) bool { return !e.stale && e.deadline.Before(now) }), nil
+}
+
+func (s memoryLivenessStore) MarkStale(siteCode string, device domain.SilentDevice) (bool, error) {
+	e := s[siteCode][device.DeviceID]
+	if e == nil || e.stale || !e.lastSeen.Equal(device.LastSeen) {
+		return false, nil
+	}
+	e.stale = true
+	return true, nil
+}
+
+func (s memoryLivenessStore) StaleDevices(siteCode string) ([]domain.SilentDevice, error) {
+	return s.devices(siteCode, func(e *livenessEntry) bool { return e.stale }), nil
+}
+
+var livenessRegistry = map[string]string{
+	"d1": `{"interval":60}`,
+	"d2": `{"interval":"2m"}`,
+	"d3": `{}`,
+	"d4": `{"interval":"often"}`,
+}
+
+func TestLiveness(t *testing.T) {
+	type step struct {
+		seen    string
+		check   bool
+		at      time.Duration
+		want    []string
+		wantErr bool
+	}
+	tests := []struct {
+		name            string
+		defaultInterval time.Duration
+		steps           []step
+	}{
+		{
+			name: "stale after the missed reports then recovered",
+			steps: []step{
+				{seen: "d1"},
+				{check: true, at: 119 * time.Second},
+				{check: true, at: 121 * time.Second, want: []string{"stale d1"}},
+				{check: true, at: 200 * time.Second},
+				{seen: "d1", at: 300 * time.Second, want: []string{"recovered d1"}},
+				{check: true, at: 310 * time.Second},
+			},
+		},
+		{
+			name: "duration string interval",
+			steps: []step{
+				{seen: "d2"},
+				{check: true, at: 3 * time.Minute},
+				{check: true, at: 5 * time.Minute, want: []string{"stale d2"}},
+			},
+		},
+		{
+			name: "reports keep the device alive",
+			steps: []step{
+				{seen: "d1"},
+				{seen: "d1", at: 100 * time.Second},
+				{check: true, at: 200 * time.Second},
+				{check: true, at: 221 * time.Second, want: []string{"stale d1"}},
+			},
+		},
+		{
+			name: "untracked without an interval",
+			steps: []step{
+				{seen: "d3"},
+				{check: true, at: time.Hour},
+			},
+		},
+		{
+			name:            "default interval",
+			defaultInterval: 30 * time.Second,
+			steps: []step{
+				{seen: "d3"},
+				{seen: "d1"},
+				{check: true, at: 61 * time.Second, want: []string{"stale d3"}},
+				{check: true, at: 121 * time.Second, want: []string{"stale d1"}},
+			},
+		},
+		{
+			name:  "invalid interval",
+			steps: []step{{seen: "d4", wantErr: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			liveness := NewLiveness(memoryLivenessStore{}, "interval", tt.defaultInterval, 2)
+			for i, s := range tt.steps {
+				var (
+					events []domain.DeviceStatus
+					err    error
+				)
+				now := readingsStart.Add(s.at)
+				if s.check {
+					events, err = liveness.Check(now)
+				} else {
+					msg := domain.EnrichedMessage{DeviceID: s.seen, SiteCode: "s1", RegistryRaw: []byte(livenessRegistry[s.seen])}
+					var event *domain.DeviceStatus
+					event, err = liveness.Seen(msg, now)
+					if event != nil {
+						events = append(events, *event)
+					}
+				}
+				if (err != nil) != s.wantErr {
+					t.Fatalf("step %d: error = %v, want error %t", i, err, s.wantErr)
+				}
+
+				var got []string
+				for _, e := range events {
+					got = append(got, e.Event+" "+e.DeviceID)
+				}
+				if !slices.Equal(got, s.want) {
+					t.Errorf("step %d: events = %q, want %q", i, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLivenessSilent(t *testing.T) {
+	liveness := NewLiveness(memoryLivenessStore{}, "interval", 0, 1)
+	for i, device := range []string{"d2", "d1"} {
+		msg := domain.EnrichedMessage{DeviceID: device, SiteCode: "s1", RegistryRaw: []byte(livenessRegistry[device])}
+		if _, err := liveness.Seen(msg, readingsStart.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// d1 is stale after a minute, d2 is overdue but not checked yet
+	if _, err := liveness.Check(readingsStart.Add(90 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	silent, err := liveness.Silent("s1", readingsStart.Add(3*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range silent {
+		got = append(got, d.DeviceID)
+	}
+	if want := []string{"d2", "d1"}; !slices.Equal(got, want) {
+		t.Errorf("Silent = %v, want %v", got, want)
+	}
+}
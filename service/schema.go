@@ -0,0 +1,321 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+	"github.com/rs/zerolog"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// SchemaMode tells what happens to a payload that does not match its data model schema
+type SchemaMode string
+
+const (
+	// SchemaStrict rejects the message
+	SchemaStrict SchemaMode = "strict"
+	// SchemaLenient logs the violations and lets the message through
+	SchemaLenient SchemaMode = "lenient"
+)
+
+// ISchemaSource loads the JSON Schema of a data model, it returns a nil schema when the data model has none
+type ISchemaSource interface {
+	LoadSchema(dataModel string) ([]byte, error)
+}
+
+// SchemaViolation is a single schema error located in the payload
+type SchemaViolation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ErrSchemaValidation is returned when a payload does not match the schema of its data model
+type ErrSchemaValidation struct {
+	DeviceID   string
+	DataModel  string
+	Violations []SchemaViolation
+}
+
+func (e *ErrSchemaValidation) Error() string {
+	details := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		details[i] = v.Path + ": " + v.Message
+	}
+	return fmt.Sprintf("payload of device %s does not match the %s schema: %s", e.DeviceID, e.DataModel, strings.Join(details, "; "))
+}
+
+// Loading a schema is retried, the source may be a Redis that timed out, a data model whose load failed is not
+// loaded again before the cooldown
+const (
+	schemaLoadAttempts = 3
+	schemaLoadBackoff  = 100 * time.Millisecond
+	schemaLoadCooldown = 5 * time.Second
+)
+
+// ErrSchemaUnavailable is returned when the schema of a data model cannot be compiled
+type ErrSchemaUnavailable struct {
+	DataModel string
+	Err       error
+}
+
+func (e *ErrSchemaUnavailable) Error() string {
+	return fmt.Sprintf("schema of data model %s unavailable: %v", e.DataModel, e.Err)
+}
+
+func (e *ErrSchemaUnavailable) Unwrap() error {
+	return e.Err
+}
+
+// ErrSchemaLoad is returned when the schema source failed on every attempt, the payload was not checked so the
+// message may succeed when processed again
+type ErrSchemaLoad struct {
+	DataModel string
+	Attempts  int
+	Err       error
+}
+
+func (e *ErrSchemaLoad) Error() string {
+	return fmt.Sprintf("loading the schema of data model %s failed after %d attempts: %v", e.DataModel, e.Attempts, e.Err)
+}
+
+func (e *ErrSchemaLoad) Unwrap() error {
+	return e.Err
+}
+
+// schemaFailure is a failed load, returned again until the cooldown ends
+type schemaFailure struct {
+	err   error
+	until time.Time
+}
+
+// SchemaValidator validates payloads against the JSON Schema of their data model, compiled schemas
+// are kept until Flush
+type SchemaValidator struct {
+	source      ISchemaSource
+	defaultMode SchemaMode
+	modes       map[string]SchemaMode
+	logger      *zerolog.Logger
+	attempts    int
+	backoff     time.Duration
+	cooldown    time.Duration
+
+	mu       sync.Mutex
+	schemas  map[string]*jsonschema.Schema
+	failures map[string]schemaFailure
+	// loading holds a channel per data model being loaded, closed when the load is over
+	loading map[string]chan struct{}
+	// flushes counts the calls to Flush, a load started before one is not kept
+	flushes int
+}
+
+// NewSchemaValidator creates a validator using defaultMode for the data models missing from modes
+func NewSchemaValidator(source ISchemaSource, defaultMode SchemaMode, modes map[string]string, logger *zerolog.Logger) *SchemaValidator {
+	var l zerolog.Logger
+
+	if logger == nil {
+		l = zerolog.New(os.Stdout).With().Timestamp().Logger()
+	} else {
+		l = *logger
+	}
+
+	v := &SchemaValidator{
+		source:      source,
+		defaultMode: defaultMode,
+		modes:       make(map[string]SchemaMode, len(modes)),
+		logger:      &l,
+		attempts:    schemaLoadAttempts,
+		backoff:     schemaLoadBackoff,
+		cooldown:    schemaLoadCooldown,
+		schemas:     make(map[string]*jsonschema.Schema),
+		failures:    make(map[string]schemaFailure),
+		loading:     make(map[string]chan struct{}),
+	}
+	for dataModel, mode := range modes {
+		v.modes[dataModel] = SchemaMode(mode)
+	}
+	return v
+}
+
+// Mode returns the validation mode of a data model
+func (v *SchemaValidator) Mode(dataModel string) SchemaMode {
+	if mode, ok := v.modes[dataModel]; ok {
+		return mode
+	}
+	return v.defaultMode
+}
+
+// Validate checks the message payload against the schema of its data model, in lenient mode the
+// problems are logged and nil is returned
+func (v *SchemaValidator) Validate(msg *domain.EnrichedMessage) error {
+	err := v.validate(msg)
+	if err == nil || v.Mode(msg.DataModel) == SchemaStrict {
+		return err
+	}
+	v.logger.Warn().Msgf("Accepted in lenient mode: %v", err)
+	return nil
+}
+
+// Flush drops the compiled schemas and the failed loads so they are loaded again, it returns how many
+// schemas were dropped
+func (v *SchemaValidator) Flush() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	n := len(v.schemas)
+	v.schemas = make(map[string]*jsonschema.Schema)
+	v.failures = make(map[string]schemaFailure)
+	v.flushes++
+	v.logger.Info().Msgf("Flushed %d payload schemas", n)
+	return n
+}
+
+func (v *SchemaValidator) validate(msg *domain.EnrichedMessage) error {
+	schema, err := v.schema(msg.DataModel)
+	if err != nil {
+		return err
+	}
+	if schema == nil {
+		return nil
+	}
+
+	payload, err := jsonschema.UnmarshalJSON(bytes.NewReader(msg.Data))
+	if err != nil {
+		return &ErrSchemaValidation{
+			DeviceID:   msg.DeviceID,
+			DataModel:  msg.DataModel,
+			Violations: []SchemaViolation{{Path: "/", Message: "payload is not valid JSON: " + err.Error()}},
+		}
+	}
+
+	err = schema.Validate(payload)
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		return &ErrSchemaValidation{
+			DeviceID:   msg.DeviceID,
+			DataModel:  msg.DataModel,
+			Violations: violations(validationErr),
+		}
+	}
+	return err
+}
+
+// schema returns the compiled schema of a data model, nil when the data model has none, the source is read
+// outside the lock by a single caller while the others wait for its result
+func (v *SchemaValidator) schema(dataModel string) (*jsonschema.Schema, error) {
+	v.mu.Lock()
+	for {
+		if schema, ok := v.schemas[dataModel]; ok {
+			v.mu.Unlock()
+			return schema, nil
+		}
+		if failure, ok := v.failures[dataModel]; ok && time.Now().Before(failure.until) {
+			v.mu.Unlock()
+			return nil, failure.err
+		}
+		done, ok := v.loading[dataModel]
+		if !ok {
+			break
+		}
+		v.mu.Unlock()
+		<-done
+		v.mu.Lock()
+	}
+	done := make(chan struct{})
+	v.loading[dataModel] = done
+	flushes := v.flushes
+	v.mu.Unlock()
+
+	schema, err := v.compile(dataModel)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.loading, dataModel)
+	close(done)
+	if flushes != v.flushes {
+		return schema, err
+	}
+	if err != nil {
+		v.failures[dataModel] = schemaFailure{err: err, until: time.Now().Add(v.cooldown)}
+		return nil, err
+	}
+	delete(v.failures, dataModel)
+	v.schemas[dataModel] = schema
+	return schema, nil
+}
+
+// compile loads and compiles the schema of a data model
+func (v *SchemaValidator) compile(dataModel string) (*jsonschema.Schema, error) {
+	b, err := v.load(dataModel)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		v.logger.Debug().Msgf("No payload schema for data model %s", dataModel)
+		return nil, nil
+	}
+	schema, err := compileSchema(dataModel, b)
+	if err != nil {
+		return nil, &ErrSchemaUnavailable{DataModel: dataModel, Err: err}
+	}
+	v.logger.Info().Msgf("Loaded payload schema of data model %s", dataModel)
+	return schema, nil
+}
+
+// load reads the schema of a data model from the source, doubling the delay between attempts
+func (v *SchemaValidator) load(dataModel string) ([]byte, error) {
+	delay := v.backoff
+	for attempt := 1; ; attempt++ {
+		b, err := v.source.LoadSchema(dataModel)
+		if err == nil {
+			return b, nil
+		}
+		if attempt >= v.attempts {
+			return nil, &ErrSchemaLoad{DataModel: dataModel, Attempts: attempt, Err: err}
+		}
+		v.logger.Warn().Msgf("Loading the schema of data model %s failed, attempt %d, retrying in %s: %v", dataModel, attempt, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func compileSchema(dataModel string, b []byte) (*jsonschema.Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	location := "urn:dataenricher:schema:" + dataModel
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+	err = compiler.AddResource(location, doc)
+	if err != nil {
+		return nil, err
+	}
+	return compiler.Compile(location)
+}
+
+// violations flattens a validation error into its leaf errors, located by JSON pointer in the payload
+func violations(err *jsonschema.ValidationError) []SchemaViolation {
+	var result []SchemaViolation
+
+	for _, unit := range err.BasicOutput().Errors {
+		if unit.Error == nil {
+			continue
+		}
+		path := unit.InstanceLocation
+		if path == "" {
+			path = "/"
+		}
+		result = append(result, SchemaViolation{Path: path, Message: unit.Error.String()})
+	}
+	if len(result) == 0 {
+		result = append(result, SchemaViolation{Path: "/", Message: err.Error()})
+	}
+	return result
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+	"github.com/rs/zerolog"
+)
+
+// flakySchemaSource fails the first failures loads, then serves schema
+type flakySchemaSource struct {
+	failures int
+	schema   string
+	loads    int
+}
+
+func (s *flakySchemaSource) LoadSchema(dataModel string) ([]byte, error) {
+	s.loads++
+	if s.loads <= s.failures {
+		return nil, errors.New("redis: i/o timeout")
+	}
+	if s.schema == "" {
+		return nil, nil
+	}
+	return []byte(s.schema), nil
+}
+
+func TestSchemaValidator(t *testing.T) {
+	const schema = `{"type":"object","required":["serialId"]}`
+	tests := []struct {
+		name      string
+		source    *flakySchemaSource
+		mode      SchemaMode
+		payload   string
+		want      any
+		wantLoads int
+	}{
+		{name: "valid", source: &flakySchemaSource{schema: schema}, mode: SchemaStrict, payload: `{"serialId":"d1"}`, wantLoads: 1},
+		{name: "no schema", source: &flakySchemaSource{}, mode: SchemaStrict, payload: `{}`, wantLoads: 1},
+		{name: "violation", source: &flakySchemaSource{schema: schema}, mode: SchemaStrict, payload: `{}`, want: new(*ErrSchemaValidation), wantLoads: 1},
+		{name: "violation accepted in lenient mode", source: &flakySchemaSource{schema: schema}, mode: SchemaLenient, payload: `{}`, wantLoads: 1},
+		{name: "load retried", source: &flakySchemaSource{failures: 2, schema: schema}, mode: SchemaStrict, payload: `{"serialId":"d1"}`, wantLoads: 3},
+		{name: "load failing", source: &flakySchemaSource{failures: 5, schema: schema}, mode: SchemaStrict, payload: `{"serialId":"d1"}`, want: new(*ErrSchemaLoad), wantLoads: 3},
+		{name: "invalid schema", source: &flakySchemaSource{schema: `{"type":"nope"}`}, mode: SchemaStrict, payload: `{}`, want: new(*ErrSchemaUnavailable), wantLoads: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zerolog.Nop()
+			v := NewSchemaValidator(tt.source, tt.mode, nil, &logger)
+			v.backoff = 0
+
+			err := v.Validate(&domain.EnrichedMessage{DeviceID: "d1", DataModel: "geokonapi", Data: []byte(tt.payload)})
+			if tt.want == nil && err != nil || tt.want != nil && !errors.As(err, tt.want) {
+				t.Errorf("Validate error = %v, want %T", err, tt.want)
+			}
+			if tt.source.loads != tt.wantLoads {
+				t.Errorf("%d loads, want %d", tt.source.loads, tt.wantLoads)
+			}
+		})
+	}
+}
+
+func TestSchemaLoadCooldown(t *testing.T) {
+	tests := []struct {
+		name      string
+		cooldown  time.Duration
+		flush     bool
+		wantErr   bool
+		wantLoads int
+	}{
+		{name: "failure kept during the cooldown", cooldown: time.Hour, wantErr: true, wantLoads: 3},
+		{name: "loaded again after the cooldown", wantLoads: 4},
+		{name: "loaded again after a flush", cooldown: time.Hour, flush: true, wantLoads: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &flakySchemaSource{failures: 3, schema: `{"type":"object"}`}
+			logger := zerolog.Nop()
+			v := NewSchemaValidator(source, SchemaStrict, nil, &logger)
+			v.backoff = 0
+			v.cooldown = tt.cooldown
+			msg := &domain.EnrichedMessage{DeviceID: "d1", DataModel: "geokonapi", Data: []byte(`{}`)}
+
+			var loadErr *ErrSchemaLoad
+			if err := v.Validate(msg); !errors.As(err, &loadErr) {
+				t.Fatalf("first Validate error = %v, want a load error", err)
+			}
+			if tt.flush {
+				v.Flush()
+			}
+			err := v.Validate(msg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("second Validate error = %v, want error %t", err, tt.wantErr)
+			}
+			if source.loads != tt.wantLoads {
+				t.Errorf("%d loads, want %d", source.loads, tt.wantLoads)
+			}
+		})
+	}
+}
+
+// blockingSchemaSource counts the loads of the blocked data model and serves its schema once released
+type blockingSchemaSource struct {
+	blocked string
+	release chan struct{}
+	loads   atomic.Int32
+}
+
+func (s *blockingSchemaSource) LoadSchema(dataModel string) ([]byte, error) {
+	if dataModel == s.blocked {
+		s.loads.Add(1)
+		<-s.release
+	}
+	return []byte(`{"type":"object"}`), nil
+}
+
+func TestSchemaLoadShared(t *testing.T) {
+	source := &blockingSchemaSource{blocked: "geokonapi", release: make(chan struct{})}
+	logger := zerolog.Nop()
+	v := NewSchemaValidator(source, SchemaStrict, nil, &logger)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Go(func() {
+			if err := v.Validate(&domain.EnrichedMessage{DeviceID: "d1", DataModel: "geokonapi", Data: []byte(`{}`)}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	// Another data model is not held up by the pending load
+	if err := v.Validate(&domain.EnrichedMessage{DeviceID: "d2", DataModel: "other", Data: []byte(`{}`)}); err != nil {
+		t.Error(err)
+	}
+	close(source.release)
+	wg.Wait()
+	if n := source.loads.Load(); n != 1 {
+		t.Errorf("%d loads, want 1", n)
+	}
+}
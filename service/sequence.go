@@ -0,0 +1,140 @@
+package service
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// ISequenceState keeps the time of the last observation of every device
+type ISequenceState interface {
+	// LastObservation returns the last observation time of the device, false when none was recorded
+	LastObservation(deviceID string) (time.Time, bool, error)
+	SetLastObservation(deviceID string, t time.Time) error
+}
+
+// Sequencer flags the observations older than the last one of their device and those following a gap of
+// missed reports or more, given the reporting interval found in the registry at path
+type Sequencer struct {
+	state           ISequenceState
+	path            string
+	defaultInterval time.Duration
+	missed          int
+}
+
+// NewSequencer creates a sequencer, devices without an interval in the registry use defaultInterval and are
+// only checked for ordering when it is zero
+func NewSequencer(state ISequenceState, path string, defaultInterval time.Duration, missed int) *Sequencer {
+	if missed <= 0 {
+		missed = 1
+	}
+	return &Sequencer{state: state, path: path, defaultInterval: defaultInterval, missed: missed}
+}
+
+// Check flags the observations of the message and returns the gaps they close, in observation order,
+// skewed observations are left out
+func (s *Sequencer) Check(msg *domain.EnrichedMessage) ([]domain.Gap, error) {
+	if msg.GeoKon == nil {
+		return nil, nil
+	}
+
+	interval, err := reportingInterval(*msg, s.path, s.defaultInterval)
+	if err != nil {
+		return nil, err
+	}
+	last, seen, err := s.state.LastObservation(msg.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var gaps []domain.Gap
+	latest := last
+	for i := range msg.GeoKon.Observations {
+		o := &msg.GeoKon.Observations[i]
+		if o.Skew != "" {
+			continue
+		}
+		if !seen {
+			latest, seen = o.Time, true
+			continue
+		}
+		if o.Time.Before(last) {
+			o.Sequence = domain.SequenceOutOfOrder
+			continue
+		}
+		// The observations of a message may come in any order, the gap is measured from the latest one
+		if o.Time.After(latest) {
+			from := latest
+			latest = o.Time
+			if interval <= 0 {
+				continue
+			}
+			missed := int(math.Round(float64(o.Time.Sub(from))/float64(interval))) - 1
+			if missed < s.missed {
+				continue
+			}
+			o.Sequence = domain.SequenceGap
+			gaps = append(gaps, domain.Gap{
+				DeviceID:        msg.DeviceID,
+				SiteCode:        msg.SiteCode,
+				From:            from,
+				To:              o.Time,
+				GapSeconds:      o.Time.Sub(from).Seconds(),
+				IntervalSeconds: interval.Seconds(),
+				MissedReports:   missed,
+			})
+		}
+	}
+
+	if latest.After(last) {
+		err = s.state.SetLastObservation(msg.DeviceID, latest)
+	}
+	return gaps, err
+}
+
+// WithSequence flags the out of order observations and the gaps of every device
+func (s *Service) WithSequence(sequencer *Sequencer) *Service {
+	s.sequencer = sequencer
+	return s
+}
+
+// sequence fails open, the observations are not flagged when the state is unavailable
+func (s *Service) sequence(msg *domain.EnrichedMessage) {
+	if s.sequencer == nil {
+		return
+	}
+
+	gaps, err := s.sequencer.Check(msg)
+	if err != nil {
+		s.logger.Warn().Msgf("Sequence tracking unavailable for device %s: %v", msg.DeviceID, err)
+	}
+	msg.Gaps = gaps
+}
+
+// MemorySequenceState keeps the last observations in the process, they are lost on restart
+type MemorySequenceState struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func NewMemorySequenceState() *MemorySequenceState {
+	return &MemorySequenceState{last: make(map[string]time.Time)}
+}
+
+func (m *MemorySequenceState) LastObservation(deviceID string) (time.Time, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.last[deviceID]
+	return t, ok, nil
+}
+
+func (m *MemorySequenceState) SetLastObservation(deviceID string, t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.last[deviceID] = t
+	return nil
+}
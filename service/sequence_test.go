@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+func TestSequencerCheck(t *testing.T) {
+	gap, late := domain.SequenceGap, domain.SequenceOutOfOrder
+
+	tests := []struct {
+		name       string
+		registry   string
+		messages   [][]int
+		skewed     []int
+		wantFlags  []string
+		wantMissed []int
+	}{
+		{
+			name:      "in order",
+			registry:  `{"interval":60}`,
+			messages:  [][]int{{0, 1, 2}},
+			wantFlags: []string{"", "", ""},
+		},
+		{
+			name:       "gap within a message",
+			registry:   `{"interval":60}`,
+			messages:   [][]int{{0, 1, 4}},
+			wantFlags:  []string{"", "", gap},
+			wantMissed: []int{2},
+		},
+		{
+			name:      "fewer missed reports than the limit",
+			registry:  `{"interval":60}`,
+			messages:  [][]int{{0, 2}},
+			wantFlags: []string{"", ""},
+		},
+		{
+			name:       "gap across messages",
+			registry:   `{"interval":"1m"}`,
+			messages:   [][]int{{0}, {5}},
+			wantFlags:  []string{"", gap},
+			wantMissed: []int{4},
+		},
+		{
+			name:       "out of order across messages",
+			registry:   `{"interval":60}`,
+			messages:   [][]int{{0, 5}, {3}},
+			wantFlags:  []string{"", gap, late},
+			wantMissed: []int{4},
+		},
+		{
+			name:       "unordered within a message",
+			registry:   `{"interval":60}`,
+			messages:   [][]int{{0}, {3, 2, 1}},
+			wantFlags:  []string{"", gap, "", ""},
+			wantMissed: []int{2},
+		},
+		{
+			name:      "skewed observations left out",
+			registry:  `{"interval":60}`,
+			messages:  [][]int{{0}, {10, 1}},
+			skewed:    []int{1},
+			wantFlags: []string{"", "", ""},
+		},
+		{
+			name:      "ordering only without an interval",
+			registry:  `{}`,
+			messages:  [][]int{{0, 10}, {5}},
+			wantFlags: []string{"", "", late},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sequencer := NewSequencer(NewMemorySequenceState(), "interval", 0, 2)
+
+			var (
+				flags  []string
+				missed []int
+				index  int
+			)
+			for _, minutes := range tt.messages {
+				msg := readingsMessage(tt.registry, make([]float64, len(minutes))...)
+				for i, m := range minutes {
+					msg.GeoKon.Observations[i].Time = readingsStart.Add(time.Duration(m) * time.Minute)
+					if slices.Contains(tt.skewed, index+i) {
+						msg.GeoKon.Observations[i].Skew = "future"
+					}
+				}
+				index += len(minutes)
+
+				gaps, err := sequencer.Check(&msg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, o := range msg.GeoKon.Observations {
+					flags = append(flags, o.Sequence)
+				}
+				for _, g := range gaps {
+					missed = append(missed, g.MissedReports)
+				}
+			}
+			if !slices.Equal(flags, tt.wantFlags) {
+				t.Errorf("flags = %q, want %q", flags, tt.wantFlags)
+			}
+			if !slices.Equal(missed, tt.wantMissed) {
+				t.Errorf("missed reports = %v, want %v", missed, tt.wantMissed)
+			}
+		})
+	}
+}
+
+// failingOnce is a transform failing its first message
+type failingOnce struct {
+	failed bool
+}
+
+func (f *failingOnce) Name() string {
+	return "failing once"
+}
+
+func (f *failingOnce) Apply(*domain.EnrichedMessage) error {
+	if f.failed {
+		return nil
+	}
+	f.failed = true
+	return errors.New("registry unavailable")
+}
+
+func TestSequenceAfterRejection(t *testing.T) {
+	s := newTestService().
+		WithSequence(NewSequencer(NewMemorySequenceState(), "interval", 0, 1)).
+		WithTransforms(&failingOnce{})
+	s.sequencer.state.SetLastObservation("d1", mustTime(t, "2024-05-01T10:00:00Z"))
+
+	inbound := geoKonMessage("e1", "2024-05-01T10:05:00Z")
+	if _, err := s.ProcessMessage(inbound); err == nil {
+		t.Fatal("transform error not returned")
+	}
+	msg, err := s.ProcessMessage(inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flag := msg.GeoKon.Observations[0].Sequence; flag != domain.SequenceGap {
+		t.Errorf("redelivered observation flagged %q, want %q", flag, domain.SequenceGap)
+	}
+	if len(msg.Gaps) != 1 || msg.Gaps[0].MissedReports != 4 {
+		t.Errorf("gaps = %+v, want 4 missed reports", msg.Gaps)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/Go-routine-4595/DataEnricher/domain"
 	"github.com/rs/zerolog"
@@ -26,17 +28,97 @@ func NewErrNotGeoKonAPIData(message string) *ErrNotGeoKonAPIData {
 	return &ErrNotGeoKonAPIData{Message: message}
 }
 
+// ErrInvalidFormat is returned when the inbound message cannot be decoded
+type ErrInvalidFormat struct {
+	Err error
+}
+
+func (e *ErrInvalidFormat) Error() string {
+	return fmt.Sprintf("invalid message format: %v", e.Err)
+}
+
+func (e *ErrInvalidFormat) Unwrap() error {
+	return e.Err
+}
+
+// ErrRepository is returned when the device registry cannot be read
+type ErrRepository struct {
+	DeviceID string
+	Err      error
+}
+
+func (e *ErrRepository) Error() string {
+	return fmt.Sprintf("registry lookup failed for device %s: %v", e.DeviceID, e.Err)
+}
+
+func (e *ErrRepository) Unwrap() error {
+	return e.Err
+}
+
+// ErrEnrichment is returned when the registry entry cannot be applied to the message
+type ErrEnrichment struct {
+	DeviceID string
+	Err      error
+}
+
+func (e *ErrEnrichment) Error() string {
+	return fmt.Sprintf("enrichment failed for device %s: %v", e.DeviceID, e.Err)
+}
+
+func (e *ErrEnrichment) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidPayload is returned when the geokonapi payload is malformed or inconsistent
+type ErrInvalidPayload struct {
+	DeviceID string
+	Err      error
+}
+
+func (e *ErrInvalidPayload) Error() string {
+	return fmt.Sprintf("invalid payload from device %s: %v", e.DeviceID, e.Err)
+}
+
+func (e *ErrInvalidPayload) Unwrap() error {
+	return e.Err
+}
+
 type IProcessMessage interface {
 	ProcessMessage(msg []byte) (domain.EnrichedMessage, error)
 }
 
+// IRegistryInspector exposes the registry side of the service for runtime inspection
+type IRegistryInspector interface {
+	LookupDevice(deviceID string) (domain.EnrichedMessage, error)
+	FlushRegistryCache() int
+}
+
+// ISkewInspector exposes the devices that sent readings with skewed timestamps
+type ISkewInspector interface {
+	SkewedDevices() []domain.SkewedDevice
+}
+
 type IRepository interface {
 	Get(key string) (string, error)
 }
 
+// IRegistryCache is implemented by repositories that cache registry entries
+type IRegistryCache interface {
+	Flush() int
+}
+
 type Service struct {
-	repository IRepository
-	logger     *zerolog.Logger
+	repository   IRepository
+	schemas      *SchemaValidator
+	transforms   []ITransform
+	seen         ISeenSet
+	dedupWindow  time.Duration
+	dedupMetrics IDedupMetrics
+	clockSkew    *ClockSkew
+	sequencer    *Sequencer
+	fields       map[string]string
+	omitRaw      bool
+	logger       *zerolog.Logger
 }
 
 func NewService(repo IRepository, logger *zerolog.Logger) *Service {
@@ -51,6 +133,22 @@ func NewService(repo IRepository, logger *zerolog.Logger) *Service {
 	return &Service{repository: repo, logger: &l}
 }
 
+// WithSchemaValidator validates the payloads against the schema of the data model found in the registry
+func (s *Service) WithSchemaValidator(v *SchemaValidator) *Service {
+	s.schemas = v
+	return s
+}
+
+// WithRegistryProjection copies the registry values at the given paths, keyed by output field name, into
+// the enriched message and drops the raw registry when omitRaw is set
+func (s *Service) WithRegistryProjection(fields map[string]string, omitRaw bool) *Service {
+	s.fields = fields
+	s.omitRaw = omitRaw
+	return s
+}
+
+// ProcessMessage enriches, validates and transforms a message, once the registry is found the message is
+// returned with the error so it can be attributed to its site
 func (s *Service) ProcessMessage(msg []byte) (domain.EnrichedMessage, error) {
 	var (
 		enrichedMessage domain.EnrichedMessage
@@ -58,22 +156,110 @@ func (s *Service) ProcessMessage(msg []byte) (domain.EnrichedMessage, error) {
 	)
 
 	err = json.Unmarshal(msg, &enrichedMessage)
+	if err != nil {
+		return domain.EnrichedMessage{}, &ErrInvalidFormat{Err: err}
+	}
+	enrichedMessage.IngestTime = time.Now().UTC().Truncate(time.Millisecond)
+	err = s.enrich(&enrichedMessage)
 	if err != nil {
 		return domain.EnrichedMessage{}, err
 	}
-	key := "device-" + enrichedMessage.DeviceID
-	registry, err := s.repository.Get(key)
+	if s.schemas != nil {
+		err = s.schemas.Validate(&enrichedMessage)
+		if err != nil {
+			return enrichedMessage, err
+		}
+	}
+
+	if !enrichedMessage.IsGeoKonAPIDataModel() {
+		return enrichedMessage, NewErrNotGeoKonAPIData("invalid data format")
+	}
+	err = enrichedMessage.ParseGeoKonPayload()
 	if err != nil {
-		return domain.EnrichedMessage{}, fmt.Errorf(" %w -- srource_topic: %s ", err, enrichedMessage.SourceTopic)
+		return enrichedMessage, &ErrInvalidPayload{DeviceID: enrichedMessage.DeviceID, Err: err}
 	}
-	err = enrichedMessage.Enrich([]byte(registry))
+	err = s.deduplicate(&enrichedMessage)
 	if err != nil {
-		return domain.EnrichedMessage{}, err
+		return enrichedMessage, err
+	}
+	err = s.process(&enrichedMessage)
+	if err != nil {
+		// The event was marked seen, a redelivery must not be dropped as a duplicate of a rejected message
+		s.ForgetEvent(enrichedMessage)
+		return enrichedMessage, err
 	}
+	s.project(&enrichedMessage)
 
-	if !enrichedMessage.IsGeoKonAPIDataModel() {
-		return domain.EnrichedMessage{}, NewErrNotGeoKonAPIData("invalid data format")
+	return enrichedMessage, nil
+}
+
+// process runs the stages that follow the deduplication
+func (s *Service) process(enrichedMessage *domain.EnrichedMessage) error {
+	err := s.checkClockSkew(enrichedMessage)
+	if err != nil {
+		return err
+	}
+	err = s.transform(enrichedMessage)
+	if err != nil {
+		return err
 	}
+	// The sequence state only moves once the message is accepted, a redelivery of a rejected message is not
+	// out of order and still closes its gaps
+	s.sequence(enrichedMessage)
+	// The fields changed by the stages, the normalized timestamps included, are merged into the payload
+	return enrichedMessage.SyncPayload()
+}
+
+// LookupDevice returns what the enricher would attach to a message from the given device
+func (s *Service) LookupDevice(deviceID string) (domain.EnrichedMessage, error) {
+	enrichedMessage := domain.EnrichedMessage{DeviceID: deviceID}
 
+	err := s.enrich(&enrichedMessage)
+	if err != nil {
+		return domain.EnrichedMessage{}, err
+	}
 	return enrichedMessage, nil
 }
+
+// FlushRegistryCache drops the cached registry entries, if the repository caches any, and the
+// compiled payload schemas
+func (s *Service) FlushRegistryCache() int {
+	var n int
+
+	if cache, ok := s.repository.(IRegistryCache); ok {
+		n += cache.Flush()
+	}
+	if s.schemas != nil {
+		n += s.schemas.Flush()
+	}
+	return n
+}
+
+// project is the last step of the processing
+func (s *Service) project(enrichedMessage *domain.EnrichedMessage) {
+	if len(s.fields) > 0 {
+		missing := enrichedMessage.Project(s.fields)
+		if len(missing) > 0 {
+			s.logger.Debug().Msgf("Registry of device %s has no %s", enrichedMessage.DeviceID, strings.Join(missing, ", "))
+		}
+	}
+	if s.omitRaw {
+		enrichedMessage.OmitRegistry = true
+	}
+}
+
+func (s *Service) enrich(enrichedMessage *domain.EnrichedMessage) error {
+	key := "device-" + enrichedMessage.DeviceID
+	registry, err := s.repository.Get(key)
+	if err != nil {
+		return &ErrRepository{
+			DeviceID: enrichedMessage.DeviceID,
+			Err:      fmt.Errorf(" %w -- srource_topic: %s ", err, enrichedMessage.SourceTopic),
+		}
+	}
+	err = enrichedMessage.Enrich([]byte(registry))
+	if err != nil {
+		return &ErrEnrichment{DeviceID: enrichedMessage.DeviceID, Err: err}
+	}
+	return nil
+}
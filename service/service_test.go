@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+	"github.com/rs/zerolog"
+)
+
+// fakeRepository serves the registry entries keyed by device id
+type fakeRepository map[string]string
+
+func (r fakeRepository) Get(key string) (string, error) {
+	registry, ok := r[strings.TrimPrefix(key, "device-")]
+	if !ok {
+		return "", fmt.Errorf("key '%s' not found", key)
+	}
+	return registry, nil
+}
+
+func newTestService() *Service {
+	logger := zerolog.Nop()
+	return NewService(fakeRepository{
+		"d1": `{"siteCode":"s1","dataModel":"geokonapi","interval":60}`,
+	}, &logger)
+}
+
+// geoKonMessage is an inbound message of device d1 with one observation per time
+func geoKonMessage(eventUUID string, times ...string) []byte {
+	observations := make([]string, len(times))
+	for i, t := range times {
+		observations[i] = fmt.Sprintf(`{"time":%q,"value":[%d]}`, t, i+1)
+	}
+	return []byte(fmt.Sprintf(`{"source_topic":"in","device_id":"d1","payload":{"serialId":"d1","eventUuid":%q,"metric":["t"],"unit":["C"],"observations":[%s]}}`,
+		eventUUID, strings.Join(observations, ",")))
+}
+
+func TestProcessMessage(t *testing.T) {
+	msg, err := newTestService().ProcessMessage(geoKonMessage("e1", "2024-05-01T10:00:00Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.SiteCode != "s1" || msg.DataModel != "geokonapi" || msg.GeoKon == nil {
+		t.Errorf("ProcessMessage = %+v", msg)
+	}
+	if msg.IngestTime.IsZero() {
+		t.Error("ingest time not set")
+	}
+	if !strings.Contains(string(msg.Data), `"2024-05-01T10:00:00.000Z"`) {
+		t.Errorf("timestamp not normalized in %s", msg.Data)
+	}
+}
+
+func TestProcessMessageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want any
+	}{
+		{name: "invalid json", msg: `{`, want: new(*ErrInvalidFormat)},
+		{name: "unknown device", msg: `{"device_id":"d9","payload":{}}`, want: new(*ErrRepository)},
+		{name: "invalid payload", msg: `{"device_id":"d1","payload":{"serialId":"d2"}}`, want: new(*ErrInvalidPayload)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTestService().ProcessMessage([]byte(tt.msg))
+			if err == nil || !errors.As(err, tt.want) {
+				t.Errorf("ProcessMessage error = %v, want %T", err, tt.want)
+			}
+		})
+	}
+}
+
+func mustTime(t *testing.T, value string) time.Time {
+	t.Helper()
+
+	ts, err := domain.ParseTimestamp(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// ITransform is a step applied, in order, to the parsed payload of an enriched message
+type ITransform interface {
+	Name() string
+	Apply(msg *domain.EnrichedMessage) error
+}
+
+// ErrTransform is returned when a transform cannot be applied to a message
+type ErrTransform struct {
+	DeviceID  string
+	Transform string
+	Err       error
+}
+
+func (e *ErrTransform) Error() string {
+	return fmt.Sprintf("%s failed for device %s: %v", e.Transform, e.DeviceID, e.Err)
+}
+
+func (e *ErrTransform) Unwrap() error {
+	return e.Err
+}
+
+// WithTransforms appends transforms to the processing of geokonapi messages
+func (s *Service) WithTransforms(transforms ...ITransform) *Service {
+	s.transforms = append(s.transforms, transforms...)
+	return s
+}
+
+func (s *Service) transform(msg *domain.EnrichedMessage) error {
+	for _, t := range s.transforms {
+		err := t.Apply(msg)
+		if err != nil {
+			return &ErrTransform{DeviceID: msg.DeviceID, Transform: t.Name(), Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// IUnitSystemSource returns the unit system configured for a site or, failing that, for a data model,
+// empty when neither has one
+type IUnitSystemSource interface {
+	UnitSystem(siteCode, dataModel string) (string, error)
+}
+
+// UnitConversion is the transform normalizing the payload units to their UCUM code and converting the
+// values to the unit system configured in the registry, unknown units are rejected or flagged
+type UnitConversion struct {
+	source        IUnitSystemSource
+	rejectUnknown bool
+}
+
+func NewUnitConversion(source IUnitSystemSource, rejectUnknown bool) *UnitConversion {
+	return &UnitConversion{source: source, rejectUnknown: rejectUnknown}
+}
+
+func (c *UnitConversion) Name() string {
+	return "unit conversion"
+}
+
+func (c *UnitConversion) Apply(msg *domain.EnrichedMessage) error {
+	payload := msg.GeoKon
+	if payload == nil {
+		return nil
+	}
+
+	name, err := c.source.UnitSystem(msg.SiteCode, msg.DataModel)
+	if err != nil {
+		return err
+	}
+	system, err := domain.ParseUnitSystem(name)
+	if err != nil {
+		return fmt.Errorf("site %s: %w", msg.SiteCode, err)
+	}
+
+	var errs []error
+	for j, unit := range payload.Unit {
+		code, err := c.convert(payload, unit, system, func(o *domain.Observation) *float64 {
+			if j >= len(o.Value) {
+				return nil
+			}
+			return &o.Value[j]
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("/unit/%d: %w", j, err))
+			continue
+		}
+		payload.Unit[j] = code
+	}
+	for j, unit := range payload.EngineeringUnit {
+		if unit == "" {
+			continue
+		}
+		code, err := c.convert(payload, unit, system, func(o *domain.Observation) *float64 {
+			if j >= len(o.Engineering) {
+				return nil
+			}
+			return o.Engineering[j]
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("/engineeringUnit/%d: %w", j, err))
+			continue
+		}
+		payload.EngineeringUnit[j] = code
+	}
+	return errors.Join(errs...)
+}
+
+// convert converts the values selected by value from unit to its counterpart in system and returns the code
+// of the unit they are in, unknown units are returned unchanged
+func (c *UnitConversion) convert(payload *domain.GeoKonPayload, unit string, system domain.UnitSystem, value func(*domain.Observation) *float64) (string, error) {
+	from, ok := domain.NormalizeUnit(unit)
+	if !ok {
+		if c.rejectUnknown {
+			return "", fmt.Errorf("unknown unit %q", unit)
+		}
+		if !slices.Contains(payload.UnknownUnits, unit) {
+			payload.UnknownUnits = append(payload.UnknownUnits, unit)
+		}
+		return unit, nil
+	}
+
+	to := from.In(system)
+	for i := range payload.Observations {
+		v := value(&payload.Observations[i])
+		if v == nil {
+			continue
+		}
+		converted, err := from.Convert(*v, to)
+		if err != nil {
+			return "", err
+		}
+		*v = converted
+	}
+	return to.Code, nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// staticUnitSystem configures the same unit system for every site
+type staticUnitSystem struct {
+	system string
+	err    error
+}
+
+func (s staticUnitSystem) UnitSystem(siteCode, dataModel string) (string, error) {
+	return s.system, s.err
+}
+
+func TestUnitConversion(t *testing.T) {
+	tests := []struct {
+		name            string
+		source          staticUnitSystem
+		rejectUnknown   bool
+		units           []string
+		engineeringUnit []string
+		wantUnits       []string
+		wantEngineering []string
+		wantValues      []float64
+		wantUnknown     []string
+		wantErr         string
+	}{
+		{
+			name:       "normalized only",
+			units:      []string{"°C", "kilopascal"},
+			wantUnits:  []string{"Cel", "kPa"},
+			wantValues: []float64{100, 50},
+		},
+		{
+			name:       "converted to the site system",
+			source:     staticUnitSystem{system: "imperial"},
+			units:      []string{"°C", "kilopascal"},
+			wantUnits:  []string{"[degF]", "[psi]"},
+			wantValues: []float64{212, 7.251886886},
+		},
+		{
+			name:            "engineering values converted",
+			source:          staticUnitSystem{system: "imperial"},
+			units:           []string{"digits", "V"},
+			engineeringUnit: []string{"C", ""},
+			wantUnits:       []string{"{count}", "V"},
+			wantEngineering: []string{"[degF]", ""},
+			wantValues:      []float64{100, 50},
+		},
+		{
+			name:        "unknown unit flagged",
+			units:       []string{"furlong", "C"},
+			wantUnits:   []string{"furlong", "Cel"},
+			wantValues:  []float64{100, 50},
+			wantUnknown: []string{"furlong"},
+		},
+		{
+			name:          "unknown unit rejected",
+			rejectUnknown: true,
+			units:         []string{"furlong", "C"},
+			wantErr:       `/unit/0: unknown unit "furlong"`,
+		},
+		{
+			name:    "unknown unit system",
+			source:  staticUnitSystem{system: "si"},
+			units:   []string{"C"},
+			wantErr: `unknown unit system "si"`,
+		},
+		{
+			name:    "registry unavailable",
+			source:  staticUnitSystem{err: errors.New("redis unavailable")},
+			units:   []string{"C"},
+			wantErr: "redis unavailable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engineering := 100.0
+			payload := &domain.GeoKonPayload{
+				Metric:          []string{"a", "b"},
+				Unit:            slices.Clone(tt.units),
+				EngineeringUnit: tt.engineeringUnit,
+				Observations:    []domain.Observation{{Value: []float64{100, 50}, Engineering: []*float64{&engineering, nil}}},
+			}
+			msg := domain.EnrichedMessage{SiteCode: "s1", DataModel: "geokonapi", GeoKon: payload}
+
+			err := NewUnitConversion(tt.source, tt.rejectUnknown).Apply(&msg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Apply error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(payload.Unit, tt.wantUnits) {
+				t.Errorf("units = %q, want %q", payload.Unit, tt.wantUnits)
+			}
+			if !slices.Equal(payload.EngineeringUnit, tt.wantEngineering) {
+				t.Errorf("engineering units = %q, want %q", payload.EngineeringUnit, tt.wantEngineering)
+			}
+			if !slices.Equal(payload.UnknownUnits, tt.wantUnknown) {
+				t.Errorf("unknown units = %q, want %q", payload.UnknownUnits, tt.wantUnknown)
+			}
+			for j, want := range tt.wantValues {
+				if got := payload.Observations[0].Value[j]; math.Abs(got-want) > 1e-6 {
+					t.Errorf("value %d = %g, want %g", j, got, want)
+				}
+			}
+			if tt.wantEngineering != nil && math.Abs(engineering-212) > 1e-9 {
+				t.Errorf("engineering value = %g, want 212", engineering)
+			}
+		})
+	}
+}
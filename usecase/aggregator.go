@@ -0,0 +1,189 @@
+package usecase
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+type windowKey struct {
+	metric string
+	window time.Duration
+	start  time.Time
+}
+
+type openWindow struct {
+	aggregate *domain.Aggregate
+	window    time.Duration
+	updated   time.Time
+}
+
+type deviceWindows struct {
+	watermark time.Time
+	open      map[windowKey]*openWindow
+}
+
+// Aggregator rolls the observations of every device metric up over tumbling windows aligned on the observation
+// timestamps, it is only used from the use case goroutine
+type Aggregator struct {
+	windows  []time.Duration
+	lateness time.Duration
+	router   *TopicRouter
+	devices  map[string]*deviceWindows
+}
+
+// NewAggregator creates an aggregator, a window closes once an observation of the device is lateness past
+// its end, the aggregates are published on the topic router computes suffixed with /<window>
+func NewAggregator(windows []time.Duration, lateness time.Duration, router *TopicRouter) *Aggregator {
+	return &Aggregator{
+		windows:  windows,
+		lateness: lateness,
+		router:   router,
+		devices:  make(map[string]*deviceWindows),
+	}
+}
+
+// Add accounts for the observations of a message and returns the windows it closed and the number of
+// observations dropped because their window already closed
+func (a *Aggregator) Add(msg domain.EnrichedMessage, now time.Time) ([]*domain.Aggregate, int) {
+	var late int
+
+	p := msg.GeoKon
+	if p == nil || len(p.Observations) == 0 {
+		return nil, 0
+	}
+	device := a.devices[msg.DeviceID]
+	if device == nil {
+		device = &deviceWindows{open: make(map[windowKey]*openWindow)}
+		a.devices[msg.DeviceID] = device
+	}
+
+	// The watermark only moves once the message is accounted for, so the observations of a message are never
+	// late because of each other, skewed observations would move it out of reach and are left out
+	watermark := device.watermark
+	for _, o := range p.Observations {
+		if o.Skew != "" {
+			continue
+		}
+		if o.Time.After(watermark) {
+			watermark = o.Time
+		}
+		for j, metric := range p.Metric {
+			value, unit, ok := p.Reading(o, j)
+			if !ok {
+				continue
+			}
+			for _, window := range a.windows {
+				start := o.Time.Truncate(window)
+				if !start.Add(window + a.lateness).After(device.watermark) {
+					late++
+					continue
+				}
+
+				key := windowKey{metric: metric, window: window, start: start}
+				w := device.open[key]
+				if w == nil {
+					w = &openWindow{
+						window: window,
+						aggregate: &domain.Aggregate{
+							DeviceID:  msg.DeviceID,
+							SiteCode:  msg.SiteCode,
+							DataModel: msg.DataModel,
+							Metric:    metric,
+							Unit:      unit,
+							Window:    domain.WindowName(window),
+							Start:     start.UTC(),
+							End:       start.Add(window).UTC(),
+						},
+					}
+					device.open[key] = w
+				}
+				w.aggregate.Add(o.Time, value)
+				w.updated = now
+			}
+		}
+	}
+	device.watermark = watermark
+
+	return a.close(msg.DeviceID, func(w *openWindow) bool {
+		return !w.aggregate.End.Add(a.lateness).After(watermark)
+	}, false), late
+}
+
+// Expired returns the windows of the devices that stopped reporting, a window is closed when it was not
+// updated for its length plus the allowed lateness
+func (a *Aggregator) Expired(now time.Time) []*domain.Aggregate {
+	var closed []*domain.Aggregate
+
+	for _, deviceID := range a.deviceIDs() {
+		closed = append(closed, a.close(deviceID, func(w *openWindow) bool {
+			return now.Sub(w.updated) >= w.window+a.lateness
+		}, false)...)
+	}
+	return closed
+}
+
+// Flush returns every open window marked partial
+func (a *Aggregator) Flush() []*domain.Aggregate {
+	var closed []*domain.Aggregate
+
+	for _, deviceID := range a.deviceIDs() {
+		closed = append(closed, a.close(deviceID, func(*openWindow) bool { return true }, true)...)
+	}
+	return closed
+}
+
+// Topic returns the topic of an aggregate
+func (a *Aggregator) Topic(aggregate *domain.Aggregate) string {
+	msg := domain.EnrichedMessage{DeviceID: aggregate.DeviceID, SiteCode: aggregate.SiteCode, DataModel: aggregate.DataModel}
+	return a.router.Route(msg) + "/" + aggregate.Window
+}
+
+// TickInterval is how often the windows of the silent devices are checked
+func (a *Aggregator) TickInterval() time.Duration {
+	interval := time.Minute
+	for _, window := range a.windows {
+		if window/4 < interval {
+			interval = window / 4
+		}
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// close removes the windows of a device selected by done, ordered by window end, metric and length
+func (a *Aggregator) close(deviceID string, done func(*openWindow) bool, partial bool) []*domain.Aggregate {
+	var closed []*domain.Aggregate
+
+	device := a.devices[deviceID]
+	for key, w := range device.open {
+		if !done(w) {
+			continue
+		}
+		w.aggregate.Partial = partial
+		closed = append(closed, w.aggregate)
+		delete(device.open, key)
+	}
+	sort.Slice(closed, func(i, j int) bool {
+		if !closed[i].End.Equal(closed[j].End) {
+			return closed[i].End.Before(closed[j].End)
+		}
+		if closed[i].Metric != closed[j].Metric {
+			return closed[i].Metric < closed[j].Metric
+		}
+		return closed[i].Start.After(closed[j].Start)
+	})
+	return closed
+}
+
+func (a *Aggregator) deviceIDs() []string {
+	ids := make([]string, 0, len(a.devices))
+	for id := range a.devices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
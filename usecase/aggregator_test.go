@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+func TestAggregator(t *testing.T) {
+	type step struct {
+		add    []reading
+		expire bool
+		flush  bool
+		now    time.Duration
+		want   []string
+	}
+	tests := []struct {
+		name     string
+		windows  []time.Duration
+		steps    []step
+		wantLate int
+	}{
+		{
+			name:    "closed once the watermark is the lateness past the end",
+			windows: []time.Duration{time.Minute},
+			steps: []step{
+				{add: []reading{{0, 1}, {30 * time.Second, 3}}},
+				{add: []reading{{80 * time.Second, 5}}},
+				{add: []reading{{90 * time.Second, 7}}, want: []string{"1m 10:00:00 n=2 mean=2"}},
+			},
+		},
+		{
+			name:    "late observation within the allowed lateness",
+			windows: []time.Duration{time.Minute},
+			steps: []step{
+				{add: []reading{{0, 1}}},
+				{add: []reading{{65 * time.Second, 2}}},
+				{add: []reading{{50 * time.Second, 3}}},
+				{add: []reading{{95 * time.Second, 4}}, want: []string{"1m 10:00:00 n=2 mean=2"}},
+			},
+		},
+		{
+			name:    "too late observation dropped",
+			windows: []time.Duration{time.Minute},
+			steps: []step{
+				{add: []reading{{0, 1}}},
+				{add: []reading{{95 * time.Second, 2}}, want: []string{"1m 10:00:00 n=1 mean=1"}},
+				{add: []reading{{30 * time.Second, 9}}},
+			},
+			wantLate: 1,
+		},
+		{
+			name:    "observations of a message are not late because of each other",
+			windows: []time.Duration{time.Minute},
+			steps: []step{
+				{add: []reading{{100 * time.Second, 1}, {10 * time.Second, 2}}, want: []string{"1m 10:00:00 n=1 mean=2"}},
+			},
+		},
+		{
+			name:    "several windows",
+			windows: []time.Duration{time.Minute, 5 * time.Minute},
+			steps: []step{
+				{add: []reading{{0, 1}, {60 * time.Second, 3}}},
+				{add: []reading{{400 * time.Second, 5}}, want: []string{
+					"1m 10:00:00 n=1 mean=1",
+					"1m 10:01:00 n=1 mean=3",
+					"5m 10:00:00 n=2 mean=2",
+				}},
+			},
+		},
+		{
+			name:    "windows of a silent device expired",
+			windows: []time.Duration{time.Minute},
+			steps: []step{
+				{add: []reading{{0, 1}}},
+				{expire: true, now: 89 * time.Second},
+				{expire: true, now: 90 * time.Second, want: []string{"1m 10:00:00 n=1 mean=1"}},
+			},
+		},
+		{
+			name:    "flushed partial",
+			windows: []time.Duration{time.Minute},
+			steps: []step{
+				{add: []reading{{0, 1}, {10 * time.Second, 2}}},
+				{flush: true, want: []string{"1m 10:00:00 n=2 mean=1.5 partial"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAggregator(tt.windows, 30*time.Second, mustRouter(t, DefaultTopicTemplate))
+			late := 0
+			for i, s := range tt.steps {
+				var closed []*domain.Aggregate
+				now := readingsStart.Add(s.now)
+				switch {
+				case s.expire:
+					closed = a.Expired(now)
+				case s.flush:
+					closed = a.Flush()
+				default:
+					var dropped int
+					closed, dropped = a.Add(readingsMessage(s.add...), now)
+					late += dropped
+				}
+
+				var got []string
+				for _, c := range closed {
+					desc := fmt.Sprintf("%s %s n=%d mean=%g", c.Window, c.Start.Format(time.TimeOnly), c.Count, c.Mean)
+					if c.Partial {
+						desc += " partial"
+					}
+					got = append(got, desc)
+				}
+				if !slices.Equal(got, s.want) {
+					t.Errorf("step %d: closed = %q, want %q", i, got, s.want)
+				}
+			}
+			if late != tt.wantLate {
+				t.Errorf("late = %d, want %d", late, tt.wantLate)
+			}
+		})
+	}
+}
+
+func TestAggregatorTopic(t *testing.T) {
+	a := NewAggregator([]time.Duration{time.Hour}, 0, mustRouter(t, "{base}/{siteCode}/{deviceId}/aggregates"))
+	got := a.Topic(&domain.Aggregate{DeviceID: "d1", SiteCode: "s1", Window: domain.WindowName(time.Hour)})
+	if want := "base/s1/d1/aggregates/1h"; got != want {
+		t.Errorf("Topic = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package usecase
+
+import (
+	"encoding/json"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// DefaultBatchTopicTemplate groups the messages of a site
+const DefaultBatchTopicTemplate = "{base}/{siteCode}/batch"
+
+// BatchOptions sets when a batch is flushed, a zero value disables that limit
+type BatchOptions struct {
+	MaxCount   int
+	MaxBytes   int
+	MaxLatency time.Duration
+}
+
+// BatchEnvelope is the message published for a batch
+type BatchEnvelope struct {
+	Key      string            `json:"key"`
+	Count    int               `json:"count"`
+	Opened   time.Time         `json:"opened"`
+	Closed   time.Time         `json:"closed"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// Batcher groups the enriched messages by the topic its router computes and flushes a group by count,
+// size or age, it is only used from the use case goroutine
+type Batcher struct {
+	opts    BatchOptions
+	router  atomic.Pointer[TopicRouter]
+	batches map[string]*BatchEnvelope
+	sizes   map[string]int
+}
+
+// NewBatcher creates a batcher, the batch key and topic is computed by router
+func NewBatcher(router *TopicRouter, opts BatchOptions) *Batcher {
+	b := &Batcher{
+		opts:    opts,
+		batches: make(map[string]*BatchEnvelope),
+		sizes:   make(map[string]int),
+	}
+	b.router.Store(router)
+	return b
+}
+
+// SetRouter swaps the router computing the batch key of the next messages
+func (b *Batcher) SetRouter(router *TopicRouter) {
+	b.router.Store(router)
+}
+
+// Add queues the documents of a message and returns the batches that are full
+func (b *Batcher) Add(msg domain.EnrichedMessage, docs [][]byte) []*BatchEnvelope {
+	var full []*BatchEnvelope
+
+	key := b.router.Load().Route(msg)
+	for _, doc := range docs {
+		if b.batches[key] != nil && b.opts.MaxBytes > 0 && b.sizes[key]+len(doc) > b.opts.MaxBytes {
+			full = append(full, b.close(key))
+		}
+
+		batch := b.batches[key]
+		if batch == nil {
+			batch = &BatchEnvelope{Key: key, Opened: time.Now().UTC()}
+			b.batches[key] = batch
+		}
+		batch.Messages = append(batch.Messages, doc)
+		batch.Count++
+		b.sizes[key] += len(doc)
+
+		if (b.opts.MaxCount > 0 && batch.Count >= b.opts.MaxCount) || (b.opts.MaxBytes > 0 && b.sizes[key] >= b.opts.MaxBytes) {
+			full = append(full, b.close(key))
+		}
+	}
+	return full
+}
+
+// Expired returns the batches opened more than the max latency ago
+func (b *Batcher) Expired(now time.Time) []*BatchEnvelope {
+	var expired []*BatchEnvelope
+
+	if b.opts.MaxLatency <= 0 {
+		return nil
+	}
+	for _, key := range b.keys() {
+		if now.Sub(b.batches[key].Opened) >= b.opts.MaxLatency {
+			expired = append(expired, b.close(key))
+		}
+	}
+	return expired
+}
+
+// Flush returns every pending batch
+func (b *Batcher) Flush() []*BatchEnvelope {
+	var pending []*BatchEnvelope
+
+	for _, key := range b.keys() {
+		pending = append(pending, b.close(key))
+	}
+	return pending
+}
+
+// TickInterval is how often the batches are checked for the max latency
+func (b *Batcher) TickInterval() time.Duration {
+	interval := b.opts.MaxLatency / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	return interval
+}
+
+func (b *Batcher) close(key string) *BatchEnvelope {
+	batch := b.batches[key]
+	batch.Closed = time.Now().UTC()
+	delete(b.batches, key)
+	delete(b.sizes, key)
+	return batch
+}
+
+func (b *Batcher) keys() []string {
+	keys := make([]string, 0, len(b.batches))
+	for key := range b.batches {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
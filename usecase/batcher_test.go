@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+func TestBatcherAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		opts BatchOptions
+		// messages are added in order, one document per site
+		sites []string
+		doc   string
+		// full are the keys and counts of the batches returned full, in order
+		full    []string
+		counts  []int
+		pending int
+	}{
+		{
+			name:    "no limit",
+			opts:    BatchOptions{},
+			sites:   []string{"s1", "s1", "s2"},
+			doc:     "{}",
+			pending: 2,
+		},
+		{
+			name:    "max count",
+			opts:    BatchOptions{MaxCount: 2},
+			sites:   []string{"s1", "s2", "s1", "s1"},
+			doc:     "{}",
+			full:    []string{"base/s1/batch"},
+			counts:  []int{2},
+			pending: 2,
+		},
+		{
+			name:    "max bytes closes the batch before it overflows",
+			opts:    BatchOptions{MaxBytes: 10},
+			sites:   []string{"s1", "s1", "s1"},
+			doc:     `{"a":1}`,
+			full:    []string{"base/s1/batch", "base/s1/batch"},
+			counts:  []int{1, 1},
+			pending: 1,
+		},
+		{
+			name:    "max bytes reached exactly",
+			opts:    BatchOptions{MaxBytes: 4},
+			sites:   []string{"s1", "s1"},
+			doc:     "{}",
+			full:    []string{"base/s1/batch"},
+			counts:  []int{2},
+			pending: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBatcher(mustRouter(t, DefaultBatchTopicTemplate), tt.opts)
+
+			var full []*BatchEnvelope
+			for _, site := range tt.sites {
+				full = append(full, b.Add(domain.EnrichedMessage{SiteCode: site}, [][]byte{[]byte(tt.doc)})...)
+			}
+			if len(full) != len(tt.full) {
+				t.Fatalf("%d batches full, want %d", len(full), len(tt.full))
+			}
+			for i, batch := range full {
+				if batch.Key != tt.full[i] || batch.Count != tt.counts[i] || len(batch.Messages) != batch.Count {
+					t.Errorf("batch %d = %s with %d messages, want %s with %d", i, batch.Key, batch.Count, tt.full[i], tt.counts[i])
+				}
+			}
+			if got := len(b.Flush()); got != tt.pending {
+				t.Errorf("%d batches pending, want %d", got, tt.pending)
+			}
+			if got := len(b.Flush()); got != 0 {
+				t.Errorf("%d batches pending after a flush", got)
+			}
+		})
+	}
+}
+
+func TestBatcherExpired(t *testing.T) {
+	tests := []struct {
+		name    string
+		latency time.Duration
+		after   time.Duration
+		want    int
+	}{
+		{name: "no max latency", latency: 0, after: time.Hour, want: 0},
+		{name: "not expired", latency: time.Minute, after: time.Second, want: 0},
+		{name: "expired", latency: time.Minute, after: time.Minute, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBatcher(mustRouter(t, DefaultBatchTopicTemplate), BatchOptions{MaxLatency: tt.latency})
+			b.Add(domain.EnrichedMessage{SiteCode: "s2"}, [][]byte{[]byte("{}")})
+			b.Add(domain.EnrichedMessage{SiteCode: "s1"}, [][]byte{[]byte("{}")})
+
+			expired := b.Expired(time.Now().UTC().Add(tt.after))
+			if len(expired) != tt.want {
+				t.Fatalf("%d batches expired, want %d", len(expired), tt.want)
+			}
+			if tt.want == 2 && (expired[0].Key != "base/s1/batch" || expired[1].Key != "base/s2/batch") {
+				t.Errorf("expired %s, %s, want the keys in order", expired[0].Key, expired[1].Key)
+			}
+		})
+	}
+}
+
+func TestBatcherSetRouter(t *testing.T) {
+	b := NewBatcher(mustRouter(t, DefaultBatchTopicTemplate), BatchOptions{})
+	b.Add(domain.EnrichedMessage{SiteCode: "s1"}, [][]byte{[]byte("{}")})
+	b.SetRouter(mustRouter(t, "{base}/{siteCode}/other"))
+	b.Add(domain.EnrichedMessage{SiteCode: "s1"}, [][]byte{[]byte("{}")})
+
+	pending := b.Flush()
+	if len(pending) != 2 || pending[0].Key != "base/s1/batch" || pending[1].Key != "base/s1/other" {
+		t.Errorf("batches after the router swap = %v", pending)
+	}
+}
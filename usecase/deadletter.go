@@ -0,0 +1,37 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/service"
+)
+
+// DeadLetter is published on the dead-letter topic for every message that is rejected
+type DeadLetter struct {
+	Time       time.Time                 `json:"time"`
+	Reason     string                    `json:"reason"`
+	Error      string                    `json:"error"`
+	Violations []service.SchemaViolation `json:"violations,omitempty"`
+	Message    json.RawMessage           `json:"message"`
+}
+
+// newDeadLetter wraps the rejected message, a message that is not valid JSON is kept as a JSON string
+func newDeadLetter(reason string, err error, msg []byte) DeadLetter {
+	letter := DeadLetter{
+		Time:    time.Now().UTC(),
+		Reason:  reason,
+		Error:   err.Error(),
+		Message: msg,
+	}
+	if !json.Valid(msg) {
+		letter.Message, _ = json.Marshal(string(msg))
+	}
+
+	var schemaErr *service.ErrSchemaValidation
+	if errors.As(err, &schemaErr) {
+		letter.Violations = schemaErr.Violations
+	}
+	return letter
+}
@@ -0,0 +1,146 @@
+package usecase
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/service"
+)
+
+// Failure reasons reported by the use case
+const (
+	ReasonChannelFull     = "channel_full"
+	ReasonInvalidFormat   = "invalid_format"
+	ReasonRepositoryError = "repository_error"
+	ReasonEnrichmentError = "enrichment_error"
+	ReasonNotGeoKonAPI    = "not_geokonapi"
+	ReasonSchemaViolation = "schema_violation"
+	ReasonInvalidPayload  = "invalid_payload"
+	ReasonTransformError  = "transform_error"
+	ReasonDuplicate       = "duplicate"
+	ReasonClockSkew       = "clock_skew"
+	ReasonSchemaError     = "schema_unavailable"
+	ReasonSchemaLoadError = "schema_load_error"
+	ReasonEncodingError   = "encoding_error"
+	ReasonNoObservations  = "no_observations"
+	ReasonPublishError    = "publish_error"
+	ReasonRuleError       = "rule_error"
+	ReasonAlertError      = "alert_error"
+	ReasonLivenessError   = "liveness_error"
+	ReasonAnomalyError    = "anomaly_error"
+	ReasonUnknown         = "unknown"
+)
+
+// Failure is a single message that could not be processed
+type Failure struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+	Error  string    `json:"error"`
+}
+
+// FailureReport is a point in time view of the failures seen since startup
+type FailureReport struct {
+	Counts map[string]int       `json:"counts"`
+	Recent map[string][]Failure `json:"recent"`
+}
+
+// FailureTracker keeps a count per reason and the most recent failures for each reason
+type FailureTracker struct {
+	mu     sync.Mutex
+	size   int
+	counts map[string]int
+	recent map[string][]Failure
+}
+
+// NewFailureTracker creates a tracker retaining up to size failures per reason
+func NewFailureTracker(size int) *FailureTracker {
+	if size <= 0 {
+		size = 1
+	}
+	return &FailureTracker{
+		size:   size,
+		counts: make(map[string]int),
+		recent: make(map[string][]Failure),
+	}
+}
+
+// Record stores a failure under the given reason
+func (f *FailureTracker) Record(reason string, err error) {
+	failure := Failure{Time: time.Now(), Reason: reason}
+	if err != nil {
+		failure.Error = err.Error()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.counts[reason]++
+	recent := append(f.recent[reason], failure)
+	if len(recent) > f.size {
+		recent = recent[len(recent)-f.size:]
+	}
+	f.recent[reason] = recent
+}
+
+// Report returns a copy of the tracked failures
+func (f *FailureTracker) Report() FailureReport {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	report := FailureReport{
+		Counts: make(map[string]int, len(f.counts)),
+		Recent: make(map[string][]Failure, len(f.recent)),
+	}
+	for reason, count := range f.counts {
+		report.Counts[reason] = count
+	}
+	for reason, failures := range f.recent {
+		report.Recent[reason] = append([]Failure(nil), failures...)
+	}
+	return report
+}
+
+// failureReason maps a processing error to the reason it is reported under
+func failureReason(err error) string {
+	var (
+		geoKonErr     *service.ErrNotGeoKonAPIData
+		formatErr     *service.ErrInvalidFormat
+		repositoryErr *service.ErrRepository
+		enrichmentErr *service.ErrEnrichment
+		schemaErr     *service.ErrSchemaValidation
+		schemaLoadErr *service.ErrSchemaLoad
+		schemaUnavail *service.ErrSchemaUnavailable
+		payloadErr    *service.ErrInvalidPayload
+		transformErr  *service.ErrTransform
+		duplicateErr  *service.ErrDuplicate
+		skewErr       *service.ErrClockSkew
+	)
+
+	switch {
+	case errors.As(err, &geoKonErr):
+		return ReasonNotGeoKonAPI
+	case errors.As(err, &formatErr):
+		return ReasonInvalidFormat
+	case errors.As(err, &repositoryErr):
+		return ReasonRepositoryError
+	case errors.As(err, &enrichmentErr):
+		return ReasonEnrichmentError
+	case errors.As(err, &schemaErr):
+		return ReasonSchemaViolation
+	case errors.As(err, &schemaLoadErr):
+		return ReasonSchemaLoadError
+	case errors.As(err, &schemaUnavail):
+		return ReasonSchemaError
+	case errors.As(err, &payloadErr):
+		return ReasonInvalidPayload
+	case errors.As(err, &transformErr):
+		return ReasonTransformError
+	case errors.As(err, &duplicateErr):
+		return ReasonDuplicate
+	case errors.As(err, &skewErr):
+		return ReasonClockSkew
+	default:
+		return ReasonUnknown
+	}
+}
@@ -0,0 +1,30 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Go-routine-4595/DataEnricher/service"
+)
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: &service.ErrInvalidFormat{Err: errors.New("eof")}, want: ReasonInvalidFormat},
+		{err: &service.ErrRepository{DeviceID: "d1", Err: errors.New("timeout")}, want: ReasonRepositoryError},
+		{err: &service.ErrSchemaValidation{DeviceID: "d1"}, want: ReasonSchemaViolation},
+		{err: &service.ErrSchemaLoad{DataModel: "geokonapi", Attempts: 3, Err: errors.New("timeout")}, want: ReasonSchemaLoadError},
+		{err: &service.ErrSchemaUnavailable{DataModel: "geokonapi", Err: errors.New("invalid schema")}, want: ReasonSchemaError},
+		{err: &service.ErrInvalidPayload{DeviceID: "d1", Err: errors.New("null value")}, want: ReasonInvalidPayload},
+		{err: fmt.Errorf("wrapped: %w", &service.ErrDuplicate{}), want: ReasonDuplicate},
+		{err: errors.New("other"), want: ReasonUnknown},
+	}
+	for _, tt := range tests {
+		if got := failureReason(tt.err); got != tt.want {
+			t.Errorf("failureReason(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package usecase
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// readingsStart is the time the readings of readingsMessage are offset from
+var readingsStart = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+// reading is a value of metric t observed at readingsStart + at
+type reading struct {
+	at    time.Duration
+	value float64
+}
+
+// readingsMessage is a message of device d1 of site s1 with one observation of metric t in C per reading
+func readingsMessage(readings ...reading) domain.EnrichedMessage {
+	payload := &domain.GeoKonPayload{SerialID: "d1", Metric: []string{"t"}, Unit: []string{"C"}}
+	for _, r := range readings {
+		payload.Observations = append(payload.Observations, domain.Observation{Time: readingsStart.Add(r.at), Value: []float64{r.value}})
+	}
+	return domain.EnrichedMessage{
+		DeviceID:  "d1",
+		SiteCode:  "s1",
+		DataModel: "geokonapi",
+		Data:      json.RawMessage(`{}`),
+		GeoKon:    payload,
+	}
+}
+
+// mustRouter is the router of template with base "base"
+func mustRouter(t *testing.T, template string) *TopicRouter {
+	t.Helper()
+
+	router, err := NewTopicRouter("base", template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
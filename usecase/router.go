@@ -0,0 +1,58 @@
+package usecase
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// DefaultTopicTemplate publishes to <base>/<siteCode>/<deviceId>
+const DefaultTopicTemplate = "{base}/{siteCode}/{deviceId}"
+
+var placeholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+var placeholders = map[string]bool{
+	"{base}":      true,
+	"{siteCode}":  true,
+	"{deviceId}":  true,
+	"{dataModel}": true,
+}
+
+// TopicRouter computes the publish topic of an enriched message from a template
+type TopicRouter struct {
+	base     string
+	template string
+}
+
+// NewTopicRouter creates a router, the template may use {base}, {siteCode}, {deviceId} and {dataModel}
+func NewTopicRouter(base string, template string) (*TopicRouter, error) {
+	if err := ValidateTopicTemplate(template); err != nil {
+		return nil, err
+	}
+	return &TopicRouter{base: base, template: template}, nil
+}
+
+// ValidateTopicTemplate checks the placeholders of a topic template
+func ValidateTopicTemplate(template string) error {
+	for _, p := range placeholder.FindAllString(template, -1) {
+		if !placeholders[p] {
+			return fmt.Errorf("unknown placeholder %s in topic template %q", p, template)
+		}
+	}
+	if strings.ContainsAny(placeholder.ReplaceAllString(template, ""), "{}") {
+		return fmt.Errorf("unbalanced braces in topic template %q", template)
+	}
+	return nil
+}
+
+// Route returns the topic the message is published to
+func (r *TopicRouter) Route(msg domain.EnrichedMessage) string {
+	return strings.NewReplacer(
+		"{base}", r.base,
+		"{siteCode}", msg.SiteCode,
+		"{deviceId}", msg.DeviceID,
+		"{dataModel}", msg.DataModel,
+	).Replace(r.template)
+}
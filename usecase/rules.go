@@ -0,0 +1,232 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"gopkg.in/yaml.v3"
+)
+
+// RuleAction is what a matching rule does with the message
+type RuleAction string
+
+const (
+	// ActionDrop stops the message from being published
+	ActionDrop RuleAction = "drop"
+	// ActionRoute also publishes the message to the topic of the rule
+	ActionRoute RuleAction = "route"
+)
+
+// IRuleSource returns the rule set document, nil when there is none
+type IRuleSource interface {
+	LoadRules() ([]byte, error)
+}
+
+// Rule is a rule as written in the rule set document
+type Rule struct {
+	Name   string     `yaml:"name"`
+	When   string     `yaml:"when"`
+	Action RuleAction `yaml:"action"`
+	Topic  string     `yaml:"topic"`
+}
+
+type compiledRule struct {
+	Rule
+	program *vm.Program
+	router  *TopicRouter
+}
+
+// RuleSet is an ordered list of compiled rules
+type RuleSet struct {
+	rules []compiledRule
+}
+
+// RuleMatch is the outcome of one rule for a message
+type RuleMatch struct {
+	Rule    string
+	Matched bool
+	Topic   string
+	Err     error
+}
+
+// RuleResult is the outcome of a rule set for a message, Drop names the rule that dropped it
+type RuleResult struct {
+	Drop    string
+	Routes  []string
+	Matches []RuleMatch
+}
+
+// ruleEnv declares the variables rules can use
+var ruleEnv = map[string]any{
+	"deviceId":    "",
+	"siteCode":    "",
+	"dataModel":   "",
+	"sourceTopic": "",
+	"registry":    map[string]any{},
+	"payload":     map[string]any{},
+	"fields":      map[string]any{},
+	"value":       map[string]float64{},
+	"values":      map[string][]float64{},
+}
+
+// LoadRules reads and compiles the rule set of source, route topics are templates like the publish topic
+func LoadRules(source IRuleSource, base string) (*RuleSet, error) {
+	b, err := source.LoadRules()
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(b, base)
+}
+
+// ParseRules compiles a YAML or JSON list of rules
+func ParseRules(b []byte, base string) (*RuleSet, error) {
+	var (
+		rules []Rule
+		errs  []error
+	)
+
+	if len(b) > 0 {
+		err := yaml.Unmarshal(b, &rules)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule set: %w", err)
+		}
+	}
+
+	set := &RuleSet{rules: make([]compiledRule, 0, len(rules))}
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("#%d", i+1)
+		}
+		if names[rule.Name] {
+			errs = append(errs, fmt.Errorf("rule %s: duplicate name", rule.Name))
+		}
+		names[rule.Name] = true
+
+		compiled, err := compileRule(rule, base)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %w", rule.Name, err))
+			continue
+		}
+		set.rules = append(set.rules, compiled)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return set, nil
+}
+
+func compileRule(rule Rule, base string) (compiledRule, error) {
+	var err error
+
+	c := compiledRule{Rule: rule}
+	switch rule.Action {
+	case ActionDrop:
+		if rule.Topic != "" {
+			return c, errors.New("drop rules have no topic")
+		}
+	case ActionRoute:
+		if rule.Topic == "" {
+			return c, errors.New("route rules need a topic")
+		}
+		c.router, err = NewTopicRouter(base, rule.Topic)
+		if err != nil {
+			return c, err
+		}
+	default:
+		return c, fmt.Errorf("unknown action %q, expected drop or route", rule.Action)
+	}
+
+	if rule.When == "" {
+		return c, errors.New("missing when")
+	}
+	c.program, err = expr.Compile(rule.When, expr.Env(ruleEnv), expr.AsBool())
+	if err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// Len returns the number of rules
+func (s *RuleSet) Len() int {
+	return len(s.rules)
+}
+
+// Evaluate runs the rules in order until one drops the message, a rule failing to evaluate does not match
+func (s *RuleSet) Evaluate(msg domain.EnrichedMessage) RuleResult {
+	var result RuleResult
+
+	env := newRuleEnv(msg)
+	for _, rule := range s.rules {
+		match := RuleMatch{Rule: rule.Name}
+		out, err := expr.Run(rule.program, env)
+		if err != nil {
+			match.Err = err
+			result.Matches = append(result.Matches, match)
+			continue
+		}
+		match.Matched, _ = out.(bool)
+		if match.Matched && rule.router != nil {
+			match.Topic = rule.router.Route(msg)
+		}
+		result.Matches = append(result.Matches, match)
+
+		if !match.Matched {
+			continue
+		}
+		if rule.Action == ActionDrop {
+			result.Drop = rule.Name
+			return result
+		}
+		result.Routes = append(result.Routes, match.Topic)
+	}
+	return result
+}
+
+func newRuleEnv(msg domain.EnrichedMessage) map[string]any {
+	env := map[string]any{
+		"deviceId":    msg.DeviceID,
+		"siteCode":    msg.SiteCode,
+		"dataModel":   msg.DataModel,
+		"sourceTopic": msg.SourceTopic,
+		"registry":    decodeObject(msg.RegistryRaw),
+		"payload":     decodeObject(msg.Data),
+		"value":       map[string]float64{},
+		"values":      map[string][]float64{},
+	}
+
+	fields := make(map[string]any, len(msg.Fields))
+	for name, raw := range msg.Fields {
+		var v any
+		if json.Unmarshal(raw, &v) == nil {
+			fields[name] = v
+		}
+	}
+	env["fields"] = fields
+
+	if p := msg.GeoKon; p != nil {
+		value := make(map[string]float64, len(p.Metric))
+		values := make(map[string][]float64, len(p.Metric))
+		for _, metric := range p.Metric {
+			values[metric] = p.Values(metric)
+			if n := len(values[metric]); n > 0 {
+				value[metric] = values[metric][n-1]
+			}
+		}
+		env["value"] = value
+		env["values"] = values
+	}
+	return env
+}
+
+func decodeObject(raw json.RawMessage) map[string]any {
+	object := map[string]any{}
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &object)
+	}
+	return object
+}
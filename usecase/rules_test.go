@@ -0,0 +1,179 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+	"github.com/rs/zerolog"
+)
+
+// ruleDocument is a rule source serving a document the test changes between reloads
+type ruleDocument struct {
+	doc string
+	err error
+}
+
+func (r *ruleDocument) LoadRules() ([]byte, error) {
+	return []byte(r.doc), r.err
+}
+
+// siteMessage is the readings message of a site with a registry in zone north
+func siteMessage(site string, readings ...reading) domain.EnrichedMessage {
+	msg := readingsMessage(readings...)
+	msg.SiteCode = site
+	msg.RegistryRaw = json.RawMessage(`{"zone":"north"}`)
+	return msg
+}
+
+func TestRuleSetEvaluate(t *testing.T) {
+	const rules = `
+- name: drop-test-site
+  when: siteCode == "test"
+  action: drop
+- name: hot
+  when: value.t > 30
+  action: route
+  topic: "{base}/hot/{deviceId}"
+- name: north
+  when: registry.zone == "north"
+  action: route
+  topic: "{base}/north/{siteCode}"
+`
+	tests := []struct {
+		name       string
+		msg        domain.EnrichedMessage
+		wantDrop   string
+		wantRoutes []string
+	}{
+		{
+			name:     "dropped before the routes",
+			msg:      siteMessage("test", reading{value: 40}),
+			wantDrop: "drop-test-site",
+		},
+		{
+			name:       "every matching route",
+			msg:        siteMessage("s1", reading{value: 20}, reading{time.Minute, 40}),
+			wantRoutes: []string{"base/hot/d1", "base/north/s1"},
+		},
+		{
+			name:       "last value only",
+			msg:        siteMessage("s1", reading{value: 40}, reading{time.Minute, 20}),
+			wantRoutes: []string{"base/north/s1"},
+		},
+		{
+			name:       "without readings",
+			msg:        siteMessage("s1"),
+			wantRoutes: []string{"base/north/s1"},
+		},
+	}
+	set, err := ParseRules([]byte(rules), "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := set.Evaluate(tt.msg)
+			if result.Drop != tt.wantDrop || !slices.Equal(result.Routes, tt.wantRoutes) {
+				t.Errorf("Evaluate = drop %q routes %v, want drop %q routes %v", result.Drop, result.Routes, tt.wantDrop, tt.wantRoutes)
+			}
+		})
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{name: "invalid document", rules: `{`, want: "invalid rule set"},
+		{name: "unknown action", rules: `[{name: a, when: "true", action: copy}]`, want: `unknown action "copy"`},
+		{name: "route without topic", rules: `[{name: a, when: "true", action: route}]`, want: "need a topic"},
+		{name: "drop with topic", rules: `[{name: a, when: "true", action: drop, topic: x}]`, want: "no topic"},
+		{name: "unknown placeholder", rules: `[{name: a, when: "true", action: route, topic: "{base}/{zone}"}]`, want: "unknown placeholder {zone}"},
+		{name: "not a condition", rules: `[{name: a, when: "siteCode", action: drop}]`, want: "rule a:"},
+		{name: "duplicate name", rules: `[{name: a, when: "true", action: drop}, {name: a, when: "false", action: drop}]`, want: "duplicate name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRules([]byte(tt.rules), "base")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseRules error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReloadRules(t *testing.T) {
+	source := &ruleDocument{doc: `[{name: drop-s1, when: 'siteCode == "s1"', action: drop}]`}
+	rules, err := LoadRules(source, "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zerolog.Nop()
+	u := NewUseCase(nil, nil, nil, "base", &logger).WithRules(source, rules)
+
+	tests := []struct {
+		name      string
+		doc       string
+		sourceErr error
+		wantCount int
+		wantErr   bool
+		// wantDrop is whether the rules in effect after the reload drop a message of site s1
+		wantDrop bool
+	}{
+		{
+			name:      "unchanged",
+			doc:       source.doc,
+			wantCount: 1,
+			wantDrop:  true,
+		},
+		{
+			name:      "new rules",
+			doc:       `[{name: hot, when: "value.t > 30", action: route, topic: "{base}/hot"}, {name: drop-s2, when: 'siteCode == "s2"', action: drop}]`,
+			wantCount: 2,
+		},
+		{
+			name:    "invalid rules keep the current ones",
+			doc:     `[{name: a, when: "true", action: copy}]`,
+			wantErr: true,
+		},
+		{
+			name:      "source unavailable keeps the current ones",
+			sourceErr: errors.New("redis unavailable"),
+			wantErr:   true,
+		},
+		{
+			name:      "empty rule set",
+			doc:       ``,
+			wantCount: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source.doc, source.err = tt.doc, tt.sourceErr
+			count, err := u.ReloadRules()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReloadRules error = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && count != tt.wantCount {
+				t.Errorf("ReloadRules = %d, want %d", count, tt.wantCount)
+			}
+			if _, drop := u.applyRules(siteMessage("s1", reading{value: 20})); drop != tt.wantDrop {
+				t.Errorf("dropped = %t, want %t", drop, tt.wantDrop)
+			}
+		})
+	}
+}
+
+func TestReloadRulesWithoutSource(t *testing.T) {
+	logger := zerolog.Nop()
+	if _, err := NewUseCase(nil, nil, nil, "base", &logger).ReloadRules(); err == nil {
+		t.Error("ReloadRules without a rule source did not fail")
+	}
+}
@@ -0,0 +1,107 @@
+package usecase
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+// OutputShape is the layout of the published messages
+type OutputShape string
+
+const (
+	// ShapeEnriched publishes the inbound message with the registry attached
+	ShapeEnriched OutputShape = "enriched"
+	// ShapeRecords publishes one array holding a metric record per value of every observation
+	ShapeRecords OutputShape = "records"
+	// ShapeObservation publishes one array of metric records per observation
+	ShapeObservation OutputShape = "observation"
+)
+
+// ParseOutputShape checks an output shape name
+func ParseOutputShape(shape string) (OutputShape, error) {
+	switch OutputShape(shape) {
+	case ShapeEnriched, ShapeRecords, ShapeObservation:
+		return OutputShape(shape), nil
+	default:
+		return "", fmt.Errorf("unknown output shape %q, expected enriched, records or observation", shape)
+	}
+}
+
+// Shaper encodes enriched messages in the output shape of their data model
+type Shaper struct {
+	defaultShape OutputShape
+	shapes       map[string]OutputShape
+}
+
+// NewShaper creates a shaper using defaultShape for the data models missing from shapes
+func NewShaper(defaultShape string, shapes map[string]string) (*Shaper, error) {
+	def, err := ParseOutputShape(defaultShape)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Shaper{defaultShape: def, shapes: make(map[string]OutputShape, len(shapes))}
+	for dataModel, shape := range shapes {
+		parsed, err := ParseOutputShape(shape)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", dataModel, err)
+		}
+		s.shapes[dataModel] = parsed
+	}
+	return s, nil
+}
+
+// Shape returns the output shape of a data model
+func (s *Shaper) Shape(dataModel string) OutputShape {
+	if shape, ok := s.shapes[dataModel]; ok {
+		return shape
+	}
+	return s.defaultShape
+}
+
+// published returns the output shape an enriched message is published in, messages whose payload was not
+// parsed are always published enriched
+func (s *Shaper) published(msg domain.EnrichedMessage) OutputShape {
+	if msg.GeoKon == nil {
+		return ShapeEnriched
+	}
+	return s.Shape(msg.DataModel)
+}
+
+// MessageType returns the message type of the messages published for an enriched message
+func (s *Shaper) MessageType(msg domain.EnrichedMessage) string {
+	if s.published(msg) == ShapeEnriched {
+		return MessageEnriched
+	}
+	return MessageRecords
+}
+
+// Encode returns the messages to publish for an enriched message
+func (s *Shaper) Encode(msg domain.EnrichedMessage) ([][]byte, error) {
+	switch s.published(msg) {
+	case ShapeRecords:
+		b, err := json.Marshal(msg.MetricRecords())
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{b}, nil
+	case ShapeObservation:
+		messages := make([][]byte, 0, len(msg.GeoKon.Observations))
+		for i := range msg.GeoKon.Observations {
+			b, err := json.Marshal(msg.ObservationRecords(i))
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, b)
+		}
+		return messages, nil
+	default:
+		b, err := msg.Byte()
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{b}, nil
+	}
+}
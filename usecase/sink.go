@@ -0,0 +1,112 @@
+package usecase
+
+import "errors"
+
+// Sinks the published messages are encoded for
+const (
+	SinkEnriched   = "enriched"
+	SinkDeadLetter = "dead_letter"
+	SinkAlert      = "alert"
+	SinkLiveness   = "liveness"
+	SinkAggregate  = "aggregate"
+	SinkSummary    = "summary"
+	SinkGap        = "gap"
+	SinkAnomaly    = "anomaly"
+)
+
+// Message types of the published documents, the encoders with a schema per message type, Avro and protobuf,
+// write each document with the schema of its type
+const (
+	MessageEnriched     = "EnrichedMessage"
+	MessageRecords      = "MetricRecords"
+	MessageBatch        = "BatchEnvelope"
+	MessageDeadLetter   = "DeadLetter"
+	MessageAlert        = "Alert"
+	MessageDeviceStatus = "DeviceStatus"
+	MessageAggregate    = "Aggregate"
+	MessageSiteSummary  = "SiteSummary"
+	MessageGap          = "Gap"
+	MessageAnomaly      = "Anomaly"
+)
+
+// IEncoder converts the JSON messages of a sink to its wire format, messageType is one of the Message constants
+type IEncoder interface {
+	Name() string
+	Encode(messageType string, doc []byte) ([]byte, error)
+}
+
+// ICompressor compresses the encoded messages, it reports whether the message was compressed
+type ICompressor interface {
+	Name() string
+	Compress(b []byte) ([]byte, bool, error)
+}
+
+// outMessage is an encoded message and the topic it is published on
+type outMessage struct {
+	topic   string
+	payload []byte
+}
+
+// WithEncoder encodes the messages of a sink with encoder, messages not encoded as JSON are published on the
+// sink topic suffixed with /<encoder name> so consumers know the content type
+func (u *UseCase) WithEncoder(sink string, encoder IEncoder) *UseCase {
+	if u.encoders == nil {
+		u.encoders = make(map[string]IEncoder)
+	}
+	u.encoders[sink] = encoder
+	return u
+}
+
+// WithCompression compresses the encoded messages of every sink, every message, compressed or below the
+// compressor threshold, is published on the sink topic suffixed with /<encoding>+<compression>, e.g. /json+gzip,
+// so a stream is not split across two topics, compressed messages are told apart by their magic bytes
+func (u *UseCase) WithCompression(compressor ICompressor) *UseCase {
+	u.compressor = compressor
+	return u
+}
+
+// encode converts the JSON documents of a message type for a sink to the messages to publish
+func (u *UseCase) encode(sink string, messageType string, topic string, docs [][]byte) ([]outMessage, error) {
+	encoding := "json"
+	encoder, ok := u.encoders[sink]
+	if ok {
+		encoding = encoder.Name()
+	}
+
+	messages := make([]outMessage, len(docs))
+	for i, doc := range docs {
+		msg := outMessage{topic: topic, payload: doc}
+		if encoding != "json" {
+			b, err := encoder.Encode(messageType, doc)
+			if err != nil {
+				return nil, err
+			}
+			msg = outMessage{topic: topic + "/" + encoding, payload: b}
+		}
+		if u.compressor != nil {
+			b, _, err := u.compressor.Compress(msg.payload)
+			if err != nil {
+				return nil, err
+			}
+			msg = outMessage{topic: topic + "/" + encoding + "+" + u.compressor.Name(), payload: b}
+		}
+		messages[i] = msg
+	}
+	return messages, nil
+}
+
+// publish publishes every message and returns the errors of those that were lost
+func (u *UseCase) publish(messages []outMessage) error {
+	var errs []error
+	for _, msg := range messages {
+		if u.publishMessage == nil {
+			u.mockPublishMessage(msg.payload, msg.topic)
+			continue
+		}
+		err := u.publishMessage.PublishMessage(msg.payload, msg.topic)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
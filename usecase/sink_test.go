@@ -0,0 +1,163 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+	"github.com/Go-routine-4595/DataEnricher/internal/encoding"
+)
+
+type upperEncoder struct{}
+
+func (upperEncoder) Name() string { return "upper" }
+
+func (upperEncoder) Encode(_ string, doc []byte) ([]byte, error) { return bytes.ToUpper(doc), nil }
+
+// prefixCompressor "compresses" the messages of at least threshold bytes by prefixing them with z:
+type prefixCompressor struct {
+	threshold int
+}
+
+func (prefixCompressor) Name() string { return "z" }
+
+func (c prefixCompressor) Compress(b []byte) ([]byte, bool, error) {
+	if len(b) < c.threshold {
+		return b, false, nil
+	}
+	return append([]byte("z:"), b...), true, nil
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name       string
+		encoder    IEncoder
+		compressor ICompressor
+		docs       []string
+		topics     []string
+		payloads   []string
+	}{
+		{
+			name:     "json",
+			docs:     []string{"ab"},
+			topics:   []string{"t"},
+			payloads: []string{"ab"},
+		},
+		{
+			name:     "encoded",
+			encoder:  upperEncoder{},
+			docs:     []string{"ab"},
+			topics:   []string{"t/upper"},
+			payloads: []string{"AB"},
+		},
+		{
+			name:       "compressed and below the threshold share the topic",
+			compressor: prefixCompressor{threshold: 3},
+			docs:       []string{"ab", "abcd"},
+			topics:     []string{"t/json+z", "t/json+z"},
+			payloads:   []string{"ab", "z:abcd"},
+		},
+		{
+			name:       "encoded and compressed",
+			encoder:    upperEncoder{},
+			compressor: prefixCompressor{},
+			docs:       []string{"ab"},
+			topics:     []string{"t/upper+z"},
+			payloads:   []string{"z:AB"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newTestUseCase(nil)
+			if tt.encoder != nil {
+				u.WithEncoder(SinkEnriched, tt.encoder)
+			}
+			if tt.compressor != nil {
+				u.WithCompression(tt.compressor)
+			}
+
+			docs := make([][]byte, len(tt.docs))
+			for i, doc := range tt.docs {
+				docs[i] = []byte(doc)
+			}
+			messages, err := u.encode(SinkEnriched, MessageEnriched, "t", docs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, msg := range messages {
+				if msg.topic != tt.topics[i] || string(msg.payload) != tt.payloads[i] {
+					t.Errorf("message %d = %s on %s, want %s on %s", i, msg.payload, msg.topic, tt.payloads[i], tt.topics[i])
+				}
+			}
+		})
+	}
+}
+
+// TestMessageTypes checks the published documents match the typed schemas of the Avro and protobuf encoders,
+// the protobuf encoder rejects the members missing from the schema
+func TestMessageTypes(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	value := 1.5
+	enriched := domain.EnrichedMessage{
+		SourceTopic: "in",
+		DeviceID:    "d1",
+		SiteCode:    "s1",
+		Data:        json.RawMessage(`{"serialId":"d1"}`),
+		RegistryRaw: json.RawMessage(`{"siteCode":"s1"}`),
+		DataModel:   "geokonapi",
+		Fields:      map[string]json.RawMessage{"zone": json.RawMessage(`"north"`)},
+		IngestTime:  now,
+		LatencyMs:   value,
+	}
+	record := domain.MetricRecord{
+		Time: now, Metric: "t", Unit: "C", Value: value, SiteCode: "s1", DeviceID: "d1",
+		EngineeringValue: &value, EngineeringUnit: "F", CalibrationVersion: "v1", Skew: "future", Sequence: "late", AnomalyScore: &value,
+	}
+
+	tests := []struct {
+		messageType string
+		doc         any
+	}{
+		{messageType: MessageRecords, doc: []domain.MetricRecord{record}},
+		{messageType: MessageBatch, doc: BatchEnvelope{Key: "k", Count: 1, Opened: now, Closed: now, Messages: []json.RawMessage{json.RawMessage(`{"a":1}`)}}},
+		{messageType: MessageDeadLetter, doc: newDeadLetter(ReasonEncodingError, errors.New("failed"), []byte(`{"a":1}`))},
+		{messageType: MessageAlert, doc: domain.Alert{Event: "raised", Time: now, DeviceID: "d1", Value: value, Threshold: &value}},
+		{messageType: MessageDeviceStatus, doc: domain.DeviceStatus{Event: "stale", Time: now, DeviceID: "d1", LastSeen: now}},
+		{messageType: MessageAggregate, doc: domain.Aggregate{DeviceID: "d1", Start: now, End: now, Count: 2, LastTime: now, Partial: true}},
+		{messageType: MessageSiteSummary, doc: domain.SiteSummary{SiteCode: "s1", PeriodStart: now, PeriodEnd: now, Devices: map[string]domain.DeviceLatest{
+			"d1": {LastSeen: now, Time: now, Values: map[string]float64{"t": value}, Units: map[string]string{"t": "C"}},
+		}}},
+		{messageType: MessageGap, doc: domain.Gap{DeviceID: "d1", From: now, To: now, GapSeconds: value, MissedReports: 2}},
+		{messageType: MessageAnomaly, doc: domain.Anomaly{Kind: "zscore", Time: now, DeviceID: "d1", Value: value, Rate: &value}},
+	}
+	b, err := enriched.Byte()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoders := make([]encoding.Encoder, 0, 2)
+	for _, name := range []string{encoding.Avro, encoding.Protobuf} {
+		encoder, err := encoding.New(name, encoding.Options{AvroSchemaID: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoders = append(encoders, encoder)
+	}
+	for _, encoder := range encoders {
+		if _, err := encoder.Encode(MessageEnriched, b); err != nil {
+			t.Errorf("%s: %s: %v", encoder.Name(), MessageEnriched, err)
+		}
+		for _, tt := range tests {
+			b, err := json.Marshal(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := encoder.Encode(tt.messageType, b); err != nil {
+				t.Errorf("%s: %s: %v", encoder.Name(), tt.messageType, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package usecase
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+)
+
+type siteActivity struct {
+	messages int
+	errors   int
+	devices  map[string]domain.DeviceLatest
+}
+
+// Summarizer keeps the activity of every site between two summaries, it is only used from the use case
+// goroutine
+type Summarizer struct {
+	interval time.Duration
+	active   time.Duration
+	router   *TopicRouter
+	since    time.Time
+	sites    map[string]*siteActivity
+}
+
+// NewSummarizer creates a summarizer publishing every interval on the topic router computes, a device is
+// active until it has not reported for the active window
+func NewSummarizer(interval, active time.Duration, router *TopicRouter) *Summarizer {
+	return &Summarizer{
+		interval: interval,
+		active:   active,
+		router:   router,
+		since:    time.Now().UTC(),
+		sites:    make(map[string]*siteActivity),
+	}
+}
+
+// Record accounts for a message enriched successfully
+func (s *Summarizer) Record(msg domain.EnrichedMessage, now time.Time) {
+	site := s.site(msg.SiteCode)
+	site.messages++
+
+	latest := site.devices[msg.DeviceID]
+	if msg.GeoKon != nil {
+		observed, ok := msg.GeoKon.Latest()
+		if ok && !observed.Time.Before(latest.Time) {
+			latest = observed
+		}
+	}
+	latest.LastSeen = now.UTC()
+	site.devices[msg.DeviceID] = latest
+}
+
+// RecordError accounts for a message of the site that failed
+func (s *Summarizer) RecordError(siteCode string) {
+	site := s.site(siteCode)
+	site.messages++
+	site.errors++
+}
+
+// Summaries returns the summary of every site since the previous call and starts a new period, the devices
+// past the active window are forgotten and a site without activity is dropped
+func (s *Summarizer) Summaries(now time.Time) []domain.SiteSummary {
+	now = now.UTC()
+	period := now.Sub(s.since).Seconds()
+
+	codes := make([]string, 0, len(s.sites))
+	for code := range s.sites {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	summaries := make([]domain.SiteSummary, 0, len(codes))
+	for _, code := range codes {
+		site := s.sites[code]
+		for deviceID, latest := range site.devices {
+			if now.Sub(latest.LastSeen) >= s.active {
+				delete(site.devices, deviceID)
+			}
+		}
+		if len(site.devices) == 0 && site.messages == 0 {
+			delete(s.sites, code)
+			continue
+		}
+
+		summary := domain.SiteSummary{
+			SiteCode:      code,
+			PeriodStart:   s.since,
+			PeriodEnd:     now,
+			ActiveDevices: len(site.devices),
+			Messages:      site.messages,
+			Errors:        site.errors,
+			Devices:       make(map[string]domain.DeviceLatest, len(site.devices)),
+		}
+		if period > 0 {
+			summary.MessageRate = float64(site.messages) / period
+		}
+		if site.messages > 0 {
+			summary.ErrorRate = float64(site.errors) / float64(site.messages)
+		}
+		for deviceID, latest := range site.devices {
+			summary.Devices[deviceID] = latest
+		}
+		summaries = append(summaries, summary)
+
+		site.messages = 0
+		site.errors = 0
+	}
+	s.since = now
+	return summaries
+}
+
+// Topic returns the topic of the summary of a site
+func (s *Summarizer) Topic(siteCode string) string {
+	return s.router.Route(domain.EnrichedMessage{SiteCode: siteCode})
+}
+
+// TickInterval is how often the summaries are published
+func (s *Summarizer) TickInterval() time.Duration {
+	return s.interval
+}
+
+func (s *Summarizer) site(siteCode string) *siteActivity {
+	site := s.sites[siteCode]
+	if site == nil {
+		site = &siteActivity{devices: make(map[string]domain.DeviceLatest)}
+		s.sites[siteCode] = site
+	}
+	return site
+}
@@ -0,0 +1,146 @@
+package usecase
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummaries(t *testing.T) {
+	// record is a message of device at readingsStart + at, or an error of the site when device is empty
+	type record struct {
+		site   string
+		device string
+		at     time.Duration
+	}
+	type period struct {
+		records []record
+		end     time.Duration
+		want    []string
+	}
+	tests := []struct {
+		name    string
+		periods []period
+	}{
+		{
+			name: "rates over the period",
+			periods: []period{{
+				records: []record{{site: "s1", device: "d1"}, {site: "s1", device: "d2"}, {site: "s1", device: "d1"}, {site: "s1"}},
+				end:     10 * time.Second,
+				want:    []string{"s1 devices=d1,d2 messages=4 errors=1 rate=0.4 errorRate=0.25"},
+			}},
+		},
+		{
+			name: "every site",
+			periods: []period{{
+				records: []record{{site: "s2", device: "d3"}, {site: "s1", device: "d1"}},
+				end:     time.Second,
+				want: []string{
+					"s1 devices=d1 messages=1 errors=0 rate=1 errorRate=0",
+					"s2 devices=d3 messages=1 errors=0 rate=1 errorRate=0",
+				},
+			}},
+		},
+		{
+			name: "counters reset every period, active devices kept",
+			periods: []period{
+				{
+					records: []record{{site: "s1", device: "d1"}, {site: "s1"}},
+					end:     time.Minute,
+					want:    []string{"s1 devices=d1 messages=2 errors=1 rate=0.03333 errorRate=0.5"},
+				},
+				{
+					end:  2 * time.Minute,
+					want: []string{"s1 devices=d1 messages=0 errors=0 rate=0 errorRate=0"},
+				},
+			},
+		},
+		{
+			name: "device past the active window expired",
+			periods: []period{
+				{
+					records: []record{{site: "s1", device: "d1"}, {site: "s1", device: "d2", at: 4 * time.Minute}},
+					end:     5 * time.Minute,
+					want:    []string{"s1 devices=d1,d2 messages=2 errors=0 rate=0.006667 errorRate=0"},
+				},
+				{
+					end:  10 * time.Minute,
+					want: []string{"s1 devices=d2 messages=0 errors=0 rate=0 errorRate=0"},
+				},
+			},
+		},
+		{
+			name: "idle site dropped",
+			periods: []period{
+				{
+					records: []record{{site: "s1", device: "d1"}, {site: "s2"}},
+					end:     time.Minute,
+					want: []string{
+						"s1 devices=d1 messages=1 errors=0 rate=0.01667 errorRate=0",
+						"s2 devices= messages=1 errors=1 rate=0.01667 errorRate=1",
+					},
+				},
+				{
+					end:  2 * time.Minute,
+					want: []string{"s1 devices=d1 messages=0 errors=0 rate=0 errorRate=0"},
+				},
+				{end: 20 * time.Minute},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSummarizer(time.Minute, 10*time.Minute, mustRouter(t, "{base}/{siteCode}/summary"))
+			s.Summaries(readingsStart)
+
+			for i, p := range tt.periods {
+				for _, r := range p.records {
+					if r.device == "" {
+						s.RecordError(r.site)
+						continue
+					}
+					msg := readingsMessage(reading{r.at, 1})
+					msg.SiteCode, msg.DeviceID = r.site, r.device
+					s.Record(msg, readingsStart.Add(r.at))
+				}
+
+				var got []string
+				for _, summary := range s.Summaries(readingsStart.Add(p.end)) {
+					devices := slices.Sorted(maps.Keys(summary.Devices))
+					if len(devices) != summary.ActiveDevices {
+						t.Errorf("period %d: %d active devices, want %d", i, summary.ActiveDevices, len(devices))
+					}
+					got = append(got, fmt.Sprintf("%s devices=%s messages=%d errors=%d rate=%.4g errorRate=%.4g",
+						summary.SiteCode, strings.Join(devices, ","), summary.Messages, summary.Errors, summary.MessageRate, summary.ErrorRate))
+				}
+				if !slices.Equal(got, p.want) {
+					t.Errorf("period %d: summaries = %q, want %q", i, got, p.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSummarizerLatest(t *testing.T) {
+	s := NewSummarizer(time.Minute, time.Hour, mustRouter(t, "{base}/{siteCode}/summary"))
+	s.Summaries(readingsStart)
+
+	// A message delivered late does not replace the newer observation
+	s.Record(readingsMessage(reading{2 * time.Minute, 20}), readingsStart.Add(2*time.Minute))
+	s.Record(readingsMessage(reading{time.Minute, 10}), readingsStart.Add(3*time.Minute))
+
+	summaries := s.Summaries(readingsStart.Add(4 * time.Minute))
+	if len(summaries) != 1 {
+		t.Fatalf("%d summaries, want 1", len(summaries))
+	}
+	latest := summaries[0].Devices["d1"]
+	if !latest.Time.Equal(readingsStart.Add(2*time.Minute)) || latest.Values["t"] != 20 {
+		t.Errorf("latest = %v %v, want the observation of 10:02", latest.Time, latest.Values)
+	}
+	if !latest.LastSeen.Equal(readingsStart.Add(3 * time.Minute)) {
+		t.Errorf("last seen = %v, want the last message", latest.LastSeen)
+	}
+}
@@ -2,10 +2,14 @@ package usecase
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"sync/atomic"
 	"time"
 
+	"github.com/Go-routine-4595/DataEnricher/domain"
 	"github.com/Go-routine-4595/DataEnricher/service"
 	"github.com/rs/zerolog"
 )
@@ -18,19 +22,95 @@ type IDynatraceClient interface {
 type IGeoKonAPIMessage interface {
 	GeoKonAPIMessage(message []byte) error
 }
+
+// IAlerter returns the alerts raised or cleared by a message
+type IAlerter interface {
+	Evaluate(msg domain.EnrichedMessage) ([]domain.Alert, error)
+}
+
+// IAnomalyDetector scores the observations of a message and returns its anomalies, Checkpoint saves the
+// models and returns how many were saved
+type IAnomalyDetector interface {
+	Detect(msg *domain.EnrichedMessage) ([]domain.Anomaly, error)
+	Checkpoint() (int, error)
+}
+
+// IEventForgetter releases the deduplication mark of a message that could not be published
+type IEventForgetter interface {
+	ForgetEvent(msg domain.EnrichedMessage)
+}
+
+// ILiveness tracks the reports of the devices
+type ILiveness interface {
+	Seen(msg domain.EnrichedMessage, now time.Time) (*domain.DeviceStatus, error)
+	Check(now time.Time) ([]domain.DeviceStatus, error)
+	Silent(siteCode string, now time.Time) ([]domain.SilentDevice, error)
+}
+
+// ErrLivenessDisabled is returned when silent devices are queried without liveness tracking
+var ErrLivenessDisabled = errors.New("liveness tracking is disabled")
+
 type IPublishMessage interface {
-	PublishMessage(message []byte, topic string)
+	// PublishMessage returns an error when the message is lost
+	PublishMessage(message []byte, topic string) error
 }
+
+// IAdmin is the runtime control surface of the use case
+type IAdmin interface {
+	Pause()
+	Resume()
+	IsPaused() bool
+	QueueDepth() int
+	Failures() FailureReport
+	ReloadRules() (int, error)
+	SilentDevices(siteCode string) ([]domain.SilentDevice, error)
+}
+
 type UseCase struct {
-	publishMessage   IPublishMessage
-	srv              service.IProcessMessage
-	logger           *zerolog.Logger
-	channel          chan []byte
-	publishBaseTopic string
-	dynatrace        IDynatraceClient
+	publishMessage IPublishMessage
+	srv            service.IProcessMessage
+	logger         *zerolog.Logger
+	channel        chan []byte
+	dynatrace      IDynatraceClient
+	failures       *FailureTracker
+	paused         atomic.Bool
+	wake           chan struct{}
+	router         atomic.Pointer[TopicRouter]
+	deadLetter     string
+	shaper         *Shaper
+	encoders       map[string]IEncoder
+	compressor     ICompressor
+	batcher        *Batcher
+	ruleSource     IRuleSource
+	rules          atomic.Pointer[RuleSet]
+	alerter        IAlerter
+	alertRouter    *TopicRouter
+	aggregator     *Aggregator
+	summarizer     *Summarizer
+	gapRouter      *TopicRouter
+	anomalies      IAnomalyDetector
+	anomalyRouter  *TopicRouter
+	checkpoint     time.Duration
+	liveness       ILiveness
+	livenessRouter *TopicRouter
+	livenessCheck  time.Duration
+	closed         atomic.Bool
+	drain          chan drainRequest
+	done           chan struct{}
 }
 
-func NewUseCase(pub IPublishMessage, srv service.IProcessMessage, dynatrace IDynatraceClient, publishTopic string, l *zerolog.Logger, ctx context.Context) *UseCase {
+type drainRequest struct {
+	ctx    context.Context
+	result chan drainResult
+}
+
+type drainResult struct {
+	drained   int
+	abandoned int
+}
+
+// NewUseCase creates the use case, the stages are set with the With methods before Start runs it
+func NewUseCase(pub IPublishMessage, srv service.IProcessMessage, dynatrace IDynatraceClient, publishTopic string, l *zerolog.Logger) *UseCase {
 	var (
 		logger zerolog.Logger
 	)
@@ -42,20 +122,33 @@ func NewUseCase(pub IPublishMessage, srv service.IProcessMessage, dynatrace IDyn
 	}
 
 	useCase := &UseCase{
-		publishMessage:   pub,
-		srv:              srv,
-		logger:           &logger,
-		channel:          make(chan []byte, 100),
-		publishBaseTopic: publishTopic,
-		dynatrace:        dynatrace,
+		publishMessage: pub,
+		srv:            srv,
+		logger:         &logger,
+		channel:        make(chan []byte, 100),
+		dynatrace:      dynatrace,
+		failures:       NewFailureTracker(20),
+		wake:           make(chan struct{}, 1),
+		drain:          make(chan drainRequest),
+		done:           make(chan struct{}),
 	}
-
-	go useCase.start(ctx)
+	router, _ := NewTopicRouter(publishTopic, DefaultTopicTemplate)
+	useCase.router.Store(router)
+	useCase.shaper, _ = NewShaper(string(ShapeEnriched), nil)
 
 	return useCase
 }
 
+// Start processes the queued messages until the context is done or the use case is drained, the With
+// methods must not be called once it started
+func (u *UseCase) Start(ctx context.Context) {
+	go u.start(ctx)
+}
+
 func (u *UseCase) GeoKonAPIMessage(message []byte) error {
+	if u.closed.Load() {
+		return errors.New("use case is shutting down")
+	}
 
 	select {
 	case u.channel <- message:
@@ -63,47 +156,296 @@ func (u *UseCase) GeoKonAPIMessage(message []byte) error {
 		u.logger.Debug().Msg("Message sent to channel successfully")
 	default:
 		// Channel is full, handle accordingly
-		return errors.New("channel is full")
+		err := errors.New("channel is full")
+		u.failures.Record(ReasonChannelFull, err)
+		return err
 	}
 	return nil
 }
 
+// SetRouter swaps the router used to compute publish topics
+func (u *UseCase) SetRouter(router *TopicRouter) {
+	u.router.Store(router)
+}
+
+// WithDeadLetterTopic publishes the rejected messages, with the reason they were rejected, to topic
+func (u *UseCase) WithDeadLetterTopic(topic string) *UseCase {
+	u.deadLetter = topic
+	return u
+}
+
+// WithShaper sets the output shape of the published messages per data model
+func (u *UseCase) WithShaper(shaper *Shaper) *UseCase {
+	u.shaper = shaper
+	return u
+}
+
+// WithBatcher publishes the enriched messages in batches instead of one by one
+func (u *UseCase) WithBatcher(batcher *Batcher) *UseCase {
+	u.batcher = batcher
+	return u
+}
+
+// WithRules filters and routes the enriched messages with rules, source is read again by ReloadRules
+func (u *UseCase) WithRules(source IRuleSource, rules *RuleSet) *UseCase {
+	u.ruleSource = source
+	u.rules.Store(rules)
+	return u
+}
+
+// WithAlerts publishes the alerts of the enriched messages to the topic router computes
+func (u *UseCase) WithAlerts(alerter IAlerter, router *TopicRouter) *UseCase {
+	u.alerter = alerter
+	u.alertRouter = router
+	return u
+}
+
+// WithLiveness tracks the reports of the devices and publishes their stale and recovered events to the topic
+// router computes, the overdue devices are checked every checkInterval
+func (u *UseCase) WithLiveness(liveness ILiveness, router *TopicRouter, checkInterval time.Duration) *UseCase {
+	u.liveness = liveness
+	u.livenessRouter = router
+	u.livenessCheck = checkInterval
+	return u
+}
+
+// WithAggregator publishes the rollups of the observations over tumbling windows alongside the messages
+func (u *UseCase) WithAggregator(aggregator *Aggregator) *UseCase {
+	u.aggregator = aggregator
+	return u
+}
+
+// WithAnomalies scores the observations of the enriched messages and publishes their anomalies to the topic
+// router computes, nil only attaches the scores, the models are checkpointed every checkpoint
+func (u *UseCase) WithAnomalies(detector IAnomalyDetector, router *TopicRouter, checkpoint time.Duration) *UseCase {
+	u.anomalies = detector
+	u.anomalyRouter = router
+	u.checkpoint = checkpoint
+	return u
+}
+
+// WithGaps publishes the gaps found in the observations of the devices to the topic router computes
+func (u *UseCase) WithGaps(router *TopicRouter) *UseCase {
+	u.gapRouter = router
+	return u
+}
+
+// WithSummary publishes the periodic summary of every site
+func (u *UseCase) WithSummary(summarizer *Summarizer) *UseCase {
+	u.summarizer = summarizer
+	return u
+}
+
+// SilentDevices returns the devices of a site that missed their expected reports
+func (u *UseCase) SilentDevices(siteCode string) ([]domain.SilentDevice, error) {
+	if u.liveness == nil {
+		return nil, ErrLivenessDisabled
+	}
+	return u.liveness.Silent(siteCode, time.Now().UTC())
+}
+
+// ReloadRules reads the rule set from its source again and returns the number of rules, the current
+// rules are kept when the new ones do not compile
+func (u *UseCase) ReloadRules() (int, error) {
+	if u.ruleSource == nil {
+		return 0, errors.New("no rule source configured")
+	}
+	rules, err := LoadRules(u.ruleSource, u.router.Load().base)
+	if err != nil {
+		return 0, err
+	}
+	u.rules.Store(rules)
+	u.logger.Info().Msgf("Loaded %d rules", rules.Len())
+	return rules.Len(), nil
+}
+
+// Pause stops consuming queued messages, new messages are still queued until the channel is full unless the
+// input subscription is paused too, as the admin API does
+func (u *UseCase) Pause() {
+	u.paused.Store(true)
+	u.notify()
+	u.logger.Info().Msg("Message consumption paused")
+}
+
+// Resume restarts consuming queued messages
+func (u *UseCase) Resume() {
+	u.paused.Store(false)
+	u.notify()
+	u.logger.Info().Msg("Message consumption resumed")
+}
+
+func (u *UseCase) IsPaused() bool {
+	return u.paused.Load()
+}
+
+// QueueDepth returns the number of messages waiting to be processed
+func (u *UseCase) QueueDepth() int {
+	return len(u.channel)
+}
+
+// Failures returns the failures recorded since startup
+func (u *UseCase) Failures() FailureReport {
+	return u.failures.Report()
+}
+
+// Drain stops accepting messages and processes the queued ones until the queue is empty or the context
+// is done, it returns how many queued messages were processed and how many were abandoned
+func (u *UseCase) Drain(ctx context.Context) (drained int, abandoned int) {
+	u.closed.Store(true)
+
+	req := drainRequest{ctx: ctx, result: make(chan drainResult, 1)}
+	select {
+	case u.drain <- req:
+	case <-u.done:
+		return 0, len(u.channel)
+	case <-ctx.Done():
+		return 0, len(u.channel)
+	}
+
+	res := <-req.result
+	return res.drained, res.abandoned
+}
+
+func (u *UseCase) drainQueue(ctx context.Context) drainResult {
+	var res drainResult
+
+	for {
+		select {
+		case <-ctx.Done():
+			res.abandoned = len(u.channel)
+			return res
+		default:
+		}
+
+		select {
+		case msg := <-u.channel:
+			u.processMessage(msg)
+			res.drained++
+		default:
+			return res
+		}
+	}
+}
+
+func (u *UseCase) notify() {
+	select {
+	case u.wake <- struct{}{}:
+	default:
+	}
+}
+
 func (u *UseCase) start(ctx context.Context) {
+	defer close(u.done)
+
+	var batchTicker, aggregateTicker, livenessTicker, summaryTicker, checkpointTicker *time.Ticker
+	if u.batcher != nil {
+		batchTicker = time.NewTicker(u.batcher.TickInterval())
+	}
+	if u.aggregator != nil {
+		aggregateTicker = time.NewTicker(u.aggregator.TickInterval())
+	}
+	if u.liveness != nil {
+		livenessTicker = time.NewTicker(u.livenessCheck)
+	}
+	if u.summarizer != nil {
+		summaryTicker = time.NewTicker(u.summarizer.TickInterval())
+	}
+	if u.anomalies != nil {
+		checkpointTicker = time.NewTicker(u.checkpoint)
+	}
+	defer func() {
+		for _, ticker := range []*time.Ticker{batchTicker, aggregateTicker, livenessTicker, summaryTicker, checkpointTicker} {
+			if ticker != nil {
+				ticker.Stop()
+			}
+		}
+	}()
+
 	for {
+		in := u.channel
+		if u.paused.Load() {
+			in = nil
+		}
+
 		select {
 		case <-ctx.Done():
 			u.logger.Info().Msg("UseCase Context done, exiting")
 			return
-		case msg := <-u.channel:
+		case <-u.wake:
+		case req := <-u.drain:
+			res := u.drainQueue(req.ctx)
+			if u.batcher != nil {
+				u.publishBatches(u.batcher.Flush())
+			}
+			if u.aggregator != nil {
+				u.publishAggregates(u.aggregator.Flush())
+			}
+			if u.anomalies != nil {
+				u.checkpointAnomalies()
+			}
+			req.result <- res
+			return
+		case now := <-tickerC(batchTicker):
+			u.publishBatches(u.batcher.Expired(now))
+		case now := <-tickerC(aggregateTicker):
+			u.publishAggregates(u.aggregator.Expired(now))
+		case now := <-tickerC(livenessTicker):
+			u.checkLiveness(now.UTC())
+		case now := <-tickerC(summaryTicker):
+			u.publishSummaries(u.summarizer.Summaries(now))
+		case <-tickerC(checkpointTicker):
+			u.checkpointAnomalies()
+		case msg := <-in:
 			u.processMessage(msg)
 		}
 	}
 }
 
+func tickerC(ticker *time.Ticker) <-chan time.Time {
+	if ticker == nil {
+		return nil
+	}
+	return ticker.C
+}
+
 func (u *UseCase) processMessage(msg []byte) {
 	var (
-		topic   string
-		success bool
+		enrichedMsg domain.EnrichedMessage
+		topic       string
+		messages    []outMessage
+		success     bool
+		dropped     bool
+		reason      string
+		err         error
 	)
 
 	defer func(now time.Time) {
-		elapsed := time.Since(now).Seconds()
-		u.logger.Info().Msgf("ProcessMessage took %f second", elapsed)
-		if success {
-			//u.dynatrace.RecordMessageProcessed(u.topic, elapsed, true)
-		} else {
-			//u.dynatrace.RecordMessageProcessed(u.topic, elapsed, false)
-			//s.dynatrace.RecordError("invalid_format", topic)
-			// or
-			// s.dynatrace.RecordError("enrichment_error", topic)
-			// or
-			//s.dynatrace.RecordError("repository_error", topic)
+		elapsed := time.Since(now)
+		u.logger.Info().Msgf("ProcessMessage took %f second", elapsed.Seconds())
+		if !dropped {
+			u.summarize(enrichedMsg, success, reason)
+		}
+		if u.dynatrace == nil {
+			return
+		}
+		// The metrics are dimensioned by the base topic, the routed topics hold device ids
+		base := u.router.Load().base
+		u.dynatrace.RecordMessageProcessed(base, float64(elapsed.Microseconds())/1000, success)
+		if !success {
+			u.dynatrace.RecordError(reason, base)
 		}
 
 	}(time.Now())
 
-	enrichedMsg, err := u.srv.ProcessMessage(msg)
+	enrichedMsg, err = u.srv.ProcessMessage(msg)
 	if err != nil {
+		reason = failureReason(err)
+		u.failures.Record(reason, err)
+		if reason == ReasonDuplicate {
+			u.logger.Debug().Msgf("Dropped %v", err)
+			return
+		}
+		u.publishDeadLetter(reason, err, msg)
 		var geoKonErr *service.ErrNotGeoKonAPIData
 		if errors.As(err, &geoKonErr) {
 			u.logger.Warn().Msgf("Invalid GeoKonAPI data: %v", err)
@@ -114,19 +456,318 @@ func (u *UseCase) processMessage(msg []byte) {
 		u.logger.Debug().Msgf("Message: %s", string(msg))
 		return
 	}
-	b, err := enrichedMsg.Byte()
+	// A message dropped by a rule leaves no trace in the liveness, gaps or summary of its device
+	routes, dropped := u.applyRules(enrichedMsg)
+	if dropped {
+		success = true
+		return
+	}
+	u.recordLiveness(enrichedMsg)
+	u.publishGaps(enrichedMsg.Gaps)
+	u.publishAlerts(enrichedMsg)
+	u.detectAnomalies(&enrichedMsg)
+	u.aggregate(enrichedMsg)
+	topic = u.router.Load().Route(enrichedMsg)
+	enrichedMsg.LatencyMs = float64(time.Since(enrichedMsg.IngestTime).Microseconds()) / 1000
+	docs, err := u.shaper.Encode(enrichedMsg)
+	if err == nil && len(docs) == 0 {
+		// The observation shape publishes one message per observation, there is nothing to publish
+		reason = ReasonNoObservations
+		u.failures.Record(reason, fmt.Errorf("message of device %s has no observations, nothing published", enrichedMsg.DeviceID))
+		u.logger.Warn().Msgf("Message of device %s has no observations, nothing published", enrichedMsg.DeviceID)
+		return
+	}
+	messageType := u.shaper.MessageType(enrichedMsg)
+	if err == nil && u.batcher == nil {
+		messages, err = u.encode(SinkEnriched, messageType, topic, docs)
+	}
+	for _, route := range routes {
+		if err != nil {
+			break
+		}
+		var routed []outMessage
+		routed, err = u.encode(SinkEnriched, messageType, route, docs)
+		messages = append(messages, routed...)
+	}
 	if err != nil {
+		if forgetter, ok := u.srv.(IEventForgetter); ok {
+			forgetter.ForgetEvent(enrichedMsg)
+		}
+		reason = ReasonEncodingError
+		u.failures.Record(reason, err)
+		u.publishDeadLetter(reason, err, msg)
 		u.logger.Error().Msgf("Error converting message to byte: %v", err)
 		u.logger.Debug().Msgf("Message: %s", string(msg))
 		return
 	}
-	topic = u.publishBaseTopic + "/" + enrichedMsg.SiteCode + "/" + enrichedMsg.DeviceID
+	if u.batcher != nil {
+		u.publishBatches(u.batcher.Add(enrichedMsg, docs))
+	}
+	err = u.publish(messages)
+	if err != nil {
+		reason = ReasonPublishError
+		u.failures.Record(reason, err)
+		return
+	}
 	success = true
-	if u.publishMessage != nil {
-		u.publishMessage.PublishMessage(b, topic)
-	} else {
-		u.mockPublishMessage(b, topic)
+}
+
+// summarize accounts for a message in the summary of its site, a message is counted once it is published and as
+// an error when it failed at any step, duplicates are not counted
+func (u *UseCase) summarize(msg domain.EnrichedMessage, success bool, reason string) {
+	if u.summarizer == nil || msg.SiteCode == "" || reason == ReasonDuplicate {
+		return
+	}
+	if success {
+		u.summarizer.Record(msg, time.Now())
+		return
+	}
+	u.summarizer.RecordError(msg.SiteCode)
+}
+
+// applyRules returns the extra topics the message is routed to, or whether a rule dropped it
+func (u *UseCase) applyRules(msg domain.EnrichedMessage) (routes []string, drop bool) {
+	rules := u.rules.Load()
+	if rules == nil {
+		return nil, false
+	}
+
+	result := rules.Evaluate(msg)
+	for _, match := range result.Matches {
+		if match.Err != nil {
+			err := fmt.Errorf("rule %s on device %s: %w", match.Rule, msg.DeviceID, match.Err)
+			u.failures.Record(ReasonRuleError, err)
+			u.logger.Warn().Msgf("Error evaluating %v", err)
+		}
+	}
+	if result.Drop != "" {
+		u.logger.Debug().Msgf("Message of device %s dropped by rule %s", msg.DeviceID, result.Drop)
+		return nil, true
+	}
+	return result.Routes, false
+}
+
+func (u *UseCase) aggregate(msg domain.EnrichedMessage) {
+	if u.aggregator == nil {
+		return
+	}
+
+	closed, late := u.aggregator.Add(msg, time.Now())
+	if late > 0 {
+		u.logger.Debug().Msgf("Dropped %d late observations of device %s from the aggregates", late, msg.DeviceID)
+	}
+	u.publishAggregates(closed)
+}
+
+func (u *UseCase) publishAggregates(aggregates []*domain.Aggregate) {
+	for _, aggregate := range aggregates {
+		b, err := json.Marshal(aggregate)
+		if err == nil {
+			var messages []outMessage
+			messages, err = u.encode(SinkAggregate, MessageAggregate, u.aggregator.Topic(aggregate), [][]byte{b})
+			if err == nil {
+				u.publish(messages)
+				continue
+			}
+		}
+		u.failures.Record(ReasonEncodingError, err)
+		u.logger.Error().Msgf("Error encoding the %s aggregate of %s of device %s: %v", aggregate.Window, aggregate.Metric, aggregate.DeviceID, err)
+	}
+}
+
+// detectAnomalies attaches the anomaly scores to the payload of the message and publishes its anomalies
+func (u *UseCase) detectAnomalies(msg *domain.EnrichedMessage) {
+	if u.anomalies == nil {
+		return
+	}
+
+	anomalies, err := u.anomalies.Detect(msg)
+	if err != nil {
+		u.failures.Record(ReasonAnomalyError, err)
+		u.logger.Warn().Msgf("Error detecting %v", err)
+	}
+	err = msg.SyncPayload()
+	if err != nil {
+		u.failures.Record(ReasonEncodingError, err)
+		u.logger.Error().Msgf("Error encoding the anomaly scores of device %s: %v", msg.DeviceID, err)
+	}
+	if u.anomalyRouter == nil {
+		return
+	}
+
+	for _, anomaly := range anomalies {
+		b, err := json.Marshal(anomaly)
+		if err == nil {
+			var messages []outMessage
+			messages, err = u.encode(SinkAnomaly, MessageAnomaly, u.anomalyRouter.Route(*msg), [][]byte{b})
+			if err == nil {
+				u.publish(messages)
+				continue
+			}
+		}
+		u.failures.Record(ReasonEncodingError, err)
+		u.logger.Error().Msgf("Error encoding the %s anomaly of %s of device %s: %v", anomaly.Kind, anomaly.Metric, anomaly.DeviceID, err)
+	}
+}
+
+func (u *UseCase) checkpointAnomalies() {
+	saved, err := u.anomalies.Checkpoint()
+	if err != nil {
+		u.failures.Record(ReasonAnomalyError, err)
+		u.logger.Warn().Msgf("Error checkpointing the anomaly models: %v", err)
+	}
+	if saved > 0 {
+		u.logger.Debug().Msgf("Checkpointed %d anomaly models", saved)
+	}
+}
+
+func (u *UseCase) publishGaps(gaps []domain.Gap) {
+	for _, gap := range gaps {
+		u.logger.Info().Msgf("Device %s of site %s missed %d reports between %s and %s", gap.DeviceID, gap.SiteCode, gap.MissedReports, gap.From.Format(time.RFC3339), gap.To.Format(time.RFC3339))
+		if u.gapRouter == nil {
+			continue
+		}
+
+		b, err := json.Marshal(gap)
+		if err == nil {
+			topic := u.gapRouter.Route(domain.EnrichedMessage{DeviceID: gap.DeviceID, SiteCode: gap.SiteCode})
+			var messages []outMessage
+			messages, err = u.encode(SinkGap, MessageGap, topic, [][]byte{b})
+			if err == nil {
+				u.publish(messages)
+				continue
+			}
+		}
+		u.failures.Record(ReasonEncodingError, err)
+		u.logger.Error().Msgf("Error encoding the gap of device %s: %v", gap.DeviceID, err)
+	}
+}
+
+func (u *UseCase) publishSummaries(summaries []domain.SiteSummary) {
+	for _, summary := range summaries {
+		b, err := json.Marshal(summary)
+		if err == nil {
+			var messages []outMessage
+			messages, err = u.encode(SinkSummary, MessageSiteSummary, u.summarizer.Topic(summary.SiteCode), [][]byte{b})
+			if err == nil {
+				u.publish(messages)
+				continue
+			}
+		}
+		u.failures.Record(ReasonEncodingError, err)
+		u.logger.Error().Msgf("Error encoding the summary of site %s: %v", summary.SiteCode, err)
+	}
+}
+
+func (u *UseCase) recordLiveness(msg domain.EnrichedMessage) {
+	if u.liveness == nil {
+		return
+	}
+
+	status, err := u.liveness.Seen(msg, time.Now().UTC())
+	if err != nil {
+		u.failures.Record(ReasonLivenessError, err)
+		u.logger.Warn().Msgf("Error recording the report of device %s: %v", msg.DeviceID, err)
+	}
+	if status != nil {
+		u.publishDeviceStatus([]domain.DeviceStatus{*status})
+	}
+}
+
+func (u *UseCase) checkLiveness(now time.Time) {
+	events, err := u.liveness.Check(now)
+	if err != nil {
+		u.failures.Record(ReasonLivenessError, err)
+		u.logger.Warn().Msgf("Error checking stale devices: %v", err)
+	}
+	u.publishDeviceStatus(events)
+}
+
+func (u *UseCase) publishDeviceStatus(events []domain.DeviceStatus) {
+	for _, event := range events {
+		u.logger.Info().Msgf("Device %s of site %s is %s, last seen %s", event.DeviceID, event.SiteCode, event.Event, event.LastSeen.Format(time.RFC3339))
+
+		b, err := json.Marshal(event)
+		if err == nil {
+			topic := u.livenessRouter.Route(domain.EnrichedMessage{DeviceID: event.DeviceID, SiteCode: event.SiteCode})
+			var messages []outMessage
+			messages, err = u.encode(SinkLiveness, MessageDeviceStatus, topic, [][]byte{b})
+			if err == nil {
+				u.publish(messages)
+				continue
+			}
+		}
+		u.failures.Record(ReasonEncodingError, err)
+		u.logger.Error().Msgf("Error encoding %s event of device %s: %v", event.Event, event.DeviceID, err)
+	}
+}
+
+func (u *UseCase) publishAlerts(msg domain.EnrichedMessage) {
+	if u.alerter == nil {
+		return
+	}
+
+	alerts, err := u.alerter.Evaluate(msg)
+	if err != nil {
+		u.failures.Record(ReasonAlertError, err)
+		u.logger.Warn().Msgf("Error evaluating %v", err)
+	}
+	if len(alerts) == 0 {
+		return
+	}
+
+	docs := make([][]byte, 0, len(alerts))
+	for _, alert := range alerts {
+		b, err := json.Marshal(alert)
+		if err != nil {
+			u.logger.Error().Msgf("Error encoding alert: %v", err)
+			continue
+		}
+		docs = append(docs, b)
+		u.logger.Info().Msgf("Alert %s %s for %s of device %s: %g %s", alert.Event, alert.Level, alert.Metric, alert.DeviceID, alert.Value, alert.Unit)
+	}
+	messages, err := u.encode(SinkAlert, MessageAlert, u.alertRouter.Route(msg), docs)
+	if err != nil {
+		u.failures.Record(ReasonEncodingError, err)
+		u.logger.Error().Msgf("Error encoding alerts of device %s: %v", msg.DeviceID, err)
+		return
+	}
+	u.publish(messages)
+}
+
+func (u *UseCase) publishBatches(batches []*BatchEnvelope) {
+	for _, batch := range batches {
+		b, err := json.Marshal(batch)
+		if err == nil {
+			var messages []outMessage
+			messages, err = u.encode(SinkEnriched, MessageBatch, batch.Key, [][]byte{b})
+			if err == nil {
+				u.publish(messages)
+				continue
+			}
+		}
+		u.failures.Record(ReasonEncodingError, err)
+		u.logger.Error().Msgf("Error encoding batch of %d messages for %s, batch dropped: %v", batch.Count, batch.Key, err)
+	}
+}
+
+func (u *UseCase) publishDeadLetter(reason string, err error, msg []byte) {
+	if u.deadLetter == "" {
+		return
+	}
+
+	letter := newDeadLetter(reason, err, msg)
+	b, err := json.Marshal(letter)
+	if err != nil {
+		u.logger.Error().Msgf("Error encoding dead letter: %v", err)
+		return
+	}
+	messages, err := u.encode(SinkDeadLetter, MessageDeadLetter, u.deadLetter, [][]byte{b})
+	if err != nil {
+		u.logger.Error().Msgf("Error encoding dead letter: %v", err)
+		return
 	}
+	u.publish(messages)
 }
 
 func (u *UseCase) mockPublishMessage(message []byte, topic string) {
@@ -0,0 +1,269 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+	"github.com/Go-routine-4595/DataEnricher/service"
+	"github.com/rs/zerolog"
+)
+
+// fakeService enriches a message holding "<siteCode>/<deviceId>", other messages have an invalid format
+type fakeService struct{}
+
+func (fakeService) ProcessMessage(msg []byte) (domain.EnrichedMessage, error) {
+	site, device, ok := strings.Cut(string(msg), "/")
+	if !ok {
+		return domain.EnrichedMessage{}, &service.ErrInvalidFormat{Err: errors.New("no device")}
+	}
+	return domain.EnrichedMessage{
+		DeviceID:   device,
+		SiteCode:   site,
+		Data:       json.RawMessage(`{}`),
+		IngestTime: time.Now().UTC(),
+	}, nil
+}
+
+type published struct {
+	topic   string
+	message []byte
+}
+
+// fakePublisher keeps the published messages, or fails them with err
+type fakePublisher struct {
+	mu       sync.Mutex
+	messages []published
+	err      error
+}
+
+func (p *fakePublisher) PublishMessage(message []byte, topic string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, published{topic: topic, message: message})
+	return nil
+}
+
+func (p *fakePublisher) topics() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	topics := make([]string, len(p.messages))
+	for i, m := range p.messages {
+		topics[i] = m.topic
+	}
+	return topics
+}
+
+func newTestUseCase(pub IPublishMessage) *UseCase {
+	logger := zerolog.Nop()
+	return NewUseCase(pub, fakeService{}, nil, "base", &logger)
+}
+
+// The stages are set before Start, the test is meaningful under the race detector
+func TestStartDrain(t *testing.T) {
+	pub := &fakePublisher{}
+	u := newTestUseCase(pub).
+		WithBatcher(NewBatcher(mustRouter(t, DefaultBatchTopicTemplate), BatchOptions{MaxCount: 10, MaxLatency: time.Hour})).
+		WithSummary(NewSummarizer(time.Hour, time.Hour, mustRouter(t, "{base}/{siteCode}/summary")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	u.Start(ctx)
+
+	for _, msg := range []string{"s1/d1", "s1/d2", "s2/d3"} {
+		if err := u.GeoKonAPIMessage([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelDrain()
+	// The loop may process some messages before the drain, only the queued ones are counted
+	drained, abandoned := u.Drain(drainCtx)
+	if drained > 3 || abandoned != 0 {
+		t.Errorf("Drain = %d drained %d abandoned, want none abandoned", drained, abandoned)
+	}
+
+	want := []string{"base/s1/batch", "base/s2/batch"}
+	if got := pub.topics(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("published to %v, want %v", got, want)
+	}
+	if err := u.GeoKonAPIMessage([]byte("s1/d1")); err == nil {
+		t.Error("message accepted after the drain")
+	}
+}
+
+type fakeDynatrace struct {
+	processed map[bool]int
+	errors    []string
+}
+
+func (d *fakeDynatrace) RecordMessageProcessed(topic string, processingTimeMs float64, success bool) {
+	d.processed[success]++
+}
+
+func (d *fakeDynatrace) RecordError(errorType, topic string) {
+	d.errors = append(d.errors, errorType)
+}
+
+func TestProcessMessageMetrics(t *testing.T) {
+	tests := []struct {
+		name        string
+		msg         string
+		wantSuccess int
+		wantFailed  int
+		wantErrors  []string
+	}{
+		{name: "processed", msg: "s1/d1", wantSuccess: 1},
+		{name: "rejected", msg: "garbage", wantFailed: 1, wantErrors: []string{ReasonInvalidFormat}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := &fakeDynatrace{processed: make(map[bool]int)}
+			logger := zerolog.Nop()
+			u := NewUseCase(&fakePublisher{}, fakeService{}, metrics, "base", &logger)
+
+			u.processMessage([]byte(tt.msg))
+			if metrics.processed[true] != tt.wantSuccess || metrics.processed[false] != tt.wantFailed {
+				t.Errorf("processed = %v, want %d succeeded and %d failed", metrics.processed, tt.wantSuccess, tt.wantFailed)
+			}
+			if strings.Join(metrics.errors, ",") != strings.Join(tt.wantErrors, ",") {
+				t.Errorf("errors = %v, want %v", metrics.errors, tt.wantErrors)
+			}
+		})
+	}
+}
+
+// staticService returns the same enriched message and error for every inbound message
+type staticService struct {
+	msg domain.EnrichedMessage
+	err error
+}
+
+func (s staticService) ProcessMessage([]byte) (domain.EnrichedMessage, error) {
+	return s.msg, s.err
+}
+
+func TestProcessMessageShapes(t *testing.T) {
+	tests := []struct {
+		name         string
+		shape        string
+		readings     []reading
+		wantMessages int
+		wantFailures int
+	}{
+		{name: "enriched", shape: "enriched", readings: []reading{{value: 1}}, wantMessages: 1},
+		{name: "one message per observation", shape: "observation", readings: []reading{{value: 1}, {time.Minute, 2}}, wantMessages: 2},
+		{name: "no observations counted", shape: "observation", wantFailures: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := readingsMessage(tt.readings...)
+			shaper, err := NewShaper(tt.shape, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pub := &fakePublisher{}
+			logger := zerolog.Nop()
+			u := NewUseCase(pub, staticService{msg: msg}, nil, "base", &logger).WithShaper(shaper)
+
+			u.processMessage([]byte("s1/d1"))
+			if len(pub.topics()) != tt.wantMessages {
+				t.Errorf("%d messages published, want %d", len(pub.topics()), tt.wantMessages)
+			}
+			if got := u.Failures().Counts[ReasonNoObservations]; got != tt.wantFailures {
+				t.Errorf("%d no_observations failures, want %d", got, tt.wantFailures)
+			}
+		})
+	}
+}
+
+func TestProcessMessageDropped(t *testing.T) {
+	rules, err := ParseRules([]byte(`[{name: drop-s1, when: 'siteCode == "s1"', action: drop}]`), "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := &fakePublisher{}
+	summarizer := NewSummarizer(time.Hour, time.Hour, mustRouter(t, "{base}/{siteCode}/summary"))
+	u := newTestUseCase(pub).WithRules(nil, rules).WithSummary(summarizer)
+
+	u.processMessage([]byte("s1/d1"))
+	u.processMessage([]byte("s2/d2"))
+	if got := pub.topics(); len(got) != 1 {
+		t.Errorf("published = %v, want the message of s2 only", got)
+	}
+	summaries := summarizer.Summaries(time.Now())
+	if len(summaries) != 1 || summaries[0].SiteCode != "s2" {
+		t.Errorf("summaries = %+v, want s2 only", summaries)
+	}
+}
+
+func TestProcessMessageSummary(t *testing.T) {
+	tests := []struct {
+		name         string
+		srv          staticService
+		shape        string
+		rules        string
+		publishErr   error
+		wantMessages int
+		wantErrors   int
+	}{
+		{name: "published", srv: staticService{msg: readingsMessage(reading{value: 1})}, wantMessages: 1},
+		{
+			name:         "enrichment failed",
+			srv:          staticService{msg: readingsMessage(), err: &service.ErrTransform{DeviceID: "d1", Transform: "calibration", Err: errors.New("bad sheet")}},
+			wantMessages: 1,
+			wantErrors:   1,
+		},
+		{name: "duplicate", srv: staticService{msg: readingsMessage(), err: &service.ErrDuplicate{DeviceID: "d1", EventUUID: "e1"}}},
+		{name: "nothing to publish", srv: staticService{msg: readingsMessage()}, shape: "observation", wantMessages: 1, wantErrors: 1},
+		{
+			name:         "publish failed",
+			srv:          staticService{msg: readingsMessage(reading{value: 1})},
+			publishErr:   errors.New("outbox full"),
+			wantMessages: 1,
+			wantErrors:   1,
+		},
+		{name: "dropped by a rule", srv: staticService{msg: readingsMessage(reading{value: 1})}, rules: `[{name: drop, when: "true", action: drop}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summarizer := NewSummarizer(time.Hour, time.Hour, mustRouter(t, "{base}/{siteCode}/summary"))
+			logger := zerolog.Nop()
+			u := NewUseCase(&fakePublisher{err: tt.publishErr}, tt.srv, nil, "base", &logger).WithSummary(summarizer)
+			if tt.shape != "" {
+				shaper, err := NewShaper(tt.shape, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				u.WithShaper(shaper)
+			}
+			if tt.rules != "" {
+				rules, err := ParseRules([]byte(tt.rules), "base")
+				if err != nil {
+					t.Fatal(err)
+				}
+				u.WithRules(nil, rules)
+			}
+
+			u.processMessage([]byte("s1/d1"))
+			var messages, errs int
+			for _, summary := range summarizer.Summaries(time.Now()) {
+				messages += summary.Messages
+				errs += summary.Errors
+			}
+			if messages != tt.wantMessages || errs != tt.wantErrors {
+				t.Errorf("summary = %d messages %d errors, want %d and %d", messages, errs, tt.wantMessages, tt.wantErrors)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/Go-routine-4595/DataEnricher/domain"
+	"github.com/Go-routine-4595/DataEnricher/internal/config"
+	"github.com/Go-routine-4595/DataEnricher/internal/encoding"
+	"github.com/Go-routine-4595/DataEnricher/internal/redis"
+	"github.com/Go-routine-4595/DataEnricher/usecase"
+)
+
+// configValidators check the settings whose rules belong to the packages using them, they run on startup, on
+// reload and in config check
+var configValidators = []config.Validator{
+	validateRedis,
+	validateRegistryFields,
+	validateEncodings,
+	validateTopicTemplates,
+}
+
+func validateRedis(c *config.Config) error {
+	if _, err := redis.ParseConnectionString(c.RedisConnectionString.Value()); err != nil {
+		return fmt.Errorf("redis_connection_string: %w", err)
+	}
+	return nil
+}
+
+func validateRegistryFields(c *config.Config) error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(c.RegistryFields)) {
+		if slices.Contains(domain.ReservedFields, name) {
+			errs = append(errs, fmt.Errorf("registry_fields: %s is a field of the enriched message", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validateEncodings(c *config.Config) error {
+	var errs []error
+	for _, sink := range slices.Sorted(maps.Keys(c.Encodings)) {
+		if err := encoding.ValidateName(c.Encodings[sink]); err != nil {
+			errs = append(errs, fmt.Errorf("encodings: %s %w", sink, err))
+		}
+	}
+	if err := encoding.ValidateAvroSchemaID(c.AvroSchemaID); err != nil {
+		errs = append(errs, fmt.Errorf("avro_schema_id: %w", err))
+	}
+	if c.Compression != "" {
+		if err := encoding.ValidateCompression(c.Compression); err != nil {
+			errs = append(errs, fmt.Errorf("compression: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateTopicTemplates checks the placeholders of the topic templates of the enabled sinks, the way the routers
+// built from them on startup do
+func validateTopicTemplates(c *config.Config) error {
+	templates := []struct {
+		setting  string
+		template string
+		enabled  bool
+	}{
+		{"publish_topic_template", c.PublishTopicTemplate, true},
+		{"alert_topic", c.AlertTopic, c.AlertTopic != ""},
+		{"anomaly_topic_template", c.AnomalyTopic, c.AnomalyDetection && c.AnomalyTopic != ""},
+		{"aggregate_topic_template", c.AggregateTopic, len(c.AggregateWindows) > 0},
+		{"gap_topic", c.GapTopic, c.GapTopic != ""},
+		{"summary_topic_template", c.SummaryTopic, c.SummaryInterval > 0},
+		{"liveness_topic", c.LivenessTopic, c.LivenessTopic != ""},
+		{"batch_topic_template", c.BatchTopicTemplate, c.BatchEnabled},
+	}
+
+	var errs []error
+	for _, t := range templates {
+		if !t.enabled {
+			continue
+		}
+		if err := usecase.ValidateTopicTemplate(t.template); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.setting, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Go-routine-4595/DataEnricher/internal/config"
+)
+
+func TestConfigValidators(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *config.Config)
+		want   []string
+	}{
+		{name: "defaults", change: func(c *config.Config) {}},
+		{
+			name:   "unknown placeholder",
+			change: func(c *config.Config) { c.PublishTopicTemplate = "{base}/{site}" },
+			want:   []string{"publish_topic_template: unknown placeholder {site}"},
+		},
+		{
+			name:   "unbalanced braces",
+			change: func(c *config.Config) { c.AlertTopic = "{base}/alerts/{deviceId" },
+			want:   []string{"alert_topic: unbalanced braces"},
+		},
+		{
+			name: "templates of disabled sinks are ignored",
+			change: func(c *config.Config) {
+				c.BatchEnabled = false
+				c.BatchTopicTemplate = "{batch}"
+				c.SummaryInterval = 0
+				c.SummaryTopic = "{summary}"
+			},
+		},
+		{
+			name: "templates of enabled sinks",
+			change: func(c *config.Config) {
+				c.AggregateWindows = []time.Duration{time.Minute}
+				c.AggregateTopic = "{base}/{window}"
+				c.AnomalyDetection = true
+				c.AnomalyTopic = "{base}/anomalies/{deviceId}"
+			},
+			want: []string{"aggregate_topic_template: unknown placeholder {window}"},
+		},
+		{
+			name: "reserved registry field",
+			change: func(c *config.Config) {
+				c.RegistryFields = map[string]string{"device_id": "id", "zone": "location.zone"}
+			},
+			want: []string{"registry_fields: device_id is a field of the enriched message"},
+		},
+		{
+			name: "encodings",
+			change: func(c *config.Config) {
+				c.Encodings = map[string]string{"alert": "xml"}
+				c.AvroSchemaID = -1
+				c.Compression = "lz4"
+			},
+			want: []string{"encodings: alert must be one of", "avro_schema_id: must be between 0", "compression: must be one of"},
+		},
+		{
+			name:   "redis connection string",
+			change: func(c *config.Config) { c.RedisConnectionString = "" },
+			want:   []string{"redis_connection_string:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config.Default()
+			tt.change(c)
+			err := c.Validate(configValidators...)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate = nil, want %v", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate = %v, want %q", err, want)
+				}
+			}
+		})
+	}
+}